@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lccxxo/bailuoli/internal/config"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/controller"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 离线命令：加载配置并构建路由，但不监听端口
+
+func loadRouter(configPath string) (*model.Config, *controller.Router, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load config %s failed: %w", configPath, err)
+	}
+
+	// 离线命令不输出运行日志
+	_ = logger.InitLogger(cfg.Log.Level, nil, logger.RotationConfig{})
+
+	// 离线路由不启动健康检查和服务发现，不会探测上游节点
+	router, err := controller.NewOfflineRouter(cfg.Routes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("build router failed: %w", err)
+	}
+	return cfg, router, nil
+}
+
+func runValidate(configPath string) error {
+	cfg, router, err := loadRouter(configPath)
+	if err != nil {
+		return err
+	}
+	defer router.Stop()
+
+	fmt.Printf("config %s is valid: %d route(s)\n", configPath, len(cfg.Routes))
+	return nil
+}
+
+func runRoutes(configPath string) error {
+	_, router, err := loadRouter(configPath)
+	if err != nil {
+		return err
+	}
+	defer router.Stop()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tMETHOD\tMATCHER\tSTRIP_PREFIX\tSTRATEGY\tUPSTREAMS")
+	for _, route := range router.Routes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\n",
+			route.Name,
+			methodOrAny(route.Method),
+			describeMatcher(route),
+			route.StripPrefix,
+			route.LoadBalance.Strategy,
+			strings.Join(upstreamURLs(route), ","),
+		)
+	}
+	return w.Flush()
+}
+
+func runMatch(configPath, method, path string) error {
+	_, router, err := loadRouter(configPath)
+	if err != nil {
+		return err
+	}
+	defer router.Stop()
+
+	req, err := http.NewRequest(strings.ToUpper(method), path, nil)
+	if err != nil {
+		return fmt.Errorf("invalid request %s %s: %w", method, path, err)
+	}
+
+	route, _ := router.MatchRoute(req)
+	if route == nil {
+		return fmt.Errorf("no route matched %s %s", req.Method, req.URL.Path)
+	}
+
+	fmt.Printf("route:     %s\n", route.Name)
+	fmt.Printf("method:    %s\n", methodOrAny(route.Method))
+	fmt.Printf("matcher:   %s\n", describeMatcher(route))
+	fmt.Printf("strategy:  %s\n", route.LoadBalance.Strategy)
+	fmt.Println("upstreams:")
+	for _, u := range upstreamURLs(route) {
+		fmt.Printf("  - %s\n", u)
+	}
+	return nil
+}
+
+func describeMatcher(route *model.Route) string {
+	return fmt.Sprintf("%s %s", route.MatchType, route.Path)
+}
+
+func methodOrAny(method string) string {
+	if method == "" {
+		return "*"
+	}
+	return method
+}
+
+// upstreamURLs 静态上游节点，使用服务发现的路由显示发现类型和目标
+func upstreamURLs(route *model.Route) []string {
+	if d := route.Discovery; d != nil {
+		return []string{describeDiscovery(d)}
+	}
+	urls := make([]string, 0, len(route.Upstreams))
+	for _, u := range route.Upstreams {
+		urls = append(urls, u.Host+u.Path)
+	}
+	return urls
+}
+
+// describeDiscovery 服务发现的类型和目标，例如 consul:orders、dns:orders.service SRV
+func describeDiscovery(d *model.DiscoveryConfig) string {
+	switch d.Type {
+	case constants.DiscoveryConsul:
+		target := "consul:" + d.Service
+		if d.Tag != "" {
+			target += " tag=" + d.Tag
+		}
+		return target
+	case constants.DiscoveryFile:
+		return "file:" + d.File
+	case constants.DiscoveryDNS:
+		recordType := d.RecordType
+		if recordType == "" {
+			recordType = "A"
+		}
+		return fmt.Sprintf("dns:%s %s", d.Name, strings.ToUpper(recordType))
+	default:
+		return d.Type
+	}
+}
@@ -1,11 +1,77 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+
 	"github.com/lccxxo/bailuoli/cmd/start"
+	"github.com/lccxxo/bailuoli/internal/constants"
 )
 
 // 入口函数
 
+// version 构建时通过 -ldflags "-X main.version=x.y.z" 注入
+var version = "dev"
+
+const usage = `Usage: bailuoli <command> [flags]
+
+Commands:
+  start     启动网关
+  validate  校验配置文件并构建路由，不监听端口
+  routes    打印生效的路由表
+  match     查看请求会命中的路由和上游节点池，例如: bailuoli match --config gateway.yaml GET /foo
+  version   打印版本号
+
+Run 'bailuoli <command> -h' for command flags.
+`
+
 func main() {
-	start.Run()
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cmd, args := os.Args[1], os.Args[2:]
+	var err error
+	switch cmd {
+	case "start":
+		fs, configPath := newFlagSet(cmd)
+		_ = fs.Parse(args)
+		start.Run(*configPath)
+	case "validate":
+		fs, configPath := newFlagSet(cmd)
+		_ = fs.Parse(args)
+		err = runValidate(*configPath)
+	case "routes":
+		fs, configPath := newFlagSet(cmd)
+		_ = fs.Parse(args)
+		err = runRoutes(*configPath)
+	case "match":
+		fs, configPath := newFlagSet(cmd)
+		_ = fs.Parse(args)
+		if fs.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "Usage: bailuoli match --config <path> <METHOD> <PATH>")
+			os.Exit(2)
+		}
+		err = runMatch(*configPath, fs.Arg(0), fs.Arg(1))
+	case "version":
+		fmt.Println(version)
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := fs.String("config", constants.DefaultConfigPath, "配置文件路径")
+	return fs, configPath
 }
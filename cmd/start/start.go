@@ -2,25 +2,35 @@ package start
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
+	"github.com/lccxxo/bailuoli/internal/admin"
+	"github.com/lccxxo/bailuoli/internal/certs"
+	"github.com/lccxxo/bailuoli/internal/clientip"
+	"github.com/lccxxo/bailuoli/internal/constants"
 	"github.com/lccxxo/bailuoli/internal/controller"
+	"github.com/lccxxo/bailuoli/internal/metrics"
 	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/proxy"
+	"github.com/lccxxo/bailuoli/internal/ratelimit"
 
 	"github.com/lccxxo/bailuoli/internal/config"
 	"github.com/lccxxo/bailuoli/internal/logger"
 	"go.uber.org/zap"
 )
 
-func Run() {
+func Run(configPath string) {
 	// 加载配置
-	cfg, err := config.Load("configs/gateway.yaml")
+	cfg, err := config.Load(configPath)
 	if err != nil {
 		panic(fmt.Sprintf("load config failed: %v", err))
 	}
@@ -34,28 +44,51 @@ func Run() {
 	})
 	defer logger.Sync()
 
+	// 初始化分布式限流存储
+	ratelimit.SetRedis(cfg.Redis)
+
+	// 初始化可信代理
+	if err := clientip.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		panic(fmt.Sprintf("init trusted proxies failed: %v", err))
+	}
+
 	// 初始化路由
-	router := controller.NewRouter(cfg.Routes)
+	router, err := controller.NewRouter(cfg.Routes)
+	if err != nil {
+		panic(fmt.Sprintf("init router failed: %v", err))
+	}
+	defer router.Stop()
+	proxy.SetRetryBudget(cfg.Server.RetryBudget)
 
 	// 启动配置热更新监听
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	config.Watch(ctx, "configs/gateway.yaml", func(newCfg *model.Config) {
+	// 加载证书并监听证书文件变化
+	var certManager *certs.Manager
+	if cfg.Server.TLS != nil {
+		certManager, err = certs.NewManager(cfg.Server.TLS.Certificates)
+		if err != nil {
+			panic(fmt.Sprintf("load certificates failed: %v", err))
+		}
+		certManager.Watch(ctx)
+	}
+
+	config.Watch(ctx, configPath, func(newCfg *model.Config) error {
 		logger.Logger.Info("检测到配置变更，开始热更新")
 
-		// 更新路由
-		if err := router.UpdateRoutes(newCfg.Routes); err != nil {
+		if err := applyConfig(router, certManager, newCfg); err != nil {
 			logger.Logger.Error("路由更新失败", zap.Error(err))
-			return
+			return err
 		}
 
-		// 更新日志配置
-		logger.UpdateLogLevel(newCfg.Log.Level)
-
 		logger.Logger.Info("配置热更新完成")
+		return nil
 	}, 5*time.Second)
 
+	// 注册健康状态、熔断器状态指标
+	metrics.RegisterStatusSource(router)
+
 	server := &http.Server{
 		Addr:         cfg.Server.Addr,
 		ReadTimeout:  cfg.Server.ReadTimeout,
@@ -68,6 +101,9 @@ func Run() {
 					return
 				}
 
+				logger.GetRequestInfo(r.Context()).Route = route.Name
+				defer metrics.RouteRequestStarted(route.Name)()
+
 				// 传递路由信息到上下文
 				ctx := context.WithValue(r.Context(), "route", route)
 				handler.ServeHTTP(w, r.WithContext(ctx))
@@ -75,11 +111,92 @@ func Run() {
 		),
 	}
 
+	if cfg.Server.TLS != nil {
+		server.TLSConfig, err = certManager.TLSConfig(cfg.Server.TLS)
+		if err != nil {
+			panic(fmt.Sprintf("init tls config failed: %v", err))
+		}
+		// 未启用 h2 时需要显式关闭 HTTP/2，否则 http.Server 会自动添加
+		if !slices.Contains(server.TLSConfig.NextProtos, constants.ALPNHTTP2) {
+			server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		}
+	}
+
 	// 启动服务
 	startServer(server, cfg)
 
+	servers := []*http.Server{server}
+
+	// 启动 HTTP 重定向到 HTTPS 的服务
+	if cfg.Server.TLS != nil && cfg.Server.TLS.RedirectAddr != "" {
+		redirectServer := newRedirectServer(cfg.Server.TLS.RedirectAddr, cfg.Server.Addr)
+		startServer(redirectServer, cfg)
+		servers = append(servers, redirectServer)
+	}
+
+	// 启动管理接口
+	if cfg.Server.AdminAddr != "" {
+		adminHandler := admin.NewServer(router, func() error {
+			newCfg, err := config.Load(configPath)
+			if err == nil {
+				logger.Logger.Info("管理接口触发配置重新加载")
+				err = applyConfig(router, certManager, newCfg)
+			}
+			metrics.ObserveConfigReload(err)
+			return err
+		})
+		adminHandler.SetToken(cfg.Server.AdminToken)
+		adminHandler.SetListenAddr(cfg.Server.AdminAddr)
+		adminServer := &http.Server{
+			Addr:    cfg.Server.AdminAddr,
+			Handler: adminHandler,
+		}
+		startServer(adminServer, cfg)
+		servers = append(servers, adminServer)
+	}
+
 	// 优雅关闭
-	waitForShutdown(server, cfg.Server.ShutdownTimeout)
+	waitForShutdown(cfg.Server.ShutdownTimeout, servers...)
+}
+
+// applyConfig 应用新配置（热更新和管理接口重新加载共用）
+// 先加载所有可能失败的部分（可信代理、证书、路由），全部成功后再一起生效，任意一项失败时保留当前配置
+func applyConfig(router *controller.Router, certManager *certs.Manager, newCfg *model.Config) error {
+	trustedProxies, err := clientip.NewPrefixSet(newCfg.Server.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	// 证书列表（启用或关闭 TLS、修改 TLS 版本等监听参数需要重启）
+	// 启用或关闭客户端证书校验需要重启，这里只更新 CA 文件
+	var certificates *certs.Certificates
+	if certManager != nil && newCfg.Server.TLS != nil {
+		certificates, err = certManager.Prepare(newCfg.Server.TLS.Certificates, newCfg.Server.TLS.ClientCAFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	update, err := router.PrepareRoutes(newCfg.Routes)
+	if err != nil {
+		return err
+	}
+
+	// 以下更新不会失败
+	// 更新分布式限流存储（配置未变化时保留原有连接）
+	ratelimit.SetRedis(newCfg.Redis)
+	clientip.SetTrustedProxySet(trustedProxies)
+	if certificates != nil {
+		certManager.Apply(certificates)
+	}
+	update.Commit()
+
+	// 更新全局重试预算
+	proxy.SetRetryBudget(newCfg.Server.RetryBudget)
+
+	// 更新日志配置
+	logger.UpdateLogLevel(newCfg.Log.Level)
+	return nil
 }
 
 func startServer(server *http.Server, cfg *model.Config) {
@@ -87,14 +204,40 @@ func startServer(server *http.Server, cfg *model.Config) {
 		logger.Logger.Info("Starting API Gateway",
 			zap.String("address", server.Addr))
 
-		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if server.TLSConfig != nil {
+			// 证书由 TLSConfig.GetCertificate 提供
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
 			logger.Logger.Fatal("Server crashed",
 				zap.String("error", err.Error()))
 		}
 	}()
 }
 
-func waitForShutdown(server *http.Server, timeout time.Duration) {
+// newRedirectServer 将 HTTP 请求永久重定向到 HTTPS 监听地址
+func newRedirectServer(addr, httpsAddr string) *http.Server {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return &http.Server{
+		Addr:              addr,
+		ReadHeaderTimeout: 10 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if port != "" && port != "443" {
+				host = net.JoinHostPort(host, port)
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+		}),
+	}
+}
+
+func waitForShutdown(timeout time.Duration, servers ...*http.Server) {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
@@ -105,8 +248,10 @@ func waitForShutdown(server *http.Server, timeout time.Duration) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Logger.Error("Shutdown error",
-			zap.String("error", err.Error()))
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Logger.Error("Shutdown error",
+				zap.String("error", err.Error()))
+		}
 	}
 }
@@ -0,0 +1,130 @@
+package start
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lccxxo/bailuoli/internal/certs"
+	"github.com/lccxxo/bailuoli/internal/clientip"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/controller"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+)
+
+func testConfig(route string, trustedProxies ...string) *model.Config {
+	return &model.Config{
+		Server: model.ServerConfig{TrustedProxies: trustedProxies},
+		Routes: []*model.Route{{
+			Name:        route,
+			Path:        "/" + route,
+			MatchType:   "prefix",
+			Upstreams:   []*model.UpstreamsConfig{{Host: "http://127.0.0.1:8080"}},
+			LoadBalance: model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin},
+		}},
+	}
+}
+
+// newCertManager 使用 httptest 的自签名证书创建证书管理器
+func newCertManager(t *testing.T) (*certs.Manager, model.CertificateConfig) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	srv.Close()
+	cert := srv.TLS.Certificates[0]
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	config := model.CertificateConfig{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+	if err := os.WriteFile(config.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	m, err := certs.NewManager([]model.CertificateConfig{config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, config
+}
+
+func TestApplyConfigAllOrNothing(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	certManager, certConfig := newCertManager(t)
+	router, err := controller.NewRouter(testConfig("orders").Routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(router.Stop)
+	if err := clientip.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = clientip.SetTrustedProxies(nil) })
+
+	// trustedClient 可信代理生效时返回 X-Forwarded-For 中的地址
+	trustedClient := func() bool {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", "203.0.113.1")
+		return clientip.FromRequest(r) == "203.0.113.1"
+	}
+	unchanged := func(t *testing.T) {
+		t.Helper()
+		if routes := router.GetRoutes(); len(routes) != 1 || routes[0].Name != "orders" {
+			t.Errorf("routes replaced after a failed reload")
+		}
+		if trustedClient() {
+			t.Error("trusted proxies applied after a failed reload")
+		}
+	}
+
+	tests := []struct {
+		name   string
+		config func() *model.Config
+	}{
+		{name: "invalid route", config: func() *model.Config {
+			cfg := testConfig("users", "10.0.0.0/8")
+			cfg.Routes[0].MatchType = "unknown"
+			return cfg
+		}},
+		{name: "missing certificate", config: func() *model.Config {
+			cfg := testConfig("users", "10.0.0.0/8")
+			cfg.Server.TLS = &model.TLSConfig{Certificates: []model.CertificateConfig{{CertFile: "missing.pem", KeyFile: "missing.pem"}}}
+			return cfg
+		}},
+		{name: "missing client ca", config: func() *model.Config {
+			cfg := testConfig("users", "10.0.0.0/8")
+			cfg.Server.TLS = &model.TLSConfig{Certificates: []model.CertificateConfig{certConfig}, ClientCAFile: "missing.pem"}
+			return cfg
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := applyConfig(router, certManager, tt.config()); err == nil {
+				t.Fatal("applyConfig succeeded")
+			}
+			unchanged(t)
+		})
+	}
+
+	// 全部加载成功后一起生效
+	cfg := testConfig("users", "10.0.0.0/8")
+	cfg.Server.TLS = &model.TLSConfig{Certificates: []model.CertificateConfig{certConfig}}
+	if err := applyConfig(router, certManager, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if routes := router.GetRoutes(); len(routes) != 1 || routes[0].Name != "users" {
+		t.Error("routes not replaced")
+	}
+	if !trustedClient() {
+		t.Error("trusted proxies not applied")
+	}
+}
@@ -0,0 +1,320 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/clientip"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/controller"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/metrics"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb/healthy"
+)
+
+// 管理接口，独立端口监听，用于查看网关运行状态及动态调整上游节点
+// 配置了 token 时修改类接口（非 GET 请求）需要携带 Authorization: Bearer <token>
+// 监听非本地地址时查询接口会暴露路由和上游节点拓扑，同样需要携带 token
+
+// ReloadFunc 触发配置重新加载
+type ReloadFunc func() error
+
+type Server struct {
+	router *controller.Router
+	reload ReloadFunc
+	token  string // 修改类接口的访问令牌，为空则不校验
+	public bool   // 监听非本地地址，查询接口同样校验 token
+	mux    *http.ServeMux
+}
+
+func NewServer(router *controller.Router, reload ReloadFunc) *Server {
+	s := &Server{
+		router: router,
+		reload: reload,
+		mux:    http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /routes", s.handleRoutes)
+	s.mux.HandleFunc("GET /health", s.handleHealth)
+	s.mux.HandleFunc("GET /breakers", s.handleBreakers)
+	s.mux.HandleFunc("GET /connections", s.handleConnections)
+	s.mux.HandleFunc("GET /log/level", s.handleGetLogLevel)
+	s.mux.HandleFunc("PUT /log/level", s.handleSetLogLevel)
+	s.mux.HandleFunc("POST /reload", s.handleReload)
+	s.mux.Handle("GET /metrics", metrics.Handler())
+	s.mux.HandleFunc("POST /routes/{name}/upstreams", s.handleAddUpstream)
+	s.mux.HandleFunc("DELETE /routes/{name}/upstreams", s.handleRemoveUpstream)
+	s.mux.HandleFunc("POST /routes/{name}/upstreams/drain", s.handleDrainUpstream)
+
+	return s
+}
+
+// SetToken 设置修改类接口的访问令牌
+func (s *Server) SetToken(token string) {
+	s.token = token
+}
+
+// SetListenAddr 设置管理接口的监听地址，非本地地址时所有接口都需要 token
+func (s *Server) SetListenAddr(addr string) {
+	host, _, err := net.SplitHostPort(addr)
+	s.public = err != nil || !clientip.IsLoopbackHost(host)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if s.token != "" && (!readOnly || s.public) && !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeError(w, http.StatusUnauthorized, errUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+var errUnauthorized = errors.New("missing or invalid admin token")
+
+// authorized 校验 Authorization 请求头中的 Bearer token
+func (s *Server) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(auth[7:])), []byte(s.token)) == 1
+}
+
+type routeView struct {
+	Name        string   `json:"name"`
+	Path        string   `json:"path"`
+	Method      string   `json:"method"`
+	MatchType   string   `json:"match_type"`
+	StripPrefix bool     `json:"strip_prefix"`
+	Strategy    string   `json:"strategy"`
+	Upstreams   []string `json:"upstreams"`
+}
+
+func (s *Server) handleRoutes(w http.ResponseWriter, r *http.Request) {
+	routes := s.router.GetRoutes()
+	views := make([]routeView, 0, len(routes))
+	for _, route := range routes {
+		view := routeView{
+			Name:        route.Name,
+			Path:        route.Path,
+			Method:      route.Method,
+			MatchType:   route.MatchType,
+			StripPrefix: route.StripPrefix,
+			Strategy:    route.LoadBalance.Strategy,
+			Upstreams:   []string{},
+		}
+		// 展示负载均衡器中实际生效的节点（可能已被动态调整）
+		if p, ok := s.router.Proxy(route.Name); ok {
+			for _, u := range p.LoadBalancer().Upstreams() {
+				view.Upstreams = append(view.Upstreams, u.String())
+			}
+		}
+		views = append(views, view)
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+type upstreamHealth struct {
+	Active  *healthy.StatusSnapshot  `json:"active,omitempty"`
+	Passive *healthy.OutlierSnapshot `json:"passive,omitempty"`
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	result := make(map[string]map[string]*upstreamHealth)
+	for _, route := range s.router.GetRoutes() {
+		upstreams := make(map[string]*upstreamHealth)
+		get := func(key string) *upstreamHealth {
+			if _, ok := upstreams[key]; !ok {
+				upstreams[key] = &upstreamHealth{}
+			}
+			return upstreams[key]
+		}
+
+		if checker := s.router.HealthChecker(route.Name); checker != nil {
+			for key, status := range checker.Snapshot() {
+				status := status
+				get(key).Active = &status
+			}
+		}
+		if passive := s.router.PassiveChecker(route.Name); passive != nil {
+			for key, status := range passive.Snapshot() {
+				status := status
+				get(key).Passive = &status
+			}
+		}
+		result[route.Name] = upstreams
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleBreakers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.router.BreakerManager().Snapshot())
+}
+
+type connectionView struct {
+	Inflight         map[string]int64 `json:"inflight"`
+	LeastConnections map[string]int64 `json:"least_connections,omitempty"`
+}
+
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	result := make(map[string]connectionView)
+	for _, route := range s.router.GetRoutes() {
+		p, ok := s.router.Proxy(route.Name)
+		if !ok {
+			continue
+		}
+		view := connectionView{Inflight: p.InflightSnapshot()}
+		if counter, ok := p.LoadBalancer().(interface{ ConnCounts() *lb.ConnCounter }); ok {
+			view.LeastConnections = counter.ConnCounts().Snapshot()
+		}
+		result[route.Name] = view
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+func (s *Server) handleGetLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, logLevelRequest{Level: logger.GetLogLevel()})
+}
+
+func (s *Server) handleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if err := logger.UpdateLogLevel(req.Level); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, logLevelRequest{Level: logger.GetLogLevel()})
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if s.reload == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("reload is not supported"))
+		return
+	}
+	if err := s.reload(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+}
+
+type upstreamRequest struct {
+	URL     string `json:"url"`
+	Timeout string `json:"timeout"` // 仅 drain 使用，等待正在处理的请求完成的最长时间
+}
+
+func (s *Server) handleAddUpstream(w http.ResponseWriter, r *http.Request) {
+	req, u, err := decodeUpstream(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.router.AddUpstream(r.PathValue("name"), u); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "added", "url": req.URL})
+}
+
+func (s *Server) handleRemoveUpstream(w http.ResponseWriter, r *http.Request) {
+	req, u, err := decodeUpstream(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.router.RemoveUpstream(r.PathValue("name"), u); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "removed", "url": req.URL})
+}
+
+func (s *Server) handleDrainUpstream(w http.ResponseWriter, r *http.Request) {
+	req, u, err := decodeUpstream(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	timeout := 30 * time.Second
+	if req.Timeout != "" {
+		if timeout, err = time.ParseDuration(req.Timeout); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid timeout: %w", err))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	inflight, err := s.router.DrainUpstream(ctx, r.PathValue("name"), u)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "drained",
+		"url":      req.URL,
+		"drained":  inflight == 0,
+		"inflight": inflight,
+	})
+}
+
+// decodeUpstream 从请求体（或 url 查询参数）中解析上游节点地址
+func decodeUpstream(r *http.Request) (upstreamRequest, *url.URL, error) {
+	var req upstreamRequest
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, nil, fmt.Errorf("invalid request body: %w", err)
+		}
+	}
+	if req.URL == "" {
+		req.URL = r.URL.Query().Get("url")
+	}
+	if req.URL == "" {
+		return req, nil, errors.New("url is required")
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return req, nil, fmt.Errorf("invalid upstream url %q: %w", req.URL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return req, nil, fmt.Errorf("upstream url %q must be an absolute http or https url", req.URL)
+	}
+	return req, u, nil
+}
+
+func statusOf(err error) int {
+	if errors.Is(err, constants.ErrRouteNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
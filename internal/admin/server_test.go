@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/controller"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+)
+
+func TestAdminToken(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	router, err := controller.NewOfflineRouter([]*model.Route{{
+		Name:        "orders",
+		Path:        "/orders",
+		MatchType:   "prefix",
+		Upstreams:   []*model.UpstreamsConfig{{Host: "http://127.0.0.1:8080"}},
+		LoadBalance: model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(router.Stop)
+
+	tests := []struct {
+		addr   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		// 本地地址只有修改类接口需要 token
+		{addr: "127.0.0.1:9090", method: http.MethodGet, path: "/routes", want: http.StatusOK},
+		{addr: "localhost:9090", method: http.MethodGet, path: "/breakers", want: http.StatusOK},
+		{addr: "127.0.0.1:9090", method: http.MethodPost, path: "/reload", want: http.StatusUnauthorized},
+		{addr: "127.0.0.1:9090", method: http.MethodPost, path: "/reload", token: "secret", want: http.StatusOK},
+		// 非本地地址查询接口会暴露拓扑，同样需要 token
+		{addr: "0.0.0.0:9090", method: http.MethodGet, path: "/routes", want: http.StatusUnauthorized},
+		{addr: ":9090", method: http.MethodGet, path: "/health", want: http.StatusUnauthorized},
+		{addr: "10.0.0.1:9090", method: http.MethodGet, path: "/routes", token: "wrong", want: http.StatusUnauthorized},
+		{addr: "10.0.0.1:9090", method: http.MethodGet, path: "/routes", token: "secret", want: http.StatusOK},
+		{addr: "10.0.0.1:9090", method: http.MethodPost, path: "/reload", token: "secret", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		s := NewServer(router, func() error { return nil })
+		s.SetToken("secret")
+		s.SetListenAddr(tt.addr)
+
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s %s on %s with token %q: status = %d, want %d", tt.method, tt.path, tt.addr, tt.token, w.Code, tt.want)
+		}
+	}
+}
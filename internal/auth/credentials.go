@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// 凭证文件（API Key、Basic 认证）
+// 1. 文件中只保存 bcrypt 或 argon2 哈希，校验通过的凭证以 sha256 摘要缓存，避免每个请求都计算慢哈希
+// 2. 监听文件所在目录，文件变化时重新加载并清空缓存，加载失败时继续使用旧的凭证
+// 相同路径的凭证文件全局共享，配置热更新时不会重新加载；所有使用者 Close 后停止监听
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// 校验通过的凭证缓存上限，超过时清空
+const maxVerifiedCredentials = 10000
+
+// Consumer 调用方，认证通过后写入请求上下文（consumer）
+type Consumer struct {
+	Name     string
+	Routes   []string // 允许访问的路由，为空则不限制
+	Tier     string   // 限流等级
+	Metadata map[string]string
+}
+
+// AllowRoute 是否允许访问路由
+func (c *Consumer) AllowRoute(route string) bool {
+	return len(c.Routes) == 0 || slices.Contains(c.Routes, route)
+}
+
+// credential 凭证哈希及所属的调用方
+type credential struct {
+	hash     *passwordHash
+	consumer *Consumer
+}
+
+type CredentialStore struct {
+	file string
+
+	mu       sync.RWMutex
+	apiKeys  map[string]*credential          // key_id -> 凭证
+	users    map[string]*credential          // 用户名 -> 凭证
+	verified map[[sha256.Size]byte]*Consumer // 校验通过的凭证摘要 -> 调用方
+	version  uint64                          // 每次重新加载加1
+
+	refs int           // 使用者数量，由 storesMu 保护
+	stop chan struct{} // 关闭时停止监听文件
+}
+
+var (
+	storesMu sync.Mutex
+	stores   = make(map[string]*CredentialStore)
+)
+
+// GetCredentialStore 获取凭证文件对应的存储，首次获取时加载并开始监听文件变化
+// 不再使用时需要调用 Close
+func GetCredentialStore(file string) (*CredentialStore, error) {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if s, ok := stores[file]; ok {
+		s.refs++
+		return s, nil
+	}
+
+	s := &CredentialStore{file: file, refs: 1, stop: make(chan struct{})}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	s.watch()
+	stores[file] = s
+	return s, nil
+}
+
+// Close 释放凭证存储，最后一个使用者释放时停止监听文件
+func (s *CredentialStore) Close() {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+	if stores[s.file] == s {
+		delete(stores, s.file)
+	}
+	close(s.stop)
+}
+
+// Reload 重新加载凭证文件
+func (s *CredentialStore) Reload() error {
+	config, err := LoadCredentials(s.file)
+	if err != nil {
+		return err
+	}
+
+	apiKeys := make(map[string]*credential)
+	users := make(map[string]*credential)
+	for _, c := range config.Consumers {
+		consumer := &Consumer{
+			Name:     c.Name,
+			Routes:   c.Routes,
+			Tier:     c.Tier,
+			Metadata: c.Metadata,
+		}
+		// LoadCredentials 已经校验过哈希格式
+		for _, k := range c.APIKeys {
+			hash, _ := parseHash(k.Hash)
+			apiKeys[k.ID] = &credential{hash: hash, consumer: consumer}
+		}
+		if c.Username != "" {
+			hash, _ := parseHash(c.PasswordHash)
+			users[c.Username] = &credential{hash: hash, consumer: consumer}
+		}
+	}
+
+	s.mu.Lock()
+	s.apiKeys = apiKeys
+	s.users = users
+	s.verified = make(map[[sha256.Size]byte]*Consumer)
+	s.version++
+	s.mu.Unlock()
+	return nil
+}
+
+// AuthenticateAPIKey 校验 <key_id>.<secret> 格式的 API Key
+func (s *CredentialStore) AuthenticateAPIKey(key string) (*Consumer, error) {
+	id, secret, ok := strings.Cut(key, ".")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalidCredentials
+	}
+	return s.authenticate("key:"+key, secret, func() *credential { return s.apiKeys[id] })
+}
+
+// AuthenticateBasic 校验 Basic 认证的用户名和密码
+func (s *CredentialStore) AuthenticateBasic(username, password string) (*Consumer, error) {
+	return s.authenticate("basic:"+username+":"+password, password, func() *credential { return s.users[username] })
+}
+
+func (s *CredentialStore) authenticate(cacheKey, secret string, lookup func() *credential) (*Consumer, error) {
+	digest := sha256.Sum256([]byte(cacheKey))
+
+	s.mu.RLock()
+	consumer, ok := s.verified[digest]
+	c := lookup()
+	version := s.version
+	s.mu.RUnlock()
+	if ok {
+		return consumer, nil
+	}
+
+	if c == nil {
+		// 凭证不存在时同样计算一次哈希，避免通过耗时判断凭证是否存在
+		dummy, _ := parseHash(dummyHash)
+		dummy.verify(secret)
+		return nil, ErrInvalidCredentials
+	}
+	if !c.hash.verify(secret) {
+		return nil, ErrInvalidCredentials
+	}
+
+	s.mu.Lock()
+	// 校验期间文件重新加载过时不写入缓存，避免缓存已删除的凭证
+	if s.version == version {
+		if len(s.verified) >= maxVerifiedCredentials {
+			s.verified = make(map[[sha256.Size]byte]*Consumer)
+		}
+		s.verified[digest] = c.consumer
+	}
+	s.mu.Unlock()
+	return c.consumer, nil
+}
+
+// watch 监听凭证文件所在目录，文件变化时重新加载
+func (s *CredentialStore) watch() {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Logger.Error("credentials watcher create failed", zap.String("file", s.file), zap.Error(err))
+		return
+	}
+	if err := w.Add(filepath.Dir(s.file)); err != nil {
+		logger.Logger.Error("credentials watch failed", zap.String("file", s.file), zap.Error(err))
+		w.Close()
+		return
+	}
+
+	go func() {
+		defer w.Close()
+
+		// 去抖动：编辑器保存文件时可能产生多个事件
+		timer := time.NewTimer(time.Second)
+		timer.Stop()
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case event, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				// 兼容通过符号链接原子替换的方式（如 Kubernetes Secret）
+				if event.Name == s.file || event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+					timer.Reset(time.Second)
+				}
+			case <-timer.C:
+				if err := s.Reload(); err != nil {
+					logger.Logger.Error("credentials reload failed, keep using the old credentials",
+						zap.String("file", s.file), zap.Error(err))
+					continue
+				}
+				logger.Logger.Info("credentials reloaded", zap.String("file", s.file))
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				logger.Logger.Warn("credentials watcher error", zap.String("file", s.file), zap.Error(err))
+			}
+		}
+	}()
+}
+
+// LoadCredentials 加载并校验凭证文件
+func LoadCredentials(file string) (*model.CredentialsConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("load credentials %s failed: %w", file, err)
+	}
+	var config model.CredentialsConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse credentials %s failed: %w", file, err)
+	}
+
+	keyIDs := make(map[string]bool)
+	usernames := make(map[string]bool)
+	for i, c := range config.Consumers {
+		path := fmt.Sprintf("%s: consumers[%d]", file, i)
+		if c.Name == "" {
+			return nil, fmt.Errorf("%s: name cannot be empty", path)
+		}
+		for j, k := range c.APIKeys {
+			if k.ID == "" || strings.Contains(k.ID, ".") {
+				return nil, fmt.Errorf("%s.api_keys[%d]: id cannot be empty or contain '.'", path, j)
+			}
+			if keyIDs[k.ID] {
+				return nil, fmt.Errorf("%s.api_keys[%d]: duplicate id %q", path, j, k.ID)
+			}
+			keyIDs[k.ID] = true
+			if _, err := parseHash(k.Hash); err != nil {
+				return nil, fmt.Errorf("%s.api_keys[%d]: %w", path, j, err)
+			}
+		}
+		if c.Username != "" {
+			if usernames[c.Username] {
+				return nil, fmt.Errorf("%s: duplicate username %q", path, c.Username)
+			}
+			usernames[c.Username] = true
+			if _, err := parseHash(c.PasswordHash); err != nil {
+				return nil, fmt.Errorf("%s.password_hash: %w", path, err)
+			}
+		}
+	}
+	return &config, nil
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 外部授权（ext_authz）
+// 将原请求的方法、路径和指定的请求头发送给授权服务，由授权服务决定是否放行
+// 授权结果按 方法 + 路径 + 转发的请求头 缓存，依赖其他信息（如客户端 IP）做决策时不应开启缓存
+
+// 授权服务的重定向（如跳转登录页）需要返回给客户端，不能自动跟随
+var extAuthzClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// 不从授权响应复制到上游请求或客户端响应的请求头
+var authzSkipHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Length":      true,
+	"Content-Encoding":    true,
+	"Date":                true,
+	"Server":              true,
+}
+
+// 授权服务不能设置到上游请求的请求头，即使配置在 upstream_headers 中
+var authzProtectedHeaders = map[string]bool{
+	"Host":          true,
+	"Authorization": true,
+}
+
+// IsProtectedUpstreamHeader 判断请求头是否不允许由授权服务设置到上游请求（Host、Authorization、逐跳请求头等）
+func IsProtectedUpstreamHeader(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	return authzSkipHeaders[name] || authzProtectedHeaders[name]
+}
+
+// AuthzResponse 授权结果
+type AuthzResponse struct {
+	Allowed bool
+	Status  int         // 授权服务返回的状态码
+	Header  http.Header // 放行时为需要添加到上游请求的请求头（值为空表示删除），拒绝时为返回给客户端的响应头
+	Body    []byte      // 拒绝时返回给客户端的响应体
+}
+
+type ExtAuthz struct {
+	config          model.ExtAuthzConfig
+	upstreamHeaders []string // 过滤掉受保护请求头后的 upstream_headers
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]*authzCacheEntry
+}
+
+type authzCacheEntry struct {
+	response *AuthzResponse
+	expires  time.Time
+}
+
+func NewExtAuthz(config model.ExtAuthzConfig) *ExtAuthz {
+	if config.Timeout <= 0 {
+		config.Timeout = constants.DefaultExtAuthzTimeout
+	}
+	if len(config.ForwardHeaders) == 0 {
+		config.ForwardHeaders = []string{"Authorization"}
+	}
+	if config.FailureMode == "" {
+		config.FailureMode = constants.ExtAuthzFailClosed
+	}
+	if config.StatusOnError == 0 {
+		config.StatusOnError = constants.DefaultExtAuthzStatusOnError
+	}
+	upstreamHeaders := make([]string, 0, len(config.UpstreamHeaders))
+	for _, name := range config.UpstreamHeaders {
+		if !IsProtectedUpstreamHeader(name) {
+			upstreamHeaders = append(upstreamHeaders, http.CanonicalHeaderKey(name))
+		}
+	}
+	return &ExtAuthz{
+		config:          config,
+		upstreamHeaders: upstreamHeaders,
+		cache:           make(map[[sha256.Size]byte]*authzCacheEntry),
+	}
+}
+
+// FailOpen 授权服务不可用时是否放行
+func (a *ExtAuthz) FailOpen() bool {
+	return a.config.FailureMode == constants.ExtAuthzFailOpen
+}
+
+// StatusOnError 授权服务不可用且拒绝请求时返回的状态码
+func (a *ExtAuthz) StatusOnError() int {
+	return a.config.StatusOnError
+}
+
+// Check 请求授权服务，授权服务不可用（请求失败、超时或返回 5xx）时返回错误
+func (a *ExtAuthz) Check(r *http.Request) (*AuthzResponse, error) {
+	key := a.cacheKey(r)
+	if a.config.CacheTTL > 0 {
+		if resp := a.cached(key); resp != nil {
+			return resp, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), a.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, r.Method, a.config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range a.config.ForwardHeaders {
+		for _, v := range r.Header.Values(name) {
+			req.Header.Add(name, v)
+		}
+	}
+	req.Header.Set(constants.HeaderForwardedMethod, r.Method)
+	req.Header.Set(constants.HeaderForwardedURI, r.URL.RequestURI())
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	if r.TLS != nil {
+		req.Header.Set("X-Forwarded-Proto", "https")
+	} else {
+		req.Header.Set("X-Forwarded-Proto", "http")
+	}
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+			ip = prior + ", " + ip
+		}
+		req.Header.Set("X-Forwarded-For", ip)
+	}
+
+	resp, err := extAuthzClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("ext_authz returned status %d", resp.StatusCode)
+	}
+
+	result := &AuthzResponse{
+		Allowed: resp.StatusCode >= 200 && resp.StatusCode < 300,
+		Status:  resp.StatusCode,
+		Header:  make(http.Header),
+	}
+	if result.Allowed {
+		a.copyUpstreamHeaders(result.Header, resp.Header)
+	} else {
+		for name, values := range resp.Header {
+			if !authzSkipHeaders[name] {
+				result.Header[name] = values
+			}
+		}
+		if result.Body, err = io.ReadAll(io.LimitReader(resp.Body, constants.ExtAuthzMaxBodySize)); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.config.CacheTTL > 0 {
+		a.store(key, result)
+	}
+	return result, nil
+}
+
+// StripUpstreamHeaders 删除请求中由授权服务设置的请求头（upstream_headers），授权服务不可用但放行时使用
+func (a *ExtAuthz) StripUpstreamHeaders(h http.Header) {
+	for _, name := range a.upstreamHeaders {
+		h.Del(name)
+	}
+}
+
+// copyUpstreamHeaders 只复制 upstream_headers 中的请求头，未配置时不复制任何请求头
+func (a *ExtAuthz) copyUpstreamHeaders(dst, src http.Header) {
+	for _, name := range a.upstreamHeaders {
+		// 授权服务未返回的请求头也需要删除，避免客户端伪造
+		dst[name] = src.Values(name)
+	}
+}
+
+func (a *ExtAuthz) cacheKey(r *http.Request) [sha256.Size]byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", r.Method, r.URL.RequestURI())
+	for _, name := range a.config.ForwardHeaders {
+		fmt.Fprintf(h, "%s:%q\n", name, r.Header.Values(name))
+	}
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key
+}
+
+func (a *ExtAuthz) cached(key [sha256.Size]byte) *AuthzResponse {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry, ok := a.cache[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(a.cache, key)
+		return nil
+	}
+	return entry.response
+}
+
+func (a *ExtAuthz) store(key [sha256.Size]byte, resp *AuthzResponse) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if len(a.cache) >= constants.ExtAuthzMaxCacheEntries {
+		// 先清理过期的结果，仍然超过上限时清空
+		for k, entry := range a.cache {
+			if now.After(entry.expires) {
+				delete(a.cache, k)
+			}
+		}
+		if len(a.cache) >= constants.ExtAuthzMaxCacheEntries {
+			a.cache = make(map[[sha256.Size]byte]*authzCacheEntry)
+		}
+	}
+	a.cache[key] = &authzCacheEntry{response: resp, expires: now.Add(a.config.CacheTTL)}
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// fakeAuthz 授权服务，Authorization 为 deny 时拒绝，记录请求次数
+func fakeAuthz(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.Header.Get("Authorization") == "deny" {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("X-User-Id", r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestExtAuthzCache(t *testing.T) {
+	srv, hits := fakeAuthz(t)
+	authz := NewExtAuthz(model.ExtAuthzConfig{
+		URL:             srv.URL,
+		UpstreamHeaders: []string{"X-User-Id"},
+		CacheTTL:        100 * time.Millisecond,
+	})
+	check := func(method, target, authorization, other string) *AuthzResponse {
+		t.Helper()
+		r := httptest.NewRequest(method, target, nil)
+		r.Header.Set("Authorization", authorization)
+		r.Header.Set("X-Other", other)
+		resp, err := authz.Check(r)
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		return resp
+	}
+
+	if resp := check(http.MethodGet, "/orders", "alice", "1"); !resp.Allowed || resp.Header.Get("X-User-Id") != "alice" {
+		t.Fatalf("allowed = %v, X-User-Id = %q", resp.Allowed, resp.Header.Get("X-User-Id"))
+	}
+	// 未转发给授权服务的请求头不影响缓存
+	check(http.MethodGet, "/orders", "alice", "2")
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("%d authz requests for the same request, want 1", n)
+	}
+
+	// 方法、路径、查询参数或转发的请求头不同时重新授权
+	check(http.MethodPost, "/orders", "alice", "1")
+	check(http.MethodGet, "/orders/1", "alice", "1")
+	check(http.MethodGet, "/orders?page=2", "alice", "1")
+	if resp := check(http.MethodGet, "/orders", "bob", "1"); resp.Header.Get("X-User-Id") != "bob" {
+		t.Errorf("X-User-Id = %q, want bob", resp.Header.Get("X-User-Id"))
+	}
+	if n := hits.Load(); n != 5 {
+		t.Fatalf("%d authz requests, want 5", n)
+	}
+
+	// 拒绝结果同样缓存
+	for i := 0; i < 2; i++ {
+		if resp := check(http.MethodGet, "/orders", "deny", "1"); resp.Allowed || resp.Status != http.StatusForbidden {
+			t.Fatalf("allowed = %v status = %d, want denied 403", resp.Allowed, resp.Status)
+		}
+	}
+	if n := hits.Load(); n != 6 {
+		t.Fatalf("%d authz requests, want 6", n)
+	}
+
+	// 过期后重新授权
+	time.Sleep(150 * time.Millisecond)
+	check(http.MethodGet, "/orders", "alice", "1")
+	if n := hits.Load(); n != 7 {
+		t.Errorf("%d authz requests after the cache expired, want 7", n)
+	}
+}
+
+func TestExtAuthzCacheDisabled(t *testing.T) {
+	srv, hits := fakeAuthz(t)
+	authz := NewExtAuthz(model.ExtAuthzConfig{URL: srv.URL})
+	for i := 0; i < 2; i++ {
+		if _, err := authz.Check(httptest.NewRequest(http.MethodGet, "/orders", nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("%d authz requests without cache_ttl, want 2", n)
+	}
+}
+
+func TestExtAuthzCacheEviction(t *testing.T) {
+	authz := NewExtAuthz(model.ExtAuthzConfig{URL: "http://127.0.0.1", CacheTTL: time.Minute})
+	resp := &AuthzResponse{Allowed: true}
+	key := func(path string) [sha256.Size]byte {
+		return authz.cacheKey(httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// 缓存达到上限时先清理过期的结果
+	authz.store(key("/expired"), resp)
+	authz.cache[key("/expired")].expires = time.Now().Add(-time.Second)
+	for i := 1; i < constants.ExtAuthzMaxCacheEntries; i++ {
+		authz.cache[[sha256.Size]byte{byte(i), byte(i >> 8)}] = &authzCacheEntry{response: resp, expires: time.Now().Add(time.Minute)}
+	}
+	authz.store(key("/orders"), resp)
+	if n := len(authz.cache); n != constants.ExtAuthzMaxCacheEntries {
+		t.Fatalf("%d cache entries, want %d", n, constants.ExtAuthzMaxCacheEntries)
+	}
+	if authz.cached(key("/expired")) != nil || authz.cached(key("/orders")) == nil {
+		t.Fatal("expired entry kept or new entry not stored")
+	}
+
+	// 没有过期的结果时清空
+	authz.store(key("/users"), resp)
+	if n := len(authz.cache); n != 1 || authz.cached(key("/users")) == nil {
+		t.Errorf("%d cache entries after overflow, want only the new one", n)
+	}
+}
+
+func TestExtAuthzUnavailable(t *testing.T) {
+	var status atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+	authz := NewExtAuthz(model.ExtAuthzConfig{URL: srv.URL, CacheTTL: time.Minute})
+
+	// 5xx 视为授权服务不可用，不缓存
+	status.Store(http.StatusServiceUnavailable)
+	if _, err := authz.Check(httptest.NewRequest(http.MethodGet, "/orders", nil)); err == nil {
+		t.Fatal("5xx from authz service not treated as an error")
+	}
+	status.Store(http.StatusOK)
+	if resp, err := authz.Check(httptest.NewRequest(http.MethodGet, "/orders", nil)); err != nil || !resp.Allowed {
+		t.Fatalf("after recovery allowed = %v err = %v", resp != nil && resp.Allowed, err)
+	}
+
+	// 默认 closed，返回 403
+	if authz.FailOpen() || authz.StatusOnError() != constants.DefaultExtAuthzStatusOnError {
+		t.Errorf("defaults fail_open = %v status_on_error = %d, want false %d",
+			authz.FailOpen(), authz.StatusOnError(), constants.DefaultExtAuthzStatusOnError)
+	}
+	authz = NewExtAuthz(model.ExtAuthzConfig{URL: srv.URL, FailureMode: constants.ExtAuthzFailOpen, StatusOnError: http.StatusServiceUnavailable})
+	if !authz.FailOpen() || authz.StatusOnError() != http.StatusServiceUnavailable {
+		t.Errorf("fail_open = %v status_on_error = %d, want true 503", authz.FailOpen(), authz.StatusOnError())
+	}
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"go.uber.org/zap"
+)
+
+// JWKS 远程密钥集缓存
+// 1. 首次使用时拉取，之后超过刷新间隔时在后台重新拉取
+// 2. token 中的 kid 不存在时立即刷新（密钥轮换），两次拉取之间至少间隔 JWKSMinRefreshInterval
+// 3. 同一时间只有一个拉取请求，拉取失败时继续使用旧的密钥
+// 相同地址和刷新间隔的 JWKS 全局共享，配置热更新时不会重新拉取；所有使用者 Close 后从缓存中移除
+
+var jwksClient = &http.Client{Timeout: constants.JWKSFetchTimeout}
+
+type JWKS struct {
+	url      string
+	interval time.Duration
+	cacheKey string
+	refs     int // 使用者数量，由 jwksMu 保护
+
+	mu        sync.Mutex
+	keys      []*key
+	fetchedAt time.Time     // 上次拉取成功的时间
+	triedAt   time.Time     // 上次尝试拉取的时间
+	inflight  chan struct{} // 正在进行的拉取，完成时关闭
+}
+
+var (
+	jwksMu    sync.Mutex
+	jwksCache = make(map[string]*JWKS)
+)
+
+// GetJWKS 获取地址对应的 JWKS，interval 为刷新间隔，不再使用时需要调用 Close
+func GetJWKS(url string, interval time.Duration) *JWKS {
+	if interval <= 0 {
+		interval = constants.DefaultJWKSRefreshInterval
+	}
+	cacheKey := url + "|" + interval.String()
+
+	jwksMu.Lock()
+	defer jwksMu.Unlock()
+	if j, ok := jwksCache[cacheKey]; ok {
+		j.refs++
+		return j
+	}
+	j := &JWKS{url: url, interval: interval, cacheKey: cacheKey, refs: 1}
+	jwksCache[cacheKey] = j
+	return j
+}
+
+// Close 释放 JWKS，最后一个使用者释放时从缓存中移除，正在进行的拉取完成后不再刷新
+func (j *JWKS) Close() {
+	jwksMu.Lock()
+	defer jwksMu.Unlock()
+	j.refs--
+	if j.refs <= 0 && jwksCache[j.cacheKey] == j {
+		delete(jwksCache, j.cacheKey)
+	}
+}
+
+// Keys 获取密钥列表
+// 没有可用密钥或 kid 不存在时等待拉取完成；密钥超过刷新间隔时在后台刷新，本次使用旧的密钥
+func (j *JWKS) Keys(ctx context.Context, kid string) []*key {
+	j.mu.Lock()
+	now := time.Now()
+	needed := len(j.keys) == 0 || kid != "" && !hasKID(j.keys, kid)
+	if !needed && now.Sub(j.fetchedAt) < j.interval {
+		keys := j.keys
+		j.mu.Unlock()
+		return keys
+	}
+
+	wait := j.inflight
+	if wait == nil && now.Sub(j.triedAt) >= constants.JWKSMinRefreshInterval {
+		j.triedAt = now
+		wait = make(chan struct{})
+		j.inflight = wait
+		go j.refresh(wait)
+	}
+	keys := j.keys
+	j.mu.Unlock()
+
+	if needed && wait != nil {
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return keys
+		}
+		j.mu.Lock()
+		keys = j.keys
+		j.mu.Unlock()
+	}
+	return keys
+}
+
+// refresh 拉取密钥，完成后关闭 done；失败时保留旧的密钥
+func (j *JWKS) refresh(done chan struct{}) {
+	defer close(done)
+
+	keys, err := j.fetch(context.Background())
+
+	j.mu.Lock()
+	if err == nil {
+		j.keys = keys
+		j.fetchedAt = time.Now()
+	}
+	j.inflight = nil
+	j.mu.Unlock()
+
+	if err != nil {
+		logger.Logger.Warn("jwks refresh failed, keep using the old keys",
+			zap.String("url", j.url), zap.Error(err))
+	}
+}
+
+func (j *JWKS) fetch(ctx context.Context) ([]*key, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := jwksClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode jwks failed: %w", err)
+	}
+
+	keys := make([]*key, 0, len(set.Keys))
+	for _, jk := range set.Keys {
+		// 跳过用于加密的密钥和不支持的密钥类型
+		if jk.Use != "" && jk.Use != "sig" {
+			continue
+		}
+		k, err := parseJWK(jk)
+		if err != nil {
+			logger.Logger.Debug("skip invalid jwk", zap.String("url", j.url), zap.String("kid", jk.Kid), zap.Error(err))
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func hasKID(keys []*key, kid string) bool {
+	for _, k := range keys {
+		if k.kid == kid {
+			return true
+		}
+	}
+	return false
+}
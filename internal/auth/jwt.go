@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// JWT 认证
+// 支持 RS、ES、HS 签名算法，签名密钥来自静态配置或 JWKS，校验 iss、aud、exp、nbf
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+type JWTAuthenticator struct {
+	config     model.JWTConfig
+	keys       []*key // 静态密钥
+	jwks       *JWKS
+	algorithms map[string]bool // 允许的签名算法
+	skew       time.Duration
+}
+
+func NewJWTAuthenticator(config model.JWTConfig) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{
+		config:     config,
+		algorithms: make(map[string]bool),
+		skew:       config.ClockSkew,
+	}
+	if a.skew <= 0 {
+		a.skew = constants.DefaultJWTClockSkew
+	}
+
+	allowed := config.Algorithms
+	if len(allowed) == 0 {
+		allowed = constants.JWTAlgorithms
+	}
+	for _, alg := range allowed {
+		if _, ok := algorithms[alg]; !ok {
+			return nil, fmt.Errorf("unsupported algorithm %q", alg)
+		}
+		a.algorithms[alg] = true
+	}
+
+	for i, kc := range config.Keys {
+		k := &key{kid: kc.KID}
+		switch {
+		case kc.Secret != "" && kc.PublicKeyFile != "":
+			return nil, fmt.Errorf("keys[%d]: secret and public_key_file cannot be used together", i)
+		case kc.Secret != "":
+			k.public = []byte(kc.Secret)
+		case kc.PublicKeyFile != "":
+			pub, err := loadPublicKeyFile(kc.PublicKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("keys[%d]: %w", i, err)
+			}
+			k.public = pub
+		default:
+			return nil, fmt.Errorf("keys[%d]: secret or public_key_file is required", i)
+		}
+		a.keys = append(a.keys, k)
+	}
+
+	if config.JWKSURL != "" {
+		a.jwks = GetJWKS(config.JWKSURL, config.JWKSRefreshInterval)
+	}
+	if len(a.keys) == 0 && a.jwks == nil {
+		return nil, errors.New("keys or jwks_url is required")
+	}
+	return a, nil
+}
+
+// Close 释放使用的 JWKS
+func (a *JWTAuthenticator) Close() {
+	if a.jwks != nil {
+		a.jwks.Close()
+	}
+}
+
+// Verify 校验 token 的签名和标准 claim，返回 token 中的 claims
+func (a *JWTAuthenticator) Verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalidToken("malformed header")
+	}
+	if !a.algorithms[header.Alg] {
+		return nil, invalidToken("algorithm %q is not allowed", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed signature")
+	}
+	if err := a.verifySignature(ctx, header.Alg, header.Kid, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalidToken("malformed claims")
+	}
+	if err := a.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Authorize 检查 claims 是否满足 required_claims
+func (a *JWTAuthenticator) Authorize(claims map[string]interface{}) bool {
+	return MatchClaims(claims, a.config.RequiredClaims)
+}
+
+// ForwardClaims 需要转发给上游的 claim：claim 名称 -> 请求头
+func (a *JWTAuthenticator) ForwardClaims() map[string]string {
+	return a.config.ForwardClaims
+}
+
+func (a *JWTAuthenticator) verifySignature(ctx context.Context, alg, kid string, signed, signature []byte) error {
+	candidates := a.keys
+	if a.jwks != nil {
+		candidates = append(candidates[:len(candidates):len(candidates)], a.jwks.Keys(ctx, kid)...)
+	}
+
+	found := false
+	for _, k := range candidates {
+		// token 携带 kid 时只使用 kid 相同或未配置 kid 的密钥
+		if kid != "" && k.kid != "" && k.kid != kid {
+			continue
+		}
+		if !k.supports(alg) {
+			continue
+		}
+		found = true
+		if k.verify(alg, signed, signature) == nil {
+			return nil
+		}
+	}
+	if !found {
+		return invalidToken("no key found for kid %q and algorithm %s", kid, alg)
+	}
+	return invalidToken("%v", errSignature)
+}
+
+func (a *JWTAuthenticator) validateClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	if v, ok := claims["exp"]; ok {
+		exp, ok := numericDate(v)
+		if !ok {
+			return invalidToken("malformed exp")
+		}
+		if now.After(exp.Add(a.skew)) {
+			return invalidToken("token is expired")
+		}
+	}
+	if v, ok := claims["nbf"]; ok {
+		nbf, ok := numericDate(v)
+		if !ok {
+			return invalidToken("malformed nbf")
+		}
+		if now.Add(a.skew).Before(nbf) {
+			return invalidToken("token is not valid yet")
+		}
+	}
+
+	if a.config.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.config.Issuer {
+			return invalidToken("unexpected issuer %q", iss)
+		}
+	}
+	if len(a.config.Audiences) > 0 && !matchAudience(claims["aud"], a.config.Audiences) {
+		return invalidToken("unexpected audience")
+	}
+	return nil
+}
+
+// MatchClaims claims 是否满足所有期望值
+// claim 为数组时包含期望值即可，为字符串时等于期望值或以空格分隔的值中包含期望值（如 scope）
+// claim 名称支持用 . 访问嵌套对象，如 realm_access.roles
+func MatchClaims(claims map[string]interface{}, want map[string]string) bool {
+	for name, expected := range want {
+		switch v := ClaimValue(claims, name).(type) {
+		case nil:
+			return false
+		case string:
+			if v != expected && !slices.Contains(strings.Fields(v), expected) {
+				return false
+			}
+		case []interface{}:
+			matched := false
+			for _, item := range v {
+				if formatClaim(item) == expected {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		default:
+			if formatClaim(v) != expected {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ClaimValue 获取 claim，支持用 . 访问嵌套对象
+func ClaimValue(claims map[string]interface{}, name string) interface{} {
+	if v, ok := claims[name]; ok {
+		return v
+	}
+	var current interface{} = claims
+	for _, segment := range strings.Split(name, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = obj[segment]
+	}
+	return current
+}
+
+// ClaimString 将 claim 转换为字符串，数组以逗号分隔，对象转换为 JSON
+func ClaimString(claims map[string]interface{}, name string) string {
+	v := ClaimValue(claims, name)
+	if items, ok := v.([]interface{}); ok {
+		values := make([]string, 0, len(items))
+		for _, item := range items {
+			values = append(values, formatClaim(item))
+		}
+		return strings.Join(values, ",")
+	}
+	return formatClaim(v)
+}
+
+func formatClaim(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// BearerToken 获取 Authorization 请求头中的 Bearer token
+func BearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+func invalidToken(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidToken, fmt.Sprintf(format, args...))
+}
+
+// decodeSegment 解码 base64url 编码的 JSON，数字保留为 json.Number
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func numericDate(v interface{}) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	sec := math.Floor(f)
+	return time.Unix(int64(sec), int64((f-sec)*float64(time.Second))), true
+}
+
+func matchAudience(aud interface{}, audiences []string) bool {
+	switch v := aud.(type) {
+	case string:
+		return slices.Contains(audiences, v)
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && slices.Contains(audiences, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,332 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+)
+
+var (
+	rsaKeysOnce sync.Once
+	rsaKeys     [2]*rsa.PrivateKey
+)
+
+// testRSAKey 测试共用的 RSA 私钥，避免每个测试重新生成
+func testRSAKey(t *testing.T, i int) *rsa.PrivateKey {
+	t.Helper()
+	rsaKeysOnce.Do(func() {
+		for i := range rsaKeys {
+			k, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				panic(err)
+			}
+			rsaKeys[i] = k
+		}
+	})
+	return rsaKeys[i]
+}
+
+// signToken 签发 token，signingKey 为 *rsa.PrivateKey（RS 算法）或 []byte（HS 算法）
+func signToken(t *testing.T, alg, kid string, claims map[string]interface{}, signingKey interface{}) string {
+	t.Helper()
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	if alg == "none" {
+		return signed + "."
+	}
+
+	hash := algorithms[alg].hash
+	var signature []byte
+	switch k := signingKey.(type) {
+	case *rsa.PrivateKey:
+		d := hash.New()
+		d.Write([]byte(signed))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, hash, d.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+	case []byte:
+		m := hmac.New(hash.New, k)
+		m.Write([]byte(signed))
+		signature = m.Sum(nil)
+	default:
+		t.Fatalf("unsupported signing key %T", signingKey)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// fakeJWKS 本地 JWKS 服务，记录拉取次数
+type fakeJWKS struct {
+	srv *httptest.Server
+
+	mu      sync.Mutex
+	keys    []map[string]string
+	fetches int
+}
+
+func newFakeJWKS(t *testing.T) *fakeJWKS {
+	t.Helper()
+	logger.Logger = zap.NewNop()
+	f := &fakeJWKS{}
+	f.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.fetches++
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": f.keys})
+	}))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// publish 替换 JWKS 中的 RSA 公钥，kids 与 keys 一一对应
+func (f *fakeJWKS) publish(kids []string, keys ...*rsa.PrivateKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = nil
+	for i, k := range keys {
+		f.keys = append(f.keys, map[string]string{
+			"kty": "RSA",
+			"kid": kids[i],
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		})
+	}
+}
+
+func (f *fakeJWKS) fetchCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetches
+}
+
+func newAuthenticator(t *testing.T, config model.JWTConfig) *JWTAuthenticator {
+	t.Helper()
+	a, err := NewJWTAuthenticator(config)
+	if err != nil {
+		t.Fatalf("NewJWTAuthenticator: %v", err)
+	}
+	return a
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func TestJWTJWKSKeyRotation(t *testing.T) {
+	jwks := newFakeJWKS(t)
+	jwks.publish([]string{"k1"}, testRSAKey(t, 0))
+	a := newAuthenticator(t, model.JWTConfig{JWKSURL: jwks.srv.URL})
+	ctx := context.Background()
+
+	if _, err := a.Verify(ctx, signToken(t, "RS256", "k1", validClaims(), testRSAKey(t, 0))); err != nil {
+		t.Fatalf("token signed with k1: %v", err)
+	}
+	if _, err := a.Verify(ctx, signToken(t, "RS256", "k1", validClaims(), testRSAKey(t, 0))); err != nil {
+		t.Fatalf("token signed with k1: %v", err)
+	}
+	if n := jwks.fetchCount(); n != 1 {
+		t.Fatalf("jwks fetched %d times, want 1", n)
+	}
+
+	// 密钥轮换：k1 被 k2 替换
+	jwks.publish([]string{"k2"}, testRSAKey(t, 1))
+	k2Token := signToken(t, "RS256", "k2", validClaims(), testRSAKey(t, 1))
+
+	// 距上次拉取不足 JWKSMinRefreshInterval，未知 kid 不会触发拉取，避免伪造的 kid 打满 JWKS 服务
+	if _, err := a.Verify(ctx, k2Token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want ErrInvalidToken before refresh is allowed", err)
+	}
+	if n := jwks.fetchCount(); n != 1 {
+		t.Fatalf("jwks fetched %d times within the min refresh interval, want 1", n)
+	}
+
+	// 超过最小间隔后，未知 kid 立即重新拉取
+	a.jwks.mu.Lock()
+	a.jwks.triedAt = time.Now().Add(-time.Hour)
+	a.jwks.mu.Unlock()
+	if _, err := a.Verify(ctx, k2Token); err != nil {
+		t.Fatalf("token signed with k2 after refresh: %v", err)
+	}
+	if n := jwks.fetchCount(); n != 2 {
+		t.Errorf("jwks fetched %d times, want 2", n)
+	}
+
+	// 已移除的 k1 不再有效
+	if _, err := a.Verify(ctx, signToken(t, "RS256", "k1", validClaims(), testRSAKey(t, 0))); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token signed with removed k1: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	jwks := newFakeJWKS(t)
+	jwks.publish([]string{"k1"}, testRSAKey(t, 0))
+	publicPEM, err := x509.MarshalPKIXPublicKey(&testRSAKey(t, 0).PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicPEM})
+
+	tests := []struct {
+		name       string
+		algorithms []string
+		token      string
+		wantErr    bool
+	}{
+		{name: "allowed algorithm", algorithms: []string{"RS256"}, token: signToken(t, "RS256", "k1", validClaims(), testRSAKey(t, 0))},
+		{name: "disallowed algorithm", algorithms: []string{"RS256"}, token: signToken(t, "RS384", "k1", validClaims(), testRSAKey(t, 0)), wantErr: true},
+		{name: "all algorithms by default", token: signToken(t, "RS384", "k1", validClaims(), testRSAKey(t, 0))},
+		{name: "none", token: signToken(t, "none", "k1", validClaims(), nil), wantErr: true},
+		// 算法混淆：使用 RSA 公钥作为 HMAC 密钥签名
+		{name: "hs256 with rsa public key", token: signToken(t, "HS256", "k1", validClaims(), publicPEM), wantErr: true},
+		{name: "hs256 with rsa modulus", token: signToken(t, "HS256", "k1", validClaims(), testRSAKey(t, 0).N.Bytes()), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthenticator(t, model.JWTConfig{JWKSURL: jwks.srv.URL, Algorithms: tt.algorithms})
+			_, err := a.Verify(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewJWTAuthenticator(model.JWTConfig{JWKSURL: jwks.srv.URL, Algorithms: []string{"none"}}); err == nil {
+		t.Error("algorithm none accepted in config")
+	}
+}
+
+func TestJWTTimeClaims(t *testing.T) {
+	secret := []byte("test-secret")
+	now := time.Now()
+	tests := []struct {
+		name    string
+		skew    time.Duration
+		claims  map[string]interface{}
+		wantErr bool
+	}{
+		{name: "no time claims", claims: map[string]interface{}{}},
+		{name: "not expired", claims: map[string]interface{}{"exp": now.Add(time.Minute).Unix()}},
+		{name: "expired within default skew", claims: map[string]interface{}{"exp": now.Add(-10 * time.Second).Unix()}},
+		{name: "expired beyond default skew", claims: map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}, wantErr: true},
+		{name: "expired beyond configured skew", skew: 5 * time.Second, claims: map[string]interface{}{"exp": now.Add(-10 * time.Second).Unix()}, wantErr: true},
+		{name: "nbf within default skew", claims: map[string]interface{}{"nbf": now.Add(10 * time.Second).Unix()}},
+		{name: "nbf beyond default skew", claims: map[string]interface{}{"nbf": now.Add(time.Minute).Unix()}, wantErr: true},
+		{name: "nbf beyond configured skew", skew: 5 * time.Second, claims: map[string]interface{}{"nbf": now.Add(10 * time.Second).Unix()}, wantErr: true},
+		{name: "fractional exp", claims: map[string]interface{}{"exp": float64(now.Add(time.Minute).UnixMilli()) / 1000}},
+		{name: "malformed exp", claims: map[string]interface{}{"exp": "tomorrow"}, wantErr: true},
+		{name: "malformed nbf", claims: map[string]interface{}{"nbf": true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthenticator(t, model.JWTConfig{
+				Keys:      []model.JWTKeyConfig{{Secret: string(secret)}},
+				ClockSkew: tt.skew,
+			})
+			_, err := a.Verify(context.Background(), signToken(t, "HS256", "", tt.claims, secret))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWTIssuerAudience(t *testing.T) {
+	secret := []byte("test-secret")
+	a := newAuthenticator(t, model.JWTConfig{
+		Issuer:    "https://issuer.example",
+		Audiences: []string{"orders", "payments"},
+		Keys:      []model.JWTKeyConfig{{Secret: string(secret)}},
+	})
+
+	tests := []struct {
+		name    string
+		claims  map[string]interface{}
+		wantErr bool
+	}{
+		{name: "string audience", claims: map[string]interface{}{"iss": "https://issuer.example", "aud": "orders"}},
+		{name: "audience list", claims: map[string]interface{}{"iss": "https://issuer.example", "aud": []string{"web", "payments"}}},
+		{name: "wrong issuer", claims: map[string]interface{}{"iss": "https://other.example", "aud": "orders"}, wantErr: true},
+		{name: "missing issuer", claims: map[string]interface{}{"aud": "orders"}, wantErr: true},
+		{name: "wrong audience", claims: map[string]interface{}{"iss": "https://issuer.example", "aud": "web"}, wantErr: true},
+		{name: "audience list without match", claims: map[string]interface{}{"iss": "https://issuer.example", "aud": []string{"web"}}, wantErr: true},
+		{name: "missing audience", claims: map[string]interface{}{"iss": "https://issuer.example"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.Verify(context.Background(), signToken(t, "HS256", "", tt.claims, secret))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchClaims(t *testing.T) {
+	secret := []byte("test-secret")
+	a := newAuthenticator(t, model.JWTConfig{Keys: []model.JWTKeyConfig{{Secret: string(secret)}}})
+	// 通过 Verify 解码，数字为 json.Number，与运行时一致
+	claims, err := a.Verify(context.Background(), signToken(t, "HS256", "", map[string]interface{}{
+		"sub":          "alice",
+		"scope":        "orders:read orders:write",
+		"groups":       []string{"dev", "ops"},
+		"tier":         2,
+		"admin":        false,
+		"realm_access": map[string]interface{}{"roles": []string{"viewer"}},
+	}, secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want map[string]string
+		ok   bool
+	}{
+		{name: "empty", want: nil, ok: true},
+		{name: "string", want: map[string]string{"sub": "alice"}, ok: true},
+		{name: "space separated", want: map[string]string{"scope": "orders:write"}, ok: true},
+		{name: "array", want: map[string]string{"groups": "ops"}, ok: true},
+		{name: "number", want: map[string]string{"tier": "2"}, ok: true},
+		{name: "bool", want: map[string]string{"admin": "false"}, ok: true},
+		{name: "nested", want: map[string]string{"realm_access.roles": "viewer"}, ok: true},
+		{name: "all must match", want: map[string]string{"sub": "alice", "groups": "qa"}, ok: false},
+		{name: "substring", want: map[string]string{"scope": "orders"}, ok: false},
+		{name: "missing", want: map[string]string{"email": "alice@example.com"}, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchClaims(claims, tt.want); got != tt.ok {
+				t.Errorf("MatchClaims = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// 签名密钥及签名校验
+// 算法与密钥类型必须一致（RS 使用 RSA 公钥、ES 使用对应曲线的 EC 公钥、HS 使用共享密钥），避免算法混淆攻击
+
+var errSignature = errors.New("signature verification failed")
+
+// key 签名密钥
+type key struct {
+	kid    string
+	alg    string      // JWK 中声明的算法，为空则不限制
+	public interface{} // *rsa.PublicKey、*ecdsa.PublicKey 或 []byte（HS 共享密钥）
+}
+
+// algorithm JWT 签名算法
+type algorithm struct {
+	family string // RS、ES、HS
+	hash   crypto.Hash
+	curve  elliptic.Curve // ES 算法对应的曲线
+}
+
+var algorithms = map[string]algorithm{
+	"RS256": {family: "RS", hash: crypto.SHA256},
+	"RS384": {family: "RS", hash: crypto.SHA384},
+	"RS512": {family: "RS", hash: crypto.SHA512},
+	"ES256": {family: "ES", hash: crypto.SHA256, curve: elliptic.P256()},
+	"ES384": {family: "ES", hash: crypto.SHA384, curve: elliptic.P384()},
+	"ES512": {family: "ES", hash: crypto.SHA512, curve: elliptic.P521()},
+	"HS256": {family: "HS", hash: crypto.SHA256},
+	"HS384": {family: "HS", hash: crypto.SHA384},
+	"HS512": {family: "HS", hash: crypto.SHA512},
+}
+
+// supports 密钥是否可以用于校验 alg 算法的签名
+func (k *key) supports(alg string) bool {
+	a, ok := algorithms[alg]
+	if !ok || (k.alg != "" && k.alg != alg) {
+		return false
+	}
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		return a.family == "RS"
+	case *ecdsa.PublicKey:
+		return a.family == "ES" && pub.Curve == a.curve
+	case []byte:
+		return a.family == "HS"
+	}
+	return false
+}
+
+// verify 校验签名，调用前需要通过 supports 确认密钥与算法匹配
+func (k *key) verify(alg string, signed, signature []byte) error {
+	a := algorithms[alg]
+	h := a.hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(pub, a.hash, digest, signature) != nil {
+			return errSignature
+		}
+	case *ecdsa.PublicKey:
+		// JWS 中的 ECDSA 签名为定长的 r||s
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errSignature
+		}
+	case []byte:
+		mac := hmac.New(a.hash.New, pub)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errSignature
+		}
+	default:
+		return errSignature
+	}
+	return nil
+}
+
+// loadPublicKeyFile 加载 PEM 格式的公钥（PKIX、PKCS1）或证书
+func loadPublicKeyFile(file string) (interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("load public key %s failed: %w", file, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("load public key %s failed: no PEM data found", file)
+	}
+
+	var pub interface{}
+	switch block.Type {
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			pub = cert.PublicKey
+		}
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse public key %s failed: %w", file, err)
+	}
+
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T in %s", pub, file)
+	}
+}
+
+// jwk JSON Web Key（RFC 7517），只解析签名校验需要的字段
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// parseJWK 将 JWK 转换为签名密钥
+func parseJWK(j jwk) (*key, error) {
+	k := &key{kid: j.Kid, alg: j.Alg}
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+		k.public = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		curve, ok := curves[j.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid ec point")
+		}
+		k.public = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(j.K)
+		if err != nil || len(secret) == 0 {
+			return nil, errors.New("invalid oct key")
+		}
+		k.public = secret
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+	return k, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
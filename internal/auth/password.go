@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 凭证哈希校验，支持 bcrypt 和 argon2（PHC 格式：$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>）
+
+var errUnknownHash = errors.New("unknown hash format, must be bcrypt ($2a$, $2b$, $2y$) or argon2 ($argon2id$, $argon2i$)")
+
+// 用户名或 key_id 不存在时使用的哈希，使不存在的凭证与密码错误的耗时一致
+const dummyHash = "$2a$10$VZJqZrNRXtshAHVRKgGxE.dzWaGOqQnnPZEtoM1sXjM3BTYmuOykm"
+
+// passwordHash 解析后的哈希
+type passwordHash struct {
+	bcrypt []byte
+	argon  *argon2Hash
+}
+
+type argon2Hash struct {
+	variant string // argon2id、argon2i
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseHash 解析 bcrypt 或 argon2 哈希
+func parseHash(hash string) (*passwordHash, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("invalid bcrypt hash: %w", err)
+		}
+		return &passwordHash{bcrypt: []byte(hash)}, nil
+	case strings.HasPrefix(hash, "$argon2id$"), strings.HasPrefix(hash, "$argon2i$"):
+		h, err := parseArgon2(hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid argon2 hash: %w", err)
+		}
+		return &passwordHash{argon: h}, nil
+	default:
+		return nil, errUnknownHash
+	}
+}
+
+func parseArgon2(hash string) (*argon2Hash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, errors.New("malformed hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported version %q", parts[2])
+	}
+	h := &argon2Hash{variant: parts[1]}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, fmt.Errorf("malformed parameters %q", parts[3])
+	}
+	if h.time == 0 || h.threads == 0 {
+		return nil, fmt.Errorf("malformed parameters %q", parts[3])
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, errors.New("malformed salt")
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, errors.New("malformed hash")
+	}
+	return h, nil
+}
+
+// verify 比较密码与哈希
+func (h *passwordHash) verify(password string) bool {
+	if h.bcrypt != nil {
+		return bcrypt.CompareHashAndPassword(h.bcrypt, []byte(password)) == nil
+	}
+
+	a := h.argon
+	var key []byte
+	if a.variant == "argon2i" {
+		key = argon2.Key([]byte(password), a.salt, a.time, a.memory, a.threads, uint32(len(a.key)))
+	} else {
+		key = argon2.IDKey([]byte(password), a.salt, a.time, a.memory, a.threads, uint32(len(a.key)))
+	}
+	return subtle.ConstantTimeCompare(key, a.key) == 1
+}
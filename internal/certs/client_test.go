@@ -0,0 +1,218 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// testCA 测试使用的 CA，签发服务端和客户端证书
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, dir: t.TempDir()}
+}
+
+// issue 签发证书，返回 tls.Certificate 和 PEM 文件路径
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (tls.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEM(t, ca.dir, name+".pem", "CERTIFICATE", der)
+	keyFile := writePEM(t, ca.dir, name+"-key.pem", "PRIVATE KEY", keyDER)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, certFile, keyFile
+}
+
+func (ca *testCA) file(t *testing.T) string {
+	t.Helper()
+	return writePEM(t, ca.dir, "ca.pem", "CERTIFICATE", ca.cert.Raw)
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// newTLSServer 启动使用指定证书的 HTTPS 服务，响应客户端证书的 CN
+func newTLSServer(t *testing.T, cert tls.Certificate, clientCAs *x509.CertPool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // 握手失败是预期的
+	if clientCAs != nil {
+		srv.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+		srv.TLS.ClientCAs = clientCAs
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// get 使用上游 TLS 配置请求服务，返回响应内容
+func get(t *testing.T, srv *httptest.Server, config *model.UpstreamTLSConfig) (string, error) {
+	t.Helper()
+	tlsConfig, err := ClientTLSConfig(config)
+	if err != nil {
+		t.Fatalf("ClientTLSConfig: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var body [256]byte
+	n, _ := resp.Body.Read(body[:])
+	return string(body[:n]), nil
+}
+
+func TestClientTLSConfigCustomCA(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, _, _ := ca.issue(t, "upstream.internal", x509.ExtKeyUsageServerAuth)
+	srv := newTLSServer(t, serverCert, nil)
+
+	tests := []struct {
+		name    string
+		config  model.UpstreamTLSConfig
+		wantErr bool
+	}{
+		{name: "custom ca and server name", config: model.UpstreamTLSConfig{CAFile: ca.file(t), ServerName: "upstream.internal"}},
+		// 证书不包含 127.0.0.1，需要通过 server_name 指定校验的域名
+		{name: "missing server name", config: model.UpstreamTLSConfig{CAFile: ca.file(t)}, wantErr: true},
+		{name: "wrong server name", config: model.UpstreamTLSConfig{CAFile: ca.file(t), ServerName: "other.internal"}, wantErr: true},
+		{name: "system ca", config: model.UpstreamTLSConfig{ServerName: "upstream.internal"}, wantErr: true},
+		{name: "insecure skip verify", config: model.UpstreamTLSConfig{InsecureSkipVerify: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := get(t, srv, &tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientTLSConfigClientCert(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, _, _ := ca.issue(t, "upstream.internal", x509.ExtKeyUsageServerAuth)
+	_, certFile, keyFile := ca.issue(t, "gateway", x509.ExtKeyUsageClientAuth)
+	srv := newTLSServer(t, serverCert, ca.pool())
+
+	config := &model.UpstreamTLSConfig{CAFile: ca.file(t), ServerName: "upstream.internal"}
+	if _, err := get(t, srv, config); err == nil {
+		t.Error("request without client certificate succeeded")
+	}
+
+	config.CertFile = certFile
+	config.KeyFile = keyFile
+	body, err := get(t, srv, config)
+	if err != nil {
+		t.Fatalf("request with client certificate: %v", err)
+	}
+	if body != "gateway" {
+		t.Errorf("upstream saw client certificate %q, want gateway", body)
+	}
+}
+
+func TestClientTLSConfigInvalid(t *testing.T) {
+	ca := newTestCA(t)
+	_, certFile, keyFile := ca.issue(t, "gateway", x509.ExtKeyUsageClientAuth)
+	notPEM := filepath.Join(ca.dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config model.UpstreamTLSConfig
+	}{
+		{name: "cert without key", config: model.UpstreamTLSConfig{CertFile: certFile}},
+		{name: "key without cert", config: model.UpstreamTLSConfig{KeyFile: keyFile}},
+		{name: "missing ca file", config: model.UpstreamTLSConfig{CAFile: filepath.Join(ca.dir, "missing.pem")}},
+		{name: "ca file without certificate", config: model.UpstreamTLSConfig{CAFile: notPEM}},
+		{name: "mismatched key", config: model.UpstreamTLSConfig{CertFile: certFile, KeyFile: ca.file(t)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ClientTLSConfig(&tt.config); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
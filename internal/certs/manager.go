@@ -0,0 +1,393 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+)
+
+// 证书管理
+// 1. 根据 ClientHello 中的 SNI 选择证书，支持通配符证书，未匹配时使用第一个证书
+// 2. 监听证书文件所在目录，文件变化时重新加载，加载失败时继续使用旧证书
+// 3. 配置了客户端 CA 时校验客户端证书，CA 文件同样支持热加载
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+type Manager struct {
+	mu       sync.RWMutex
+	configs  []model.CertificateConfig
+	certs    []*tls.Certificate
+	names    map[string]*tls.Certificate // 证书中的域名（含通配符） -> 证书
+	clientCA string                      // 客户端 CA 文件
+	caPool   *x509.CertPool              // 校验客户端证书的 CA
+	debounce time.Duration
+	update   chan struct{} // 证书列表变化，需要重新监听目录
+}
+
+func NewManager(configs []model.CertificateConfig) (*Manager, error) {
+	m := &Manager{
+		debounce: time.Second,
+		update:   make(chan struct{}, 1),
+	}
+	if err := m.Update(configs); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Update 替换证书列表并立即加载
+func (m *Manager) Update(configs []model.CertificateConfig) error {
+	c, err := m.Prepare(configs, "")
+	if err != nil {
+		return err
+	}
+	m.Apply(c)
+	return nil
+}
+
+// SetClientCA 替换校验客户端证书的 CA 文件并立即加载
+func (m *Manager) SetClientCA(file string) error {
+	pool, err := LoadCertPool(file)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.clientCA = file
+	m.caPool = pool
+	m.mu.Unlock()
+
+	m.notify()
+	return nil
+}
+
+// Certificates 已加载但尚未生效的证书列表和客户端 CA，由 Apply 替换
+type Certificates struct {
+	configs  []model.CertificateConfig
+	certs    []*tls.Certificate
+	names    map[string]*tls.Certificate
+	clientCA string
+	caPool   *x509.CertPool
+}
+
+// Prepare 加载证书列表和客户端 CA（为空则保留当前的 CA），不影响正在使用的证书
+// 配置热更新时与路由等其他配置一起加载成功后再调用 Apply
+func (m *Manager) Prepare(configs []model.CertificateConfig, clientCA string) (*Certificates, error) {
+	certs, names, err := load(configs)
+	if err != nil {
+		return nil, err
+	}
+	c := &Certificates{configs: configs, certs: certs, names: names, clientCA: clientCA}
+	if clientCA != "" {
+		if c.caPool, err = LoadCertPool(clientCA); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Apply 替换为 Prepare 加载的证书列表和客户端 CA
+func (m *Manager) Apply(c *Certificates) {
+	m.mu.Lock()
+	m.configs = c.configs
+	m.certs = c.certs
+	m.names = c.names
+	if c.clientCA != "" {
+		m.clientCA = c.clientCA
+		m.caPool = c.caPool
+	}
+	m.mu.Unlock()
+
+	m.notify()
+}
+
+// notify 通知 Watch 重新监听证书文件所在的目录
+func (m *Manager) notify() {
+	select {
+	case m.update <- struct{}{}:
+	default:
+	}
+}
+
+// Reload 重新加载当前的证书文件
+func (m *Manager) Reload() error {
+	m.mu.RLock()
+	configs := m.configs
+	clientCA := m.clientCA
+	m.mu.RUnlock()
+
+	certs, names, err := load(configs)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if clientCA != "" {
+		if pool, err = LoadCertPool(clientCA); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	m.certs = certs
+	m.names = names
+	if pool != nil {
+		m.caPool = pool
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// GetCertificate 根据 SNI 选择证书，用于 tls.Config.GetCertificate
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.certs) == 0 {
+		return nil, errors.New("no certificate available")
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if cert, ok := m.names[name]; ok {
+			return cert, nil
+		}
+		// 通配符只匹配一级子域名
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			if cert, ok := m.names["*"+name[i:]]; ok {
+				return cert, nil
+			}
+		}
+	}
+	return m.certs[0], nil
+}
+
+// Watch 监听证书文件变化并重新加载，直到 ctx 结束
+func (m *Manager) Watch(ctx context.Context) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Logger.Error("certificate watcher create failed", zap.Error(err))
+		return
+	}
+
+	go func() {
+		defer w.Close()
+
+		files := m.watch(w, nil)
+
+		// 去抖动：证书和私钥通常先后写入，等待一段时间再加载
+		timer := time.NewTimer(m.debounce)
+		timer.Stop()
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.update:
+				files = m.watch(w, files)
+			case event, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				// 兼容 Kubernetes Secret 等通过符号链接原子替换的方式，目录内任意变化都重新加载
+				if files[event.Name] || event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+					timer.Reset(m.debounce)
+				}
+			case <-timer.C:
+				if err := m.Reload(); err != nil {
+					logger.Logger.Error("certificate reload failed, keep using the old certificates", zap.Error(err))
+					continue
+				}
+				logger.Logger.Info("certificates reloaded")
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				logger.Logger.Warn("certificate watcher error", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// watch 监听当前证书文件所在的目录，返回需要关注的文件
+func (m *Manager) watch(w *fsnotify.Watcher, old map[string]bool) map[string]bool {
+	m.mu.RLock()
+	configs := m.configs
+	clientCA := m.clientCA
+	m.mu.RUnlock()
+
+	watched := make([]string, 0, 2*len(configs)+1)
+	for _, c := range configs {
+		watched = append(watched, c.CertFile, c.KeyFile)
+	}
+	if clientCA != "" {
+		watched = append(watched, clientCA)
+	}
+
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, file := range watched {
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
+		}
+		files[file] = true
+		dirs[filepath.Dir(file)] = true
+	}
+
+	for file := range old {
+		if dir := filepath.Dir(file); !dirs[dir] {
+			_ = w.Remove(dir)
+		}
+	}
+	for dir := range dirs {
+		if err := w.Add(dir); err != nil {
+			logger.Logger.Warn("certificate watch failed", zap.String("dir", dir), zap.Error(err))
+		}
+	}
+	return files
+}
+
+// load 加载所有证书，并建立域名索引（先配置的证书优先）
+func load(configs []model.CertificateConfig) ([]*tls.Certificate, map[string]*tls.Certificate, error) {
+	certs := make([]*tls.Certificate, 0, len(configs))
+	names := make(map[string]*tls.Certificate)
+	for _, c := range configs {
+		cert, err := LoadCertificate(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		certs = append(certs, cert)
+
+		for _, name := range certificateNames(cert.Leaf) {
+			if _, ok := names[name]; !ok {
+				names[name] = cert
+			}
+		}
+	}
+	return certs, names, nil
+}
+
+// LoadCertificate 加载证书和私钥
+func LoadCertificate(c model.CertificateConfig) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load certificate %s failed: %w", c.CertFile, err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("parse certificate %s failed: %w", c.CertFile, err)
+		}
+	}
+	return &cert, nil
+}
+
+func certificateNames(leaf *x509.Certificate) []string {
+	names := make([]string, 0, len(leaf.DNSNames)+1)
+	for _, name := range leaf.DNSNames {
+		names = append(names, strings.ToLower(name))
+	}
+	// 没有 SAN 的旧证书使用 CN
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = append(names, strings.ToLower(leaf.Subject.CommonName))
+	}
+	return names
+}
+
+// TLSConfig 根据配置创建 tls.Config，证书通过 GetCertificate 动态获取
+func (m *Manager) TLSConfig(config *model.TLSConfig) (*tls.Config, error) {
+	minVersion, err := ParseVersion(config.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := ParseCipherSuites(config.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	alpn := config.ALPN
+	if len(alpn) == 0 {
+		alpn = []string{constants.ALPNHTTP2, constants.ALPNHTTP11}
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		NextProtos:     alpn,
+		GetCertificate: m.GetCertificate,
+	}
+
+	// 客户端证书是否必须由路由决定，握手时只校验客户端提供的证书
+	if config.ClientCAFile != "" {
+		if err := m.SetClientCA(config.ClientCAFile); err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c := tlsConfig.Clone()
+			c.GetConfigForClient = nil
+			c.ClientCAs = m.clientCAs()
+			return c, nil
+		}
+	}
+	return tlsConfig, nil
+}
+
+func (m *Manager) clientCAs() *x509.CertPool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.caPool
+}
+
+// ParseVersion 解析 TLS 版本，为空时使用默认值
+func ParseVersion(version string) (uint16, error) {
+	if version == "" {
+		version = constants.DefaultTLSMinVersion
+	}
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unknown tls version %q, must be one of 1.0, 1.1, 1.2, 1.3", version)
+	}
+	return v, nil
+}
+
+// ParseCipherSuites 根据名称解析加密套件，如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
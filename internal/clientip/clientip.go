@@ -0,0 +1,117 @@
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// 客户端真实 IP
+// 只有直接连接的地址属于可信代理（trusted_proxies）时才使用 X-Forwarded-For：
+// 从右向左跳过可信代理，第一个不可信的地址即为客户端 IP，全部可信时使用最左边的地址
+// 未配置可信代理时忽略 X-Forwarded-For 和 X-Real-IP，避免客户端伪造
+
+var trustedProxies atomic.Pointer[PrefixSet]
+
+// SetTrustedProxies 更新全局可信代理列表
+func SetTrustedProxies(cidrs []string) error {
+	set, err := NewPrefixSet(cidrs)
+	if err != nil {
+		return err
+	}
+	SetTrustedProxySet(set)
+	return nil
+}
+
+// SetTrustedProxySet 使用已解析的集合更新全局可信代理列表
+func SetTrustedProxySet(set *PrefixSet) {
+	trustedProxies.Store(set)
+}
+
+// FromRequest 获取请求的客户端 IP，无法解析时返回空字符串
+func FromRequest(r *http.Request) string {
+	addr := Resolve(r)
+	if !addr.IsValid() {
+		return ""
+	}
+	return addr.String()
+}
+
+// Resolve 解析请求的客户端 IP
+func Resolve(r *http.Request) netip.Addr {
+	remote := remoteAddr(r)
+	trusted := trustedProxies.Load()
+	if !trusted.Contains(remote) {
+		return remote
+	}
+
+	hops := forwardedFor(r)
+	if len(hops) == 0 {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return addr.Unmap()
+		}
+		return remote
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := parseHop(hops[i])
+		if err != nil {
+			// 无法解析的地址之前的内容都不可信，使用最后一个可信代理
+			return client
+		}
+		client = addr
+		if !trusted.Contains(addr) {
+			return addr
+		}
+	}
+	return client
+}
+
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// forwardedFor 合并所有 X-Forwarded-For 请求头，按逗号拆分
+func forwardedFor(r *http.Request) []string {
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+// parseHop 解析 X-Forwarded-For 中的地址，兼容带端口的写法（1.2.3.4:80、[::1]:80）
+func parseHop(hop string) (netip.Addr, error) {
+	if addr, err := netip.ParseAddr(hop); err == nil {
+		return addr.Unmap(), nil
+	}
+	addrPort, err := netip.ParseAddrPort(hop)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addrPort.Addr().Unmap(), nil
+}
+
+// IsLoopbackHost 监听地址的主机部分是否只接受本机连接（为空表示监听所有地址）
+func IsLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
@@ -0,0 +1,120 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+// useTrustedProxies 设置全局可信代理，测试结束后恢复为未配置
+func useTrustedProxies(t *testing.T, cidrs ...string) {
+	t.Helper()
+	if err := SetTrustedProxies(cidrs); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetTrustedProxySet(nil) })
+}
+
+func TestResolve(t *testing.T) {
+	useTrustedProxies(t, "10.0.0.0/8", "2001:db8::/32")
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		realIP string
+		want   string
+	}{
+		{name: "direct client", remote: "203.0.113.5:1234", want: "203.0.113.5"},
+		// 直接连接的地址不可信时忽略客户端伪造的请求头
+		{name: "untrusted remote ignores xff", remote: "203.0.113.5:1234", xff: []string{"198.51.100.1"}, want: "203.0.113.5"},
+		{name: "untrusted remote ignores x-real-ip", remote: "203.0.113.5:1234", realIP: "198.51.100.1", want: "203.0.113.5"},
+		{name: "trusted proxy", remote: "10.0.0.1:1234", xff: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		// 从右向左跳过可信代理，客户端在最左边伪造的地址被忽略
+		{name: "proxy chain", remote: "10.0.0.1:1234", xff: []string{"1.1.1.1, 198.51.100.1, 10.0.0.2"}, want: "198.51.100.1"},
+		{name: "multiple headers", remote: "10.0.0.1:1234", xff: []string{"1.1.1.1", "198.51.100.1", "10.0.0.2"}, want: "198.51.100.1"},
+		{name: "all trusted", remote: "10.0.0.1:1234", xff: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "hop with port", remote: "10.0.0.1:1234", xff: []string{"198.51.100.1:443"}, want: "198.51.100.1"},
+		{name: "ipv6 hop with port", remote: "10.0.0.1:1234", xff: []string{"[2001:db9::1]:443"}, want: "2001:db9::1"},
+		{name: "ipv6 trusted proxy", remote: "[2001:db8::1]:1234", xff: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "ipv4-mapped remote", remote: "[::ffff:10.0.0.1]:1234", xff: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		// 无法解析的地址之前的内容不可信，使用最后一个可信代理
+		{name: "invalid hop", remote: "10.0.0.1:1234", xff: []string{"198.51.100.1, unknown, 10.0.0.2"}, want: "10.0.0.2"},
+		{name: "invalid last hop", remote: "10.0.0.1:1234", xff: []string{"198.51.100.1, unknown"}, want: "10.0.0.1"},
+		{name: "x-real-ip", remote: "10.0.0.1:1234", realIP: "198.51.100.1", want: "198.51.100.1"},
+		{name: "xff preferred over x-real-ip", remote: "10.0.0.1:1234", xff: []string{"198.51.100.1"}, realIP: "198.51.100.2", want: "198.51.100.1"},
+		{name: "invalid x-real-ip", remote: "10.0.0.1:1234", realIP: "unknown", want: "10.0.0.1"},
+		{name: "invalid remote", remote: "pipe", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := FromRequest(r); got != tt.want {
+				t.Errorf("FromRequest = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveWithoutTrustedProxies(t *testing.T) {
+	SetTrustedProxySet(nil)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	r.Header.Set("X-Real-IP", "198.51.100.2")
+	if got := FromRequest(r); got != "127.0.0.1" {
+		t.Errorf("FromRequest = %q, want the remote address", got)
+	}
+}
+
+func TestPrefixSet(t *testing.T) {
+	set, err := NewPrefixSet([]string{"192.168.1.0/24", "10.1.2.3", "10.0.0.0/8", "2001:db8::/48", " 172.16.0.0/12 ", "192.168.1.128/25"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "192.168.1.1", want: true},
+		{addr: "192.168.1.255", want: true},
+		{addr: "192.168.2.1", want: false},
+		{addr: "10.1.2.3", want: true},
+		{addr: "10.255.0.1", want: true},
+		{addr: "11.0.0.1", want: false},
+		{addr: "172.31.255.255", want: true},
+		{addr: "172.32.0.1", want: false},
+		{addr: "2001:db8::1", want: true},
+		{addr: "2001:db8:1::1", want: false},
+		// IPv4-mapped IPv6 地址与 IPv4 地址等价
+		{addr: "::ffff:10.0.0.1", want: true},
+		// IPv4 前缀不匹配同样位模式的 IPv6 地址
+		{addr: "a00::1", want: false},
+	}
+	for _, tt := range tests {
+		if got := set.Contains(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("Contains(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+
+	if set.Contains(netip.Addr{}) {
+		t.Error("invalid address matched")
+	}
+	var empty *PrefixSet
+	if empty.Contains(netip.MustParseAddr("10.0.0.1")) {
+		t.Error("nil set matched")
+	}
+	for _, cidr := range []string{"10.0.0.0/33", "10.0.0", "example.com"} {
+		if _, err := NewPrefixSet([]string{cidr}); err == nil {
+			t.Errorf("NewPrefixSet(%q) succeeded", cidr)
+		}
+	}
+}
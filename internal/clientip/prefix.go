@@ -0,0 +1,105 @@
+package clientip
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// CIDR 前缀集合
+// 使用二叉前缀树保存，IPv4 地址转换为 IPv4-mapped IPv6 地址后与 IPv6 共用一棵树
+// 节点保存在切片中并用下标引用子节点，查找最多比较 128 位，与前缀数量无关
+
+// PrefixSet 不可变的 CIDR 集合，创建后可并发查询
+type PrefixSet struct {
+	nodes []prefixNode // nodes[0] 为根节点
+}
+
+type prefixNode struct {
+	children [2]int32 // 子节点下标，0 表示不存在（根节点不会是子节点）
+	terminal bool     // 是否为某个前缀的结尾
+}
+
+// NewPrefixSet 根据 CIDR 列表创建集合，单个 IP 地址视为 /32 或 /128
+func NewPrefixSet(cidrs []string) (*PrefixSet, error) {
+	s := &PrefixSet{nodes: make([]prefixNode, 1)}
+	for _, cidr := range cidrs {
+		prefix, err := ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		s.insert(prefix)
+	}
+	return s, nil
+}
+
+// ParsePrefix 解析 CIDR 或 IP 地址
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid ip or cidr %q", s)
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid ip or cidr %q", s)
+	}
+	return prefix.Masked(), nil
+}
+
+// Contains 地址是否属于集合中的某个前缀，集合为 nil 时返回 false
+func (s *PrefixSet) Contains(addr netip.Addr) bool {
+	if s == nil || !addr.IsValid() {
+		return false
+	}
+	bits := addr.As16() // IPv4 地址返回 IPv4-mapped 形式
+
+	n := &s.nodes[0]
+	for i := 0; ; i++ {
+		if n.terminal {
+			return true
+		}
+		if i == 128 {
+			return false
+		}
+		next := n.children[bit(bits, i)]
+		if next == 0 {
+			return false
+		}
+		n = &s.nodes[next]
+	}
+}
+
+func (s *PrefixSet) insert(prefix netip.Prefix) {
+	bits := prefix.Addr().As16()
+	length := prefix.Bits()
+	if prefix.Addr().Is4() {
+		length += 96
+	}
+
+	idx := int32(0)
+	for i := 0; i < length; i++ {
+		// 已经存在更短的前缀，无需再插入
+		if s.nodes[idx].terminal {
+			return
+		}
+		b := bit(bits, i)
+		next := s.nodes[idx].children[b]
+		if next == 0 {
+			s.nodes = append(s.nodes, prefixNode{})
+			next = int32(len(s.nodes) - 1)
+			s.nodes[idx].children[b] = next
+		}
+		idx = next
+	}
+	// 更长的前缀被当前前缀覆盖，丢弃子节点（节点本身仍保留在切片中）
+	s.nodes[idx].terminal = true
+	s.nodes[idx].children = [2]int32{}
+}
+
+func bit(bits [16]byte, i int) int {
+	return int(bits[i/8]>>(7-i%8)) & 1
+}
@@ -1,48 +1,62 @@
 package config
 
 import (
+	"github.com/lccxxo/bailuoli/internal/constants"
 	"github.com/lccxxo/bailuoli/internal/model"
 	"gopkg.in/yaml.v3"
 	"os"
+	"reflect"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
 )
 
 // Load 加载配置（配置文件 + 环境变量） 环境变量 > 配置文件
+// 环境变量覆盖后再校验，错误行号指向配置文件中的位置（由环境变量设置的字段同样指向文件中的对应字段或其父节点）
 func Load(path string) (*model.Config, error) {
-	cfg, err := loadFromFile(path)
+	cfg, root, err := loadFromFile(path)
 	if err != nil {
 		return nil, err
 	}
 
 	// 环境变量覆盖
+	tls := cfg.Server.TLS
 	if err := envconfig.Process("gateway", cfg); err != nil {
 		return nil, err
 	}
+	// envconfig 会为 nil 的结构体指针分配零值，环境变量未设置 TLS 字段时保持不启用
+	if tls == nil && reflect.DeepEqual(cfg.Server.TLS, &model.TLSConfig{}) {
+		cfg.Server.TLS = nil
+	}
+
+	setDefaults(cfg)
+
+	if err := Validate(cfg); err != nil {
+		return nil, resolveLines(err, root)
+	}
 
 	return cfg, nil
 }
 
-func loadFromFile(path string) (*model.Config, error) {
+// loadFromFile 解析配置文件，同时返回节点树用于定位错误行号
+func loadFromFile(path string) (*model.Config, *yaml.Node, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var cfg model.Config
 	err = yaml.Unmarshal(data, &cfg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	setDefaults(&cfg)
-
-	if err := validate(&cfg); err != nil {
-		return nil, err
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, nil, err
 	}
 
-	return &cfg, nil
+	return &cfg, &root, nil
 }
 
 // 设置默认值
@@ -53,10 +67,19 @@ func setDefaults(cfg *model.Config) {
 	if cfg.Server.ShutdownTimeout == 0 {
 		cfg.Server.ShutdownTimeout = 30 * time.Second
 	}
-}
-
-func validate(cfg *model.Config) error {
-	// todo 验证配置文件字段的合法性
+	if cfg.Server.ReadTimeout == 0 {
+		cfg.Server.ReadTimeout = constants.DefaultReadTimeout
+	}
+	if cfg.Server.WriteTimeout == 0 {
+		cfg.Server.WriteTimeout = constants.DefaultWriteTimeout
+	}
 
-	return nil
+	for _, route := range cfg.Routes {
+		if route == nil {
+			continue
+		}
+		if route.LoadBalance.Strategy == "" {
+			route.LoadBalance.Strategy = constants.DefaultLoadBalance
+		}
+	}
 }
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lccxxo/bailuoli/internal/validator"
+	"gopkg.in/yaml.v3"
+)
+
+const validConfig = `server:
+  addr: ":8080"
+routes:
+  - name: orders
+    path: /orders
+    match_type: prefix
+    upstreams:
+      - host: http://127.0.0.1:8081
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "gateway.yaml")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// loadErrors 加载配置并按路径返回错误所在行号
+func loadErrors(t *testing.T, content string) map[string]int {
+	t.Helper()
+	_, err := Load(writeConfig(t, content))
+	if err == nil {
+		return nil
+	}
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v, want ValidationErrors", err)
+	}
+	lines := make(map[string]int, len(errs))
+	for _, e := range errs {
+		lines[e.Path] = e.Line
+	}
+	return lines
+}
+
+func TestLoadValidationErrors(t *testing.T) {
+	// 一次返回所有错误，路径指向出错字段，字段不存在时行号指向最近的父节点
+	lines := loadErrors(t, `server:
+  addr: ":8080"
+  admin_addr: "0.0.0.0:9090"
+  trusted_proxies:
+    - 10.0.0.0/8
+    - not-a-cidr
+log:
+  level: verbose
+redis:
+  db: -1
+routes:
+  - name: orders
+    path: /orders
+    match_type: prefix
+    upstreams:
+      - host: http://127.0.0.1:8081
+    rate_limits:
+      - rate: 10
+        backend: redis
+  - name: orders
+    path: /users
+    match_type: prefix
+    upstreams:
+      - host: http://127.0.0.1:8082
+`)
+	want := map[string]int{
+		"server.admin_token":               1,
+		"server.trusted_proxies[1]":        6,
+		"log.level":                        8,
+		"redis.db":                         10,
+		"routes[0].rate_limits[0].backend": 19,
+		"routes[1].name":                   20,
+	}
+	for path, line := range want {
+		got, ok := lines[path]
+		if !ok {
+			t.Errorf("missing error for %s", path)
+			continue
+		}
+		if got != line {
+			t.Errorf("%s line = %d, want %d", path, got, line)
+		}
+	}
+	for path := range lines {
+		if _, ok := want[path]; !ok {
+			t.Errorf("unexpected error for %s", path)
+		}
+	}
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want map[string]int // 错误路径及行号，为空表示加载成功
+	}{
+		{name: "valid override", env: map[string]string{"GATEWAY_SERVER_ADDR": ":9000"}},
+		// 环境变量覆盖后的值同样需要校验
+		{name: "invalid field in file", env: map[string]string{"GATEWAY_SERVER_ADDR": "9000"}, want: map[string]int{"server.addr": 2}},
+		{name: "field not in file", env: map[string]string{"GATEWAY_LOG_LEVEL": "verbose"}, want: map[string]int{"log.level": 1}},
+		{name: "multiple errors", env: map[string]string{"GATEWAY_SERVER_ADDR": "9000", "GATEWAY_REDIS_DB": "-1"},
+			want: map[string]int{"server.addr": 2, "redis.db": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			lines := loadErrors(t, validConfig)
+			if len(lines) != len(tt.want) {
+				t.Fatalf("errors = %v, want %v", lines, tt.want)
+			}
+			for path, line := range tt.want {
+				if got, ok := lines[path]; !ok || got != line {
+					t.Errorf("%s line = %d (found %v), want %d", path, got, ok, line)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadKeepsTLSDisabled(t *testing.T) {
+	cfg, err := Load(writeConfig(t, validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未配置 tls 时不因处理环境变量而启用 HTTPS
+	if cfg.Server.TLS != nil {
+		t.Errorf("server.tls = %+v, want nil", cfg.Server.TLS)
+	}
+	if cfg.Server.Addr != ":8080" {
+		t.Errorf("server.addr = %q, want :8080", cfg.Server.Addr)
+	}
+}
+
+func TestResolveLines(t *testing.T) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(validConfig), &root); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "server.addr", want: 2},
+		{path: "routes[0]", want: 4},
+		{path: "routes[0].match_type", want: 6},
+		{path: "routes[0].upstreams[0].host", want: 8},
+		{path: "routes[0].timeout.request", want: 4}, // 字段不存在，指向父节点
+		{path: "routes[3].name", want: 3},            // 下标越界，指向列表
+		{path: "redis.addr", want: 1},                // 顶层字段不存在，指向文档开头
+	}
+	var errs validator.ValidationErrors
+	for _, tt := range tests {
+		errs.Add(tt.path, "invalid")
+	}
+	resolved := resolveLines(errs, &root).(validator.ValidationErrors)
+	for i, tt := range tests {
+		if resolved[i].Line != tt.want {
+			t.Errorf("%s line = %d, want %d", tt.path, resolved[i].Line, tt.want)
+		}
+	}
+
+	// 非校验错误原样返回
+	other := errors.New("read failed")
+	if got := resolveLines(other, &root); got != other {
+		t.Errorf("resolveLines(%v) = %v", other, got)
+	}
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lccxxo/bailuoli/internal/certs"
+	"github.com/lccxxo/bailuoli/internal/clientip"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/validator"
+	"gopkg.in/yaml.v3"
+)
+
+// 校验配置文件字段的合法性，一次性返回所有错误
+
+var logLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true, "panic": true}
+
+// Validate 校验配置，返回 validator.ValidationErrors
+func Validate(cfg *model.Config) error {
+	var errs validator.ValidationErrors
+
+	errs.Append(validateServer(cfg.Server).WithPrefix("server"))
+
+	if cfg.Log.Level != "" && !logLevels[cfg.Log.Level] {
+		errs.Add("log.level", "invalid log level %q", cfg.Log.Level)
+	}
+
+	chain := validator.NewValidationChain()
+	names := make(map[string]int)
+	for i, route := range cfg.Routes {
+		path := fmt.Sprintf("routes[%d]", i)
+		if route == nil {
+			errs.Add(path, "route cannot be empty")
+			continue
+		}
+
+		if first, ok := names[route.Name]; ok && route.Name != "" {
+			errs.Add(validator.JoinPath(path, "name"), "duplicate route name %q, already defined at routes[%d]", route.Name, first)
+		} else {
+			names[route.Name] = i
+		}
+
+		var routeErrs validator.ValidationErrors
+		routeErrs.Append(chain.Validate(route))
+		errs.Append(routeErrs.WithPrefix(path))
+
+		// 客户端证书认证需要监听器配置客户端 CA
+		if route.ClientCert != nil && (cfg.Server.TLS == nil || cfg.Server.TLS.ClientCAFile == "") {
+			errs.Add(validator.JoinPath(path, "client_cert"), "server.tls.client_ca_file is required for client certificate authentication")
+		}
+
+		// 使用 redis 存储的限流规则需要配置 redis
+		for j, rule := range route.RateLimits {
+			if rule != nil && rule.Backend == constants.RateLimitBackendRedis && cfg.Redis.Addr == "" {
+				errs.Add(fmt.Sprintf("%s.rate_limits[%d].backend", path, j), "redis.addr is required when backend is %q", rule.Backend)
+			}
+		}
+	}
+
+	errs.Append(validateRedis(cfg.Redis).WithPrefix("redis"))
+
+	return errs.ErrOrNil()
+}
+
+func validateRedis(redis model.RedisConfig) validator.ValidationErrors {
+	var errs validator.ValidationErrors
+	if redis.Addr != "" {
+		if _, _, err := net.SplitHostPort(redis.Addr); err != nil {
+			errs.Add("addr", "invalid address %q: %v", redis.Addr, err)
+		}
+	}
+	if redis.DB < 0 {
+		errs.Add("db", "cannot be negative")
+	}
+	if redis.DialTimeout < 0 {
+		errs.Add("dial_timeout", "cannot be negative")
+	}
+	if redis.Timeout < 0 {
+		errs.Add("timeout", "cannot be negative")
+	}
+	if redis.PoolSize < 0 {
+		errs.Add("pool_size", "cannot be negative")
+	}
+	return errs
+}
+
+func validateServer(server model.ServerConfig) validator.ValidationErrors {
+	var errs validator.ValidationErrors
+	if _, _, err := net.SplitHostPort(server.Addr); err != nil {
+		errs.Add("addr", "invalid listen address %q: %v", server.Addr, err)
+	}
+	if server.AdminAddr != "" {
+		if host, _, err := net.SplitHostPort(server.AdminAddr); err != nil {
+			errs.Add("admin_addr", "invalid listen address %q: %v", server.AdminAddr, err)
+		} else if server.AdminAddr == server.Addr {
+			errs.Add("admin_addr", "cannot be the same as addr")
+		} else if !clientip.IsLoopbackHost(host) && server.AdminToken == "" {
+			// 管理接口可以修改上游节点，监听非本地地址时必须配置 token
+			errs.Add("admin_token", "required when admin_addr %q is not a loopback address", server.AdminAddr)
+		}
+	}
+	if server.ReadTimeout <= 0 {
+		errs.Add("read_timeout", "must be greater than zero")
+	}
+	if server.WriteTimeout <= 0 {
+		errs.Add("write_timeout", "must be greater than zero")
+	}
+	if server.ShutdownTimeout <= 0 {
+		errs.Add("shutdown_timeout", "must be greater than zero")
+	}
+	if p := server.RetryBudget.BudgetPercent; p < 0 || p > 100 {
+		errs.Add("retry_budget.budget_percent", "must be between 0 and 100")
+	}
+	if server.RetryBudget.MinRetryConcurrency < 0 {
+		errs.Add("retry_budget.min_retry_concurrency", "cannot be negative")
+	}
+	for i, cidr := range server.TrustedProxies {
+		if _, err := clientip.ParsePrefix(cidr); err != nil {
+			errs.Add(fmt.Sprintf("trusted_proxies[%d]", i), "%v", err)
+		}
+	}
+	if server.TLS != nil {
+		errs.Append(validateTLS(server).WithPrefix("tls"))
+	}
+	return errs
+}
+
+func validateTLS(server model.ServerConfig) validator.ValidationErrors {
+	var errs validator.ValidationErrors
+	config := server.TLS
+
+	if len(config.Certificates) == 0 {
+		errs.Add("certificates", "at least one certificate is required")
+	}
+	for i, c := range config.Certificates {
+		path := fmt.Sprintf("certificates[%d]", i)
+		if c.CertFile == "" || c.KeyFile == "" {
+			errs.Add(path, "cert_file and key_file are required")
+			continue
+		}
+		if _, err := certs.LoadCertificate(c); err != nil {
+			errs.Add(path, "%v", err)
+		}
+	}
+
+	if _, err := certs.ParseVersion(config.MinVersion); err != nil {
+		errs.Add("min_version", "%v", err)
+	}
+	for i, name := range config.CipherSuites {
+		if _, err := certs.ParseCipherSuites([]string{name}); err != nil {
+			errs.Add(fmt.Sprintf("cipher_suites[%d]", i), "%v", err)
+		}
+	}
+	for i, proto := range config.ALPN {
+		if proto != constants.ALPNHTTP2 && proto != constants.ALPNHTTP11 {
+			errs.Add(fmt.Sprintf("alpn[%d]", i), "unsupported protocol %q, must be one of %s, %s",
+				proto, constants.ALPNHTTP2, constants.ALPNHTTP11)
+		}
+	}
+
+	if config.ClientCAFile != "" {
+		if _, err := certs.LoadCertPool(config.ClientCAFile); err != nil {
+			errs.Add("client_ca_file", "%v", err)
+		}
+	}
+
+	if config.RedirectAddr != "" {
+		if _, _, err := net.SplitHostPort(config.RedirectAddr); err != nil {
+			errs.Add("redirect_addr", "invalid listen address %q: %v", config.RedirectAddr, err)
+		} else if config.RedirectAddr == server.Addr || config.RedirectAddr == server.AdminAddr {
+			errs.Add("redirect_addr", "cannot be the same as addr or admin_addr")
+		}
+	}
+	return errs
+}
+
+// 根据 YAML 节点树为错误补充行号
+func resolveLines(err error, root *yaml.Node) error {
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok || root == nil {
+		return err
+	}
+	for _, e := range errs {
+		e.Line = lineOf(root, e.Path)
+	}
+	return errs
+}
+
+var indexPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// lineOf 查找路径对应的行号，字段不存在时返回最近的父节点行号
+func lineOf(root *yaml.Node, path string) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+
+	for _, segment := range strings.Split(path, ".") {
+		key := segment
+		if i := strings.Index(segment, "["); i >= 0 {
+			key = segment[:i]
+		}
+
+		if key != "" {
+			next, keyLine := mappingValue(node, key)
+			if next == nil {
+				return line
+			}
+			node, line = next, keyLine
+		}
+
+		for _, m := range indexPattern.FindAllStringSubmatch(segment, -1) {
+			idx, _ := strconv.Atoi(m[1])
+			if node.Kind != yaml.SequenceNode || idx >= len(node.Content) {
+				return line
+			}
+			node = node.Content[idx]
+			line = node.Line
+		}
+	}
+	return line
+}
+
+func mappingValue(node *yaml.Node, key string) (*yaml.Node, int) {
+	if node.Kind != yaml.MappingNode {
+		return nil, 0
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1], node.Content[i].Line
+		}
+	}
+	return nil, 0
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"context"
 	"fmt"
+	"github.com/lccxxo/bailuoli/internal/metrics"
 	"github.com/lccxxo/bailuoli/internal/model"
 	"log"
 	"path/filepath"
@@ -11,7 +12,8 @@ import (
 )
 import "github.com/fsnotify/fsnotify"
 
-type WatchCallback func(cfg *model.Config)
+// WatchCallback 配置变更回调，返回错误表示新配置应用失败
+type WatchCallback func(cfg *model.Config) error
 
 var (
 	watcherLock sync.Mutex
@@ -64,11 +66,12 @@ func Watch(ctx context.Context, path string, cb WatchCallback, debounce time.Dur
 					newCfg, err := Load(path)
 					if err != nil {
 						log.Printf("Config reload failed: %v", err)
+						metrics.ObserveConfigReload(err)
 						continue
 					}
 
 					// 触发回调
-					cb(newCfg)
+					metrics.ObserveConfigReload(cb(newCfg))
 				}
 			case err, ok := <-w.Errors:
 				if !ok {
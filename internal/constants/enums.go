@@ -5,7 +5,190 @@ import "time"
 // 存放一些枚举类型值
 
 const (
-	DefaultLoadBalance = "round-robin"    // 默认负载均衡策略 round-robin 轮询策略
-	DefaultHealthCheck = 1 * time.Minute  // 默认健康检查间隔
-	DefaultConnTimeout = 10 * time.Second // 默认连接超时时间
+	DefaultConfigPath   = "configs/gateway.yaml" // 默认配置文件路径
+	DefaultLoadBalance  = "round-robin"          // 默认负载均衡策略 round-robin 轮询策略
+	DefaultHealthCheck  = 1 * time.Minute        // 默认健康检查间隔
+	DefaultConnTimeout  = 10 * time.Second       // 默认连接超时时间
+	DefaultReadTimeout  = 30 * time.Second       // 默认读取请求超时时间
+	DefaultWriteTimeout = 30 * time.Second       // 默认写入响应超时时间
+)
+
+// 请求超时相关的请求头，网关会遵循客户端传入的超时时间，并将剩余时间传递给上游
+const (
+	HeaderRequestTimeout = "X-Request-Timeout" // 毫秒数或 Go duration 格式（如 1500、1.5s）
+	HeaderGRPCTimeout    = "Grpc-Timeout"      // gRPC 超时格式（如 100m、5S）
+)
+
+// TLS 默认值
+const (
+	DefaultTLSMinVersion = "1.2"
+	ALPNHTTP2            = "h2"
+	ALPNHTTP11           = "http/1.1"
+)
+
+// 客户端证书认证后转发给上游的身份请求头，客户端传入的同名请求头会被删除
+const (
+	HeaderClientCertSubject   = "X-Client-Cert-Subject"   // 证书主题
+	HeaderClientCertSPIFFEID  = "X-Client-Cert-Spiffe-Id" // 证书中的 SPIFFE ID
+	HeaderForwardedClientCert = "X-Forwarded-Client-Cert" // 与 Envoy 兼容的 XFCC 格式
+)
+
+// 服务发现默认值
+const (
+	DiscoveryConsul           = "consul"                // consul 服务发现
+	DiscoveryFile             = "file"                  // 文件服务发现
+	DiscoveryDNS              = "dns"                   // DNS 服务发现
+	DefaultDNSRefreshInterval = 30 * time.Second        // 默认 DNS 刷新间隔
+	MinDNSTTL                 = 5 * time.Second         // DNS 记录 TTL 的下限，避免 TTL 为 1s 等过小值时频繁查询
+	DefaultConsulAddress      = "http://127.0.0.1:8500" // 默认 consul 地址
+	DefaultConsulWaitTime     = 5 * time.Minute         // 默认阻塞查询等待时间
+	DefaultDiscoveryBackoff   = 30 * time.Second        // 服务发现失败重试的最大间隔
+)
+
+// 负载均衡策略名称
+const (
+	StrategyRandom           = "random"            // 随机
+	StrategyRoundRobin       = "round-robin"       // 轮询
+	StrategyIPHash           = "ip_hash"           // IP哈希
+	StrategyWeighted         = "weighted"          // 加权轮询
+	StrategyLeastConnections = "least-connections" // 最少连接
+	StrategyConsistentHash   = "consistent_hash"   // 一致性哈希环（ketama）
+	StrategyMaglev           = "maglev"            // Maglev 一致性哈希
+	StrategyP2C              = "p2c"               // 随机选择两个节点，按 Peak EWMA 负载选择
+	StrategyEWMA             = "ewma"              // 所有节点中按 Peak EWMA 负载选择
+)
+
+// LoadBalanceStrategies 支持的负载均衡策略（round、round_robin 为兼容旧配置的别名）
+var LoadBalanceStrategies = []string{
+	StrategyRandom, "round",
+	StrategyRoundRobin, "round_robin",
+	StrategyIPHash,
+	StrategyWeighted,
+	StrategyLeastConnections,
+	StrategyConsistentHash,
+	StrategyMaglev,
+	StrategyP2C,
+	StrategyEWMA,
+}
+
+// 会话保持默认值
+const (
+	DefaultStickyCookieName = "bailuoli_sticky"
+	DefaultStickyPath       = "/"
+	StickySameSiteLax       = "lax"
+	StickySameSiteStrict    = "strict"
+	StickySameSiteNone      = "none"
+)
+
+// 并发等待队列默认值
+const (
+	DefaultConnQueueTimeout = 1 * time.Second
+	ConnQueueRetryAfter     = 1 * time.Second // 并发上限拒绝请求时的 Retry-After
+)
+
+// Peak EWMA 默认值
+const (
+	DefaultEWMADecay   = 10 * time.Second
+	DefaultEWMALatency = 30 * time.Millisecond // 没有延迟数据的节点使用的延迟
+	EWMAErrorPenalty   = 1 * time.Second       // 转发失败时记录的最小延迟，避免快速失败的节点被优先选择
+)
+
+// 一致性哈希的 key 来源及默认值
+const (
+	HashKeyIP           = "ip"
+	HashKeyHeader       = "header"
+	HashKeyCookie       = "cookie"
+	HashKeyQuery        = "query"
+	HashKeyPath         = "path"
+	DefaultVirtualNodes = 160   // 每单位权重的虚拟节点数
+	MaglevTableSize     = 65537 // Maglev 查找表大小（质数，需要远大于节点数）
+)
+
+// HashKeySources 支持的一致性哈希 key 来源
+var HashKeySources = []string{HashKeyIP, HashKeyHeader, HashKeyCookie, HashKeyQuery, HashKeyPath}
+
+// 重试条件及默认值（与 Envoy retry policy 保持一致）
+const (
+	RetryOnConnectFailure      = "connect-failure" // 连接上游失败
+	RetryOnReset               = "reset"           // 连接被重置或响应未完整返回
+	RetryOnGatewayError        = "gateway-error"   // 502、503、504 或单次尝试超时
+	RetryOn5xx                 = "5xx"             // 所有5xx 或单次尝试超时
+	DefaultRetryBaseInterval   = 25 * time.Millisecond
+	DefaultRetryMaxBodySize    = 64 << 10 // 默认缓存请求体大小 64KB
+	DefaultRetryBudgetPercent  = 20.0     // 默认重试预算百分比
+	DefaultMinRetryConcurrency = 3        // 默认最少并发重试数
+)
+
+// RetryConditions 支持的重试条件
+var RetryConditions = []string{RetryOnConnectFailure, RetryOnReset, RetryOnGatewayError, RetryOn5xx}
+
+// 限流维度及默认值
+const (
+	RateLimitKeyRoute       = "route"     // 整个路由共享一个令牌桶
+	RateLimitKeyIP          = "ip"        // 按客户端 IP
+	RateLimitKeyHeader      = "header"    // 按请求头，如 API Key
+	RateLimitKeyJWTClaim    = "jwt_claim" // 按 JWT claim
+	DefaultRateLimitPeriod  = time.Second
+	DefaultRateLimitMaxKeys = 10000    // 默认每条规则最多保存的 key 数量
+	RateLimitBackendLocal   = "local"  // 进程内令牌桶
+	RateLimitBackendRedis   = "redis"  // Redis GCRA，多实例共享
+	RateLimitFailOpen       = "open"   // 存储不可用时放行
+	RateLimitFailClosed     = "closed" // 存储不可用时拒绝
+)
+
+// Redis 默认值
+const (
+	DefaultRedisDialTimeout = 1 * time.Second
+	DefaultRedisTimeout     = 200 * time.Millisecond
+	DefaultRedisPoolSize    = 16
+	DefaultRedisKeyPrefix   = "bailuoli:ratelimit:"
+)
+
+// RateLimitKeys 支持的限流维度
+var RateLimitKeys = []string{RateLimitKeyRoute, RateLimitKeyIP, RateLimitKeyHeader, RateLimitKeyJWTClaim}
+
+// 认证方式及默认值
+const (
+	AuthTypeJWT                = "jwt"
+	AuthTypeAPIKey             = "api_key"
+	AuthTypeBasic              = "basic"
+	DefaultAPIKeyHeader        = "X-API-Key"
+	HeaderConsumer             = "X-Consumer"     // 认证通过后转发给上游的调用方名称
+	DefaultJWTClockSkew        = 30 * time.Second // 校验 exp、nbf 时允许的时钟偏差
+	DefaultJWKSRefreshInterval = 5 * time.Minute  // JWKS 定期刷新间隔
+	JWKSMinRefreshInterval     = 30 * time.Second // 遇到未知 kid 时两次刷新的最小间隔
+	JWKSFetchTimeout           = 5 * time.Second
+)
+
+// 外部授权默认值
+const (
+	DefaultExtAuthzTimeout       = 1 * time.Second
+	DefaultExtAuthzStatusOnError = 403
+	ExtAuthzFailOpen             = "open"   // 授权服务不可用时放行
+	ExtAuthzFailClosed           = "closed" // 授权服务不可用时拒绝
+	ExtAuthzMaxBodySize          = 64 << 10 // 拒绝时返回给客户端的授权响应体最大字节数
+	ExtAuthzMaxCacheEntries      = 10000    // 授权结果缓存上限
+	HeaderForwardedMethod        = "X-Forwarded-Method"
+	HeaderForwardedURI           = "X-Forwarded-Uri"
+)
+
+// AuthTypes 支持的认证方式
+var AuthTypes = []string{AuthTypeJWT, AuthTypeAPIKey, AuthTypeBasic}
+
+// JWTAlgorithms 支持的 JWT 签名算法
+var JWTAlgorithms = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "HS256", "HS384", "HS512"}
+
+// CORSDefaultMethods 跨域配置未指定 allow_methods 时允许的方法
+var CORSDefaultMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// 被动健康检查默认值（与 Envoy outlier detection 保持一致）
+const (
+	DefaultOutlierConsecutiveErrors  = 5                 // 默认连续错误驱逐阈值
+	DefaultOutlierInterval           = 10 * time.Second  // 默认统计间隔
+	DefaultOutlierBaseEjectionTime   = 30 * time.Second  // 默认基础驱逐时长
+	DefaultOutlierMaxEjectionTime    = 300 * time.Second // 默认最大驱逐时长
+	DefaultOutlierMaxEjectionPercent = 10                // 默认最多驱逐节点百分比
+	DefaultOutlierMinimumHosts       = 5                 // 默认成功率检测最少节点数
+	DefaultOutlierRequestVolume      = 100               // 默认成功率检测最少请求数
+	DefaultOutlierStdevFactor        = 1.9               // 默认成功率标准差因子
 )
@@ -11,4 +11,8 @@ var (
 	ErrCountIllegal       = errors.New("count is illegal")
 	ErrNoHealthyUpstreams = errors.New("no healthy upstreams")
 	ErrCircuitBreakerOpen = errors.New("circuit breaker is open")
+	ErrRouteNotFound      = errors.New("route not found")
+	ErrUpstreamsBusy      = errors.New("all upstreams reached the concurrency limit")
+	ErrConnQueueFull      = errors.New("concurrency queue is full")
+	ErrConnQueueTimeout   = errors.New("concurrency queue wait timeout")
 )
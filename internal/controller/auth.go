@@ -0,0 +1,457 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/lccxxo/bailuoli/internal/auth"
+	"github.com/lccxxo/bailuoli/internal/clientip"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/metrics"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+)
+
+// 路由认证
+// 认证中间件位于限流之前，限流可以使用认证得到的身份信息（如 JWT claim）
+// IP 访问控制位于认证之前，不允许的地址不需要执行认证
+// 认证方式（auth）使用 routeAuth 保存，路由匹配（match_claims）与认证中间件共用
+
+// routeAuth 路由的认证器，配置热更新时重新创建
+type routeAuth struct {
+	config      *model.AuthConfig
+	jwt         *auth.JWTAuthenticator
+	credentials *auth.CredentialStore // api_key、basic 使用的凭证
+}
+
+// newRouteAuth 根据路由配置创建认证器，未配置 auth 时返回 nil
+func newRouteAuth(route *model.Route) (*routeAuth, error) {
+	if route.Auth == nil {
+		return nil, nil
+	}
+
+	ra := &routeAuth{config: route.Auth}
+	switch route.Auth.Type {
+	case constants.AuthTypeJWT:
+		if route.Auth.JWT == nil {
+			return nil, errors.New("auth.jwt is required when type is jwt")
+		}
+		jwt, err := auth.NewJWTAuthenticator(*route.Auth.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("auth.jwt: %w", err)
+		}
+		ra.jwt = jwt
+	case constants.AuthTypeAPIKey:
+		if route.Auth.APIKey == nil {
+			return nil, errors.New("auth.api_key is required when type is api_key")
+		}
+		store, err := auth.GetCredentialStore(route.Auth.APIKey.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth.api_key: %w", err)
+		}
+		ra.credentials = store
+	case constants.AuthTypeBasic:
+		if route.Auth.Basic == nil {
+			return nil, errors.New("auth.basic is required when type is basic")
+		}
+		store, err := auth.GetCredentialStore(route.Auth.Basic.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth.basic: %w", err)
+		}
+		ra.credentials = store
+	default:
+		return nil, fmt.Errorf("unknown auth type %q", route.Auth.Type)
+	}
+	return ra, nil
+}
+
+// close 释放认证器使用的凭证文件监听和 JWKS，路由被替换后调用
+func (ra *routeAuth) close() {
+	if ra.jwt != nil {
+		ra.jwt.Close()
+	}
+	if ra.credentials != nil {
+		ra.credentials.Close()
+	}
+}
+
+// matchClaims 请求中的 JWT 是否有效且满足路由的 match_claims
+// 这里校验的结果不会保存，路由的认证中间件会再次校验
+func (ra *routeAuth) matchClaims(r *http.Request, want map[string]string) bool {
+	if ra == nil || ra.jwt == nil {
+		return false
+	}
+	claims, err := ra.jwt.Verify(r.Context(), auth.BearerToken(r))
+	return err == nil && auth.MatchClaims(claims, want)
+}
+
+// AuthMiddleware 根据路由配置依次执行认证：客户端证书、认证方式（auth）、外部授权（ext_authz），未配置认证时直接返回 next
+func AuthMiddleware(route *model.Route, ra *routeAuth, next http.Handler) http.Handler {
+	if route.ExtAuthz != nil {
+		next = ExtAuthzMiddleware(route.Name, auth.NewExtAuthz(*route.ExtAuthz), next)
+	}
+	if ra != nil {
+		switch ra.config.Type {
+		case constants.AuthTypeJWT:
+			next = JWTMiddleware(route.Name, ra.jwt, ra.config.HideCredentials, next)
+		case constants.AuthTypeAPIKey:
+			next = APIKeyMiddleware(route.Name, ra.config.APIKey, ra.credentials, ra.config.HideCredentials, next)
+		case constants.AuthTypeBasic:
+			next = BasicAuthMiddleware(route.Name, ra.credentials, ra.config.HideCredentials, next)
+		}
+	}
+	if route.ClientCert != nil {
+		next = ClientCertMiddleware(route.Name, route.ClientCert, next)
+	}
+	return next
+}
+
+// JWTMiddleware JWT 认证
+// 未携带或 token 无效返回 401，不满足 required_claims 返回 403，响应携带 WWW-Authenticate（RFC 6750）
+// 认证通过后 claims 写入上下文（jwt_claims），并按 forward_claims 转发给上游
+func JWTMiddleware(route string, authenticator *auth.JWTAuthenticator, hideCredentials bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 删除客户端伪造的 claim 请求头
+		for _, header := range authenticator.ForwardClaims() {
+			r.Header.Del(header)
+		}
+
+		claims, err := authenticator.Verify(r.Context(), auth.BearerToken(r))
+		if errors.Is(err, auth.ErrMissingToken) {
+			metrics.ObserveAuthFailure(route, constants.AuthTypeJWT, "missing")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+route+`"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			metrics.ObserveAuthFailure(route, constants.AuthTypeJWT, "invalid")
+			logger.Logger.Debug("jwt authentication failed", zap.String("route", route), zap.Error(err))
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s", error="invalid_token", error_description=%q`,
+				route, strings.TrimPrefix(err.Error(), auth.ErrInvalidToken.Error()+": ")))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		if !authenticator.Authorize(claims) {
+			metrics.ObserveAuthFailure(route, constants.AuthTypeJWT, "forbidden")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+route+`", error="insufficient_scope"`)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		for claim, header := range authenticator.ForwardClaims() {
+			if v := auth.ClaimString(claims, claim); v != "" {
+				r.Header.Set(header, v)
+			}
+		}
+		if hideCredentials {
+			r.Header.Del("Authorization")
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "jwt_claims", claims)))
+	})
+}
+
+// APIKeyMiddleware API Key 认证，API Key 从请求头（默认 X-API-Key）或查询参数中读取
+// 未携带或无效返回 401，调用方不允许访问该路由返回 403
+func APIKeyMiddleware(route string, config *model.APIKeyConfig, store *auth.CredentialStore, hideCredentials bool, next http.Handler) http.Handler {
+	header := config.Header
+	if header == "" {
+		header = constants.DefaultAPIKeyHeader
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(header)
+		fromQuery := false
+		if key == "" && config.Query != "" {
+			key = r.URL.Query().Get(config.Query)
+			fromQuery = true
+		}
+		if key == "" {
+			metrics.ObserveAuthFailure(route, constants.AuthTypeAPIKey, "missing")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		consumer, err := store.AuthenticateAPIKey(key)
+		if err != nil {
+			metrics.ObserveAuthFailure(route, constants.AuthTypeAPIKey, "invalid")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		if hideCredentials {
+			r.Header.Del(header)
+			if fromQuery {
+				query := r.URL.Query()
+				query.Del(config.Query)
+				r.URL.RawQuery = query.Encode()
+			}
+		}
+		serveConsumer(w, r, route, constants.AuthTypeAPIKey, consumer, next)
+	})
+}
+
+// BasicAuthMiddleware Basic 认证
+// 未携带或用户名密码错误返回 401 并携带 WWW-Authenticate，调用方不允许访问该路由返回 403
+func BasicAuthMiddleware(route string, store *auth.CredentialStore, hideCredentials bool, next http.Handler) http.Handler {
+	challenge := `Basic realm="` + route + `", charset="UTF-8"`
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			metrics.ObserveAuthFailure(route, constants.AuthTypeBasic, "missing")
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		consumer, err := store.AuthenticateBasic(username, password)
+		if err != nil {
+			metrics.ObserveAuthFailure(route, constants.AuthTypeBasic, "invalid")
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		if hideCredentials {
+			r.Header.Del("Authorization")
+		}
+		serveConsumer(w, r, route, constants.AuthTypeBasic, consumer, next)
+	})
+}
+
+// serveConsumer 检查调用方是否允许访问路由，通过后将调用方写入上下文（consumer）和访问日志，并转发给上游
+// 客户端携带的调用方请求头已由 IdentityHeadersMiddleware 删除，认证通过后才会写入
+func serveConsumer(w http.ResponseWriter, r *http.Request, route, authType string, consumer *auth.Consumer, next http.Handler) {
+	if !consumer.AllowRoute(route) {
+		metrics.ObserveAuthFailure(route, authType, "forbidden")
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	logger.GetRequestInfo(r.Context()).Consumer = consumer.Name
+	r.Header.Set(constants.HeaderConsumer, consumer.Name)
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "consumer", consumer)))
+}
+
+// identityHeaders 网关认证通过后写入的身份请求头
+var identityHeaders = []string{
+	constants.HeaderConsumer,
+	constants.HeaderClientCertSubject,
+	constants.HeaderClientCertSPIFFEID,
+	constants.HeaderForwardedClientCert,
+}
+
+// IdentityHeadersMiddleware 删除客户端携带的身份请求头，避免上游收到伪造的身份
+// 位于路由中间件的最外层，未配置认证的路由同样执行
+func IdentityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, header := range identityHeaders {
+			r.Header.Del(header)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ipRestriction 路由的客户端 IP 访问控制
+type ipRestriction struct {
+	allow *clientip.PrefixSet // 为 nil 时不限制
+	deny  *clientip.PrefixSet
+}
+
+// newIPRestriction 根据路由配置创建 IP 访问控制，未配置时返回 nil
+func newIPRestriction(route *model.Route) (*ipRestriction, error) {
+	cfg := route.IPRestriction
+	if cfg == nil {
+		return nil, nil
+	}
+
+	ir := &ipRestriction{}
+	var err error
+	if len(cfg.Allow) > 0 {
+		if ir.allow, err = clientip.NewPrefixSet(cfg.Allow); err != nil {
+			return nil, fmt.Errorf("ip_restriction.allow: %w", err)
+		}
+	}
+	if ir.deny, err = clientip.NewPrefixSet(cfg.Deny); err != nil {
+		return nil, fmt.Errorf("ip_restriction.deny: %w", err)
+	}
+	return ir, nil
+}
+
+// allowed 客户端 IP 是否允许访问，无法解析客户端 IP 时只有未配置 allow 才放行
+func (ir *ipRestriction) allowed(addr netip.Addr) bool {
+	if ir.deny.Contains(addr) {
+		return false
+	}
+	return ir.allow == nil || ir.allow.Contains(addr)
+}
+
+// IPRestrictionMiddleware 客户端 IP 访问控制，不允许的地址返回 403
+func IPRestrictionMiddleware(route string, ir *ipRestriction, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr := clientip.Resolve(r)
+		if !ir.allowed(addr) {
+			metrics.ObserveAuthFailure(route, "ip_restriction", "denied")
+			logger.Logger.Debug("client ip denied", zap.String("route", route), zap.Stringer("ip", addr))
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ExtAuthzMiddleware 外部授权
+// 放行时将授权服务返回的 upstream_headers 请求头设置到上游请求，拒绝时将授权服务的状态码、响应头和响应体返回给客户端
+// 授权服务不可用时 failure_mode 为 open 放行，为 closed 返回 status_on_error
+func ExtAuthzMiddleware(route string, authz *auth.ExtAuthz, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := authz.Check(r)
+		if err != nil {
+			metrics.ObserveAuthFailure(route, "ext_authz", "error")
+			logger.Logger.Warn("ext_authz unavailable",
+				zap.String("route", route),
+				zap.Bool("fail_open", authz.FailOpen()),
+				zap.Error(err))
+			if authz.FailOpen() {
+				authz.StripUpstreamHeaders(r.Header)
+				next.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, http.StatusText(authz.StatusOnError()), authz.StatusOnError())
+			return
+		}
+
+		if !resp.Allowed {
+			metrics.ObserveAuthFailure(route, "ext_authz", "denied")
+			for name, values := range resp.Header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(resp.Status)
+			_, _ = w.Write(resp.Body)
+			return
+		}
+
+		for name, values := range resp.Header {
+			if len(values) == 0 {
+				r.Header.Del(name)
+				continue
+			}
+			r.Header[name] = values
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientCertMiddleware 客户端证书认证
+// 证书由监听器使用 client_ca_file 校验，这里只检查请求是否携带已校验的证书以及证书身份是否被允许
+// 客户端携带的身份请求头已由 IdentityHeadersMiddleware 删除
+// 未携带证书返回 401，身份不在允许列表中返回 403
+func ClientCertMiddleware(route string, config *model.ClientCertConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			metrics.ObserveAuthFailure(route, "client_cert", "missing")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		if !clientCertAllowed(cert, config) {
+			metrics.ObserveAuthFailure(route, "client_cert", "forbidden")
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		if config.ForwardIdentity {
+			r.Header.Set(constants.HeaderClientCertSubject, cert.Subject.String())
+			if id := spiffeID(cert); id != "" {
+				r.Header.Set(constants.HeaderClientCertSPIFFEID, id)
+			}
+			r.Header.Set(constants.HeaderForwardedClientCert, forwardedClientCert(cert))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientCertAllowed 未配置允许列表时允许所有通过 CA 校验的证书，否则匹配任意一项即可
+func clientCertAllowed(cert *x509.Certificate, config *model.ClientCertConfig) bool {
+	if len(config.AllowedSubjects) == 0 && len(config.AllowedSANs) == 0 && len(config.AllowedSPIFFEIDs) == 0 {
+		return true
+	}
+
+	if slices.Contains(config.AllowedSubjects, cert.Subject.CommonName) {
+		return true
+	}
+	for _, san := range certificateSANs(cert) {
+		if slices.Contains(config.AllowedSANs, san) {
+			return true
+		}
+	}
+	if id := spiffeID(cert); id != "" {
+		for _, allowed := range config.AllowedSPIFFEIDs {
+			if id == allowed || strings.HasSuffix(allowed, "/*") && strings.HasPrefix(id, allowed[:len(allowed)-1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.IPAddresses)+len(cert.URIs))
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// spiffeID 获取证书 URI SAN 中的 SPIFFE ID
+func spiffeID(cert *x509.Certificate) string {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+	return ""
+}
+
+// forwardedClientCert 生成 XFCC 格式的客户端证书信息，如 Hash=...;Subject="CN=client";URI=spiffe://example.org/app
+func forwardedClientCert(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := []string{
+		"Hash=" + hex.EncodeToString(sum[:]),
+		"Subject=" + xfccQuote(cert.Subject.String()),
+	}
+	for _, uri := range cert.URIs {
+		parts = append(parts, "URI="+quoteXFCC(uri.String()))
+	}
+	for _, name := range cert.DNSNames {
+		parts = append(parts, "DNS="+quoteXFCC(name))
+	}
+	return strings.Join(parts, ";")
+}
+
+// quoteXFCC 值中包含分隔符时加引号
+func quoteXFCC(value string) string {
+	if !strings.ContainsAny(value, `,;="`) {
+		return value
+	}
+	return xfccQuote(value)
+}
+
+func xfccQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
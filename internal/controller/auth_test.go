@@ -0,0 +1,318 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lccxxo/bailuoli/internal/auth"
+	"github.com/lccxxo/bailuoli/internal/clientip"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newHeaderUpstream 上游服务，记录收到的请求头
+func newHeaderUpstream(t *testing.T) (*httptest.Server, <-chan http.Header) {
+	t.Helper()
+	received := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+// serveRoute 与网关入口相同：匹配路由后将路由写入上下文并转发
+func serveRoute(t *testing.T, router *Router, r *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	route, handler := router.MatchRoute(r)
+	if route == nil {
+		t.Fatalf("no route matched %s", r.URL.Path)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "route", route)))
+	return w
+}
+
+func TestIdentityHeadersStripped(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	upstream, received := newHeaderUpstream(t)
+	router, err := NewRouter([]*model.Route{{
+		Name:        "public",
+		Path:        "/public",
+		MatchType:   "prefix",
+		Upstreams:   []*model.UpstreamsConfig{{Host: upstream.URL}},
+		LoadBalance: model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(router.Stop)
+
+	// 未配置 client_cert 的路由同样删除客户端伪造的证书身份
+	r := httptest.NewRequest(http.MethodGet, "/public", nil)
+	for _, header := range identityHeaders {
+		r.Header.Set(header, "forged")
+	}
+	r.Header.Set("X-Request-Tag", "kept")
+	if w := serveRoute(t, router, r); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	header := <-received
+	for _, name := range identityHeaders {
+		if v := header.Get(name); v != "" {
+			t.Errorf("upstream received %s: %q", name, v)
+		}
+	}
+	if header.Get("X-Request-Tag") != "kept" {
+		t.Error("other request headers were removed")
+	}
+}
+
+// basicCredentials 写入只包含一个 Basic 认证用户的凭证文件
+func basicCredentials(t *testing.T, username, password string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "credentials.yaml")
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := "consumers:\n  - name: " + username + "\n    username: " + username + "\n    password_hash: \"" + string(hash) + "\"\n"
+	if err := os.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestConsumerHeader(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	upstream, received := newHeaderUpstream(t)
+	credentials := basicCredentials(t, "alice", "secret")
+
+	route := func(name string, authConfig *model.AuthConfig) *model.Route {
+		return &model.Route{
+			Name:        name,
+			Path:        "/" + name,
+			MatchType:   "prefix",
+			Upstreams:   []*model.UpstreamsConfig{{Host: upstream.URL}},
+			LoadBalance: model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin},
+			Auth:        authConfig,
+		}
+	}
+	router, err := NewRouter([]*model.Route{
+		route("public", nil),
+		route("private", &model.AuthConfig{
+			Type:  constants.AuthTypeBasic,
+			Basic: &model.BasicAuthConfig{CredentialsFile: credentials},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(router.Stop)
+
+	tests := []struct {
+		name     string
+		path     string
+		basic    bool
+		want     int
+		consumer string
+	}{
+		{name: "no auth", path: "/public", want: http.StatusOK, consumer: ""},
+		{name: "authenticated", path: "/private", basic: true, want: http.StatusOK, consumer: "alice"},
+		{name: "unauthenticated", path: "/private", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set(constants.HeaderConsumer, "admin")
+			if tt.basic {
+				r.SetBasicAuth("alice", "secret")
+			}
+			if w := serveRoute(t, router, r); w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			if got := (<-received).Get(constants.HeaderConsumer); got != tt.consumer {
+				t.Errorf("upstream consumer = %q, want %q", got, tt.consumer)
+			}
+		})
+	}
+}
+
+// extAuthzServer 授权服务，放行时返回 X-User-Id、Authorization、Host 等响应头
+func extAuthzServer(t *testing.T, status int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-User-Id", "alice")
+		w.Header().Set("X-Internal", "secret")
+		w.Header().Set("Authorization", "Bearer service-token")
+		w.Header().Set("Host", "evil.example")
+		w.Header().Set("Connection", "close")
+		w.Header().Set("Upgrade", "websocket")
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestExtAuthzUpstreamHeaders(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	srv := extAuthzServer(t, http.StatusOK)
+
+	tests := []struct {
+		name            string
+		upstreamHeaders []string
+		want            map[string]string
+	}{
+		{
+			// 未配置 upstream_headers 时不复制授权响应头，客户端的请求头原样转发
+			name: "empty",
+			want: map[string]string{"X-User-Id": "forged", "X-Internal": "", "Authorization": "Bearer client-token"},
+		},
+		{
+			// 只复制 upstream_headers 中的请求头，授权服务未返回的请求头被删除，避免客户端伪造
+			name:            "allowlist",
+			upstreamHeaders: []string{"x-user-id", "X-Tenant"},
+			want:            map[string]string{"X-User-Id": "alice", "X-Tenant": "", "X-Internal": "", "Authorization": "Bearer client-token"},
+		},
+		{
+			// Host、Authorization 和逐跳请求头即使配置在 upstream_headers 中也不会被授权服务覆盖
+			name:            "protected",
+			upstreamHeaders: []string{"X-User-Id", "Authorization", "Host", "Connection", "Upgrade"},
+			want:            map[string]string{"X-User-Id": "alice", "Authorization": "Bearer client-token", "Connection": "", "Upgrade": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authz := auth.NewExtAuthz(model.ExtAuthzConfig{URL: srv.URL, UpstreamHeaders: tt.upstreamHeaders})
+			var received *http.Request
+			handler := ExtAuthzMiddleware("orders", authz, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "http://orders.example/orders", nil)
+			r.Header.Set("Authorization", "Bearer client-token")
+			r.Header.Set("X-User-Id", "forged")
+			r.Header.Set("X-Tenant", "forged")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if received == nil {
+				t.Fatalf("request not forwarded, status = %d", w.Code)
+			}
+			for name, want := range tt.want {
+				if got := received.Header.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if received.Host != "orders.example" {
+				t.Errorf("host = %q, want orders.example", received.Host)
+			}
+		})
+	}
+}
+
+func TestExtAuthzFailureMode(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	srv := extAuthzServer(t, http.StatusServiceUnavailable)
+
+	tests := []struct {
+		name   string
+		config model.ExtAuthzConfig
+		want   int
+	}{
+		{name: "default closed", want: http.StatusForbidden},
+		{name: "closed", config: model.ExtAuthzConfig{FailureMode: constants.ExtAuthzFailClosed, StatusOnError: http.StatusServiceUnavailable}, want: http.StatusServiceUnavailable},
+		{name: "open", config: model.ExtAuthzConfig{FailureMode: constants.ExtAuthzFailOpen}, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.URL = srv.URL
+			tt.config.UpstreamHeaders = []string{"X-User-Id"}
+			var received http.Header
+			handler := ExtAuthzMiddleware("orders", auth.NewExtAuthz(tt.config), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r.Header.Clone()
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			r.Header.Set("X-User-Id", "forged")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				if received != nil {
+					t.Error("request forwarded while the authz service is unavailable")
+				}
+				return
+			}
+			// 放行时删除客户端伪造的 upstream_headers
+			if received == nil || received.Get("X-User-Id") != "" {
+				t.Errorf("forwarded = %v, X-User-Id = %q, want forwarded without the header", received != nil, received.Get("X-User-Id"))
+			}
+		})
+	}
+}
+
+func TestIPRestriction(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	if err := clientip.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { clientip.SetTrustedProxySet(nil) })
+
+	tests := []struct {
+		name   string
+		config model.IPRestrictionConfig
+		remote string
+		xff    string
+		want   int
+	}{
+		{name: "allow", config: model.IPRestrictionConfig{Allow: []string{"198.51.100.0/24"}}, remote: "198.51.100.7:1234", want: http.StatusOK},
+		{name: "not allowed", config: model.IPRestrictionConfig{Allow: []string{"198.51.100.0/24"}}, remote: "203.0.113.7:1234", want: http.StatusForbidden},
+		// deny 优先于 allow
+		{name: "deny overrides allow", config: model.IPRestrictionConfig{Allow: []string{"198.51.100.0/24"}, Deny: []string{"198.51.100.7"}}, remote: "198.51.100.7:1234", want: http.StatusForbidden},
+		{name: "deny only", config: model.IPRestrictionConfig{Deny: []string{"203.0.113.0/24"}}, remote: "198.51.100.7:1234", want: http.StatusOK},
+		// 通过可信代理转发时按 X-Forwarded-For 中的客户端 IP 判断
+		{name: "client behind trusted proxy", config: model.IPRestrictionConfig{Allow: []string{"198.51.100.0/24"}}, remote: "10.0.0.1:1234", xff: "198.51.100.7", want: http.StatusOK},
+		{name: "denied client behind trusted proxy", config: model.IPRestrictionConfig{Deny: []string{"203.0.113.0/24"}}, remote: "10.0.0.1:1234", xff: "203.0.113.7, 10.0.0.2", want: http.StatusForbidden},
+		// 不可信的连接伪造 X-Forwarded-For 无法绕过限制
+		{name: "forged xff", config: model.IPRestrictionConfig{Allow: []string{"198.51.100.0/24"}}, remote: "203.0.113.7:1234", xff: "198.51.100.7", want: http.StatusForbidden},
+		// 无法解析客户端 IP 时只有未配置 allow 才放行
+		{name: "unknown client with allow", config: model.IPRestrictionConfig{Allow: []string{"198.51.100.0/24"}}, remote: "pipe", want: http.StatusForbidden},
+		{name: "unknown client with deny", config: model.IPRestrictionConfig{Deny: []string{"203.0.113.0/24"}}, remote: "pipe", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ir, err := newIPRestriction(&model.Route{IPRestriction: &tt.config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := IPRestrictionMiddleware("orders", ir, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+
+	if _, err := newIPRestriction(&model.Route{IPRestriction: &model.IPRestrictionConfig{Deny: []string{"10.0.0.0/33"}}}); err == nil {
+		t.Error("invalid deny cidr accepted")
+	}
+}
@@ -1,3 +1,182 @@
 package controller
 
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/auth"
+	"github.com/lccxxo/bailuoli/internal/clientip"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/metrics"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/proxy"
+	"github.com/lccxxo/bailuoli/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
 // 用于中间件
+
+// 限流规则
+type rateLimitRule struct {
+	id      string // 路由名称/规则名称，热更新时用于复用令牌桶
+	name    string
+	config  model.RateLimitConfig
+	limiter ratelimit.Limiter
+}
+
+// buildRateLimits 创建路由的限流规则，配置未变化的规则复用原有的令牌桶，热更新时不会重置计数
+func buildRateLimits(route *model.Route, old map[string]*rateLimitRule) []*rateLimitRule {
+	rules := make([]*rateLimitRule, 0, len(route.RateLimits))
+	for i, cfg := range route.RateLimits {
+		config := rateLimitDefaults(*cfg)
+		name := config.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		id := route.Name + "/" + name
+
+		if rule, ok := old[id]; ok && rule.config == config {
+			rules = append(rules, rule)
+			continue
+		}
+
+		rate := float64(config.Rate) / config.Period.Seconds()
+		var limiter ratelimit.Limiter
+		switch config.Backend {
+		case constants.RateLimitBackendRedis:
+			limiter = ratelimit.NewRedisLimiter(id, rate, config.Burst)
+		default:
+			limiter = ratelimit.NewTokenBucket(rate, config.Burst, config.MaxKeys)
+		}
+		rules = append(rules, &rateLimitRule{
+			id:      id,
+			name:    name,
+			config:  config,
+			limiter: limiter,
+		})
+	}
+	return rules
+}
+
+func rateLimitDefaults(config model.RateLimitConfig) model.RateLimitConfig {
+	if config.Key == "" {
+		config.Key = constants.RateLimitKeyRoute
+	}
+	if config.Period <= 0 {
+		config.Period = constants.DefaultRateLimitPeriod
+	}
+	if config.Burst <= 0 {
+		config.Burst = config.Rate
+	}
+	if config.StatusCode == 0 {
+		config.StatusCode = http.StatusTooManyRequests
+	}
+	if config.MaxKeys <= 0 {
+		config.MaxKeys = constants.DefaultRateLimitMaxKeys
+	}
+	if config.Backend == "" {
+		config.Backend = constants.RateLimitBackendLocal
+	}
+	if config.FailureMode == "" {
+		config.FailureMode = constants.RateLimitFailOpen
+	}
+	return config
+}
+
+// RateLimitMiddleware 限流中间件，所有规则都通过才放行
+// 响应中携带剩余令牌最少的规则的 RateLimit-* 头，被限流时额外携带 Retry-After
+// 限流存储不可用时，failure_mode 为 open 的规则放行，为 closed 的规则拒绝
+func RateLimitMiddleware(route string, rules []*rateLimitRule, next http.Handler) http.Handler {
+	if len(rules) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var strictest *ratelimit.Result
+		for _, rule := range rules {
+			result, err := rule.limiter.Allow(r.Context(), rateLimitKey(r, rule.config))
+			if err != nil {
+				metrics.ObserveRateLimitError(route, rule.name)
+				logger.Logger.Warn("rate limit backend unavailable",
+					zap.String("route", route),
+					zap.String("rule", rule.name),
+					zap.String("failure_mode", rule.config.FailureMode),
+					zap.Error(err))
+				if rule.config.FailureMode == constants.RateLimitFailClosed {
+					http.Error(w, http.StatusText(rule.config.StatusCode), rule.config.StatusCode)
+					return
+				}
+				continue
+			}
+			if !result.Allowed {
+				metrics.ObserveRateLimited(route, rule.name)
+				setRateLimitHeaders(w, result)
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				http.Error(w, http.StatusText(rule.config.StatusCode), rule.config.StatusCode)
+				return
+			}
+			if strictest == nil || result.Remaining < strictest.Remaining {
+				strictest = &result
+			}
+		}
+
+		if strictest != nil {
+			setRateLimitHeaders(w, *strictest)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, result ratelimit.Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// rateLimitKey 根据规则的限流维度获取请求的 key
+// 请求中没有对应的请求头或 claim 时退化为按客户端 IP 限流，避免绕过限流
+func rateLimitKey(r *http.Request, config model.RateLimitConfig) string {
+	switch config.Key {
+	case constants.RateLimitKeyIP:
+		return "ip:" + clientip.FromRequest(r)
+	case constants.RateLimitKeyHeader:
+		if v := r.Header.Get(config.Header); v != "" {
+			return "header:" + v
+		}
+	case constants.RateLimitKeyJWTClaim:
+		if v := jwtClaim(r, config.Claim); v != "" {
+			return "claim:" + v
+		}
+	default:
+		return constants.RateLimitKeyRoute
+	}
+	return "ip:" + clientip.FromRequest(r)
+}
+
+// jwtClaim 获取 JWT 认证中间件写入上下文的 claim
+// 只使用校验过签名的 claims，未经校验的 token 可以任意伪造 claim 绕过限流
+func jwtClaim(r *http.Request, claim string) string {
+	claims, ok := r.Context().Value("jwt_claims").(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	return auth.ClaimString(claims, claim)
+}
+
+// CORSMiddleware 跨域预检请求由网关直接响应，实际请求的跨域响应头由反向代理添加
+func CORSMiddleware(policy *proxy.CORSPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if proxy.IsCORSPreflight(r) {
+			policy.ServePreflight(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// redisDown 配置一个拒绝连接的 Redis 地址
+func redisDown(t *testing.T) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	ratelimit.SetRedis(model.RedisConfig{Addr: addr})
+	t.Cleanup(func() { ratelimit.SetRedis(model.RedisConfig{}) })
+}
+
+func TestRateLimitFailureMode(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	redisDown(t)
+
+	tests := []struct {
+		mode       string
+		statusCode int
+		want       int
+	}{
+		{mode: "", want: http.StatusOK}, // 默认 open
+		{mode: constants.RateLimitFailOpen, want: http.StatusOK},
+		{mode: constants.RateLimitFailClosed, want: http.StatusTooManyRequests},
+		{mode: constants.RateLimitFailClosed, statusCode: http.StatusServiceUnavailable, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		route := &model.Route{
+			Name: "orders",
+			RateLimits: []*model.RateLimitConfig{{
+				Rate:        10,
+				Backend:     constants.RateLimitBackendRedis,
+				FailureMode: tt.mode,
+				StatusCode:  tt.statusCode,
+			}},
+		}
+		handler := RateLimitMiddleware(route.Name, buildRateLimits(route, nil),
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+		if w.Code != tt.want {
+			t.Errorf("failure_mode %q: status = %d, want %d", tt.mode, w.Code, tt.want)
+		}
+	}
+}
+
+func TestRateLimitJWTClaimKey(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	route := &model.Route{
+		Name: "orders",
+		RateLimits: []*model.RateLimitConfig{{
+			Key:   constants.RateLimitKeyJWTClaim,
+			Claim: "sub",
+			Rate:  1,
+			Burst: 2,
+		}},
+	}
+	handler := RateLimitMiddleware(route.Name, buildRateLimits(route, nil),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// 未校验签名的 token 不能用于区分限流 key，每次伪造不同的 sub 仍然共享同一个客户端 IP 的令牌桶
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		r.Header.Set("Authorization", "Bearer "+unsignedToken(t, map[string]interface{}{"sub": fmt.Sprintf("user-%d", i)}))
+		if code := serve(r); code != want {
+			t.Errorf("forged token %d: status = %d, want %d", i, code, want)
+		}
+	}
+
+	// 认证中间件写入上下文的 claims 按 claim 值区分令牌桶
+	for _, sub := range []string{"alice", "bob"} {
+		r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		r = r.WithContext(context.WithValue(r.Context(), "jwt_claims", map[string]interface{}{"sub": sub}))
+		if code := serve(r); code != http.StatusOK {
+			t.Errorf("verified sub %s: status = %d, want %d", sub, code, http.StatusOK)
+		}
+	}
+}
+
+func TestRateLimitJWTClaimRequiresJWTAuth(t *testing.T) {
+	route := &model.Route{
+		Name:        "orders",
+		Path:        "/orders",
+		MatchType:   "prefix",
+		Upstreams:   []*model.UpstreamsConfig{{Host: "http://127.0.0.1:8080"}},
+		LoadBalance: model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin},
+		RateLimits: []*model.RateLimitConfig{{
+			Key:   constants.RateLimitKeyJWTClaim,
+			Claim: "sub",
+			Rate:  1,
+		}},
+	}
+	if _, err := NewRouter([]*model.Route{route}); err == nil || !strings.Contains(err.Error(), "rate_limits[0].key") {
+		t.Errorf("err = %v, want rate_limits[0].key error", err)
+	}
+
+	route.Auth = &model.AuthConfig{
+		Type: constants.AuthTypeJWT,
+		JWT:  &model.JWTConfig{Keys: []model.JWTKeyConfig{{Secret: testJWTSecret}}},
+	}
+	router, err := NewRouter([]*model.Route{route})
+	if err != nil {
+		t.Fatalf("route with jwt auth: %v", err)
+	}
+	router.Stop()
+}
+
+// unsignedToken 伪造的 token，签名无效
+func unsignedToken(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + ".forged"
+}
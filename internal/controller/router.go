@@ -3,17 +3,25 @@ package controller
 import (
 	"context"
 	"fmt"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/discovery"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/metrics"
 	"github.com/lccxxo/bailuoli/internal/proxy/lb/circuit_breaker"
 	"net/http"
 	"net/url"
+	"reflect"
 	"regexp"
 	"sync"
+	"time"
 
 	"github.com/lccxxo/bailuoli/internal/match"
 	"github.com/lccxxo/bailuoli/internal/model"
 	"github.com/lccxxo/bailuoli/internal/proxy"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb"
 	"github.com/lccxxo/bailuoli/internal/proxy/lb/healthy"
 	"github.com/lccxxo/bailuoli/internal/validator"
+	"go.uber.org/zap"
 )
 
 // 路由匹配规则
@@ -37,61 +45,182 @@ func CreateMatcher(route *model.Route) (match.Matcher, error) {
 }
 
 type Router struct {
-	Routes         []*model.Route                  // 路由表
-	proxies        map[string]http.Handler         // 存储的是路由名称 -》反向代理实例
-	healthCheckers map[string]*healthy.Checker     // 路由名称 -> 健康检查器
-	validator      validator.Validator             // 验证责任链
-	breakerManager *circuit_breaker.BreakerManager // 熔断器管理器
+	Routes         []*model.Route                            // 路由表
+	proxies        map[string]http.Handler                   // 存储的是路由名称 -》反向代理实例
+	lbProxies      map[string]*proxy.LoadBalanceReverseProxy // 路由名称 -> 负载均衡反向代理
+	healthCheckers map[string]*healthy.Checker               // 路由名称 -> 健康检查器
+	passiveChecker map[string]*healthy.PassiveChecker        // 路由名称 -> 被动健康检查器
+	discoveries    map[string]context.CancelFunc             // 路由名称 -> 服务发现监听的取消函数
+	rateLimits     map[string]*rateLimitRule                 // 路由名称/规则名称 -> 限流规则
+	auths          map[string]*routeAuth                     // 路由名称 -> 认证器
+	validator      validator.Validator                       // 验证责任链
+	breakerManager *circuit_breaker.BreakerManager           // 熔断器管理器
+	offline        bool                                      // 离线模式，不启动健康检查、服务发现等后台协程
 	mu             sync.RWMutex
 }
 
-func NewRouter(routes []*model.Route) *Router {
+func NewRouter(routes []*model.Route) (*Router, error) {
+	return newRouter(routes, false)
+}
+
+// NewOfflineRouter 创建离线路由，只用于校验配置和匹配请求（validate、routes、match 命令）
+// 不启动主动/被动健康检查和服务发现监听，也不会向上游发送探测请求
+func NewOfflineRouter(routes []*model.Route) (*Router, error) {
+	return newRouter(routes, true)
+}
+
+func newRouter(routes []*model.Route, offline bool) (*Router, error) {
 	r := &Router{
 		proxies:        make(map[string]http.Handler),
 		validator:      validator.NewValidationChain(),
 		breakerManager: circuit_breaker.NewBreakerManager(),
+		offline:        offline,
 	}
+	r.breakerManager.AddListener(func(route, upstream string, state circuit_breaker.State) {
+		metrics.ObserveBreakerTransition(route, upstream, state.String())
+	})
 	if err := r.UpdateRoutes(routes); err != nil {
-		return nil
+		return nil, err
 	}
-	return r
+	return r, nil
 }
 
+// UpdateRoutes 热更新路由表，失败时保留旧路由表
 func (r *Router) UpdateRoutes(newRoutes []*model.Route) error {
+	update, err := r.PrepareRoutes(newRoutes)
+	if err != nil {
+		return err
+	}
+	update.Commit()
+	return nil
+}
+
+// RouteUpdate 已创建但尚未生效的路由表
+// 创建时不启动任何协程，Commit 替换路由表后才启动健康检查和服务发现
+type RouteUpdate struct {
+	router          *Router
+	routes          []*model.Route
+	proxies         map[string]http.Handler
+	lbProxies       map[string]*proxy.LoadBalanceReverseProxy
+	checkers        map[string]*healthy.Checker
+	passiveCheckers map[string]*healthy.PassiveChecker
+	providers       map[string]discovery.Provider
+	rateLimits      map[string]*rateLimitRule
+	auths           map[string]*routeAuth
+}
+
+// PrepareRoutes 校验并创建所有路由的代理、认证器和健康检查器，不影响当前路由表
+// 任意路由失败时释放已创建的资源；多个配置需要一起生效时（如热更新），全部创建成功后再调用 Commit
+func (r *Router) PrepareRoutes(newRoutes []*model.Route) (_ *RouteUpdate, err error) {
 	// 1. 验证新配置合法性
 	for _, route := range newRoutes {
 		if err := r.validator.Validate(route); err != nil {
-			return fmt.Errorf("invalid route %s: %w", route.Name, err)
+			return nil, fmt.Errorf("invalid route %s: %w", route.Name, err)
 		}
 	}
 
 	// 创建新的转发路由映射
 	proxies := make(map[string]http.Handler)
+	lbProxies := make(map[string]*proxy.LoadBalanceReverseProxy)
 	// 创建新健康检查器
 	newCheckers := make(map[string]*healthy.Checker)
-	// 创建新的熔断器
+	newPassiveCheckers := make(map[string]*healthy.PassiveChecker)
+	providers := make(map[string]discovery.Provider)
+	newRateLimits := make(map[string]*rateLimitRule)
+	newAuths := make(map[string]*routeAuth)
+	r.mu.RLock()
+	oldRateLimits := r.rateLimits
+	oldProxies := r.lbProxies
+	oldRoutes := make(map[string]*model.Route, len(r.Routes))
+	for _, route := range r.Routes {
+		oldRoutes[route.Name] = route
+	}
+	r.mu.RUnlock()
 
-	for _, route := range newRoutes {
-		for _, upstream := range route.Upstreams {
-			key := upstream.Host + upstream.Path
-			r.breakerManager.SetBreaker(key, &upstream.CircuitBreakerConfig)
+	// 创建失败时释放已创建的认证器
+	defer func() {
+		if err == nil {
+			return
 		}
-	}
+		for _, ra := range newAuths {
+			ra.close()
+		}
+	}()
 
 	for _, route := range newRoutes {
 		matcher, err := CreateMatcher(route)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		route.Matcher = matcher
-		proxies[route.Name] = proxy.NewLoadBalanceReverseProxy(route.LoadBalance, route.Upstreams, r.breakerManager)
+		p := proxy.NewLoadBalanceReverseProxy(route.Name, route.LoadBalance, route.Upstreams, r.breakerManager)
+		if p == nil {
+			return nil, fmt.Errorf("invalid route %s: unknown load balance strategy %q", route.Name, route.LoadBalance.Strategy)
+		}
+		if route.Discovery != nil {
+			p.SetDefaultBreakerConfig(route.Discovery.CircuitBreakerConfig)
+			p.SetDefaultTLSConfig(route.Discovery.TLS)
+			inheritDiscovered(p, route, oldRoutes[route.Name], oldProxies[route.Name])
+		}
+		inheritBalancer(p, oldProxies[route.Name])
+		p.SetRetryPolicy(route.Retry)
+		p.SetTimeoutConfig(route.Timeout)
+		cors, err := proxy.NewCORSPolicy(route.CORS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %s: cors: %w", route.Name, err)
+		}
+		p.SetCORSPolicy(cors)
+
+		provider, err := discovery.NewProvider(route)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %s: %w", route.Name, err)
+		}
+		providers[route.Name] = provider
+		lbProxies[route.Name] = p
+
+		// 限流规则（配置未变化的规则保留原有计数）
+		rules := buildRateLimits(route, oldRateLimits)
+		for _, rule := range rules {
+			newRateLimits[rule.id] = rule
+		}
+
+		// 认证
+		ra, err := newRouteAuth(route)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %s: %w", route.Name, err)
+		}
+		if ra != nil {
+			newAuths[route.Name] = ra
+		}
+		handler := AuthMiddleware(route, ra, RateLimitMiddleware(route.Name, rules, p))
+
+		// 跨域预检请求不携带凭证，需要在认证之前响应
+		if cors != nil {
+			handler = CORSMiddleware(cors, handler)
+		}
+
+		// IP 访问控制
+		ir, err := newIPRestriction(route)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %s: %w", route.Name, err)
+		}
+		if ir != nil {
+			handler = IPRestrictionMiddleware(route.Name, ir, handler)
+		}
+		proxies[route.Name] = IdentityHeadersMiddleware(handler)
 	}
 
 	for _, route := range newRoutes {
-		// 转换上游地址
-		upstreams := convertToURLs(route.Upstreams)
+		// 转换上游地址（服务发现的路由使用继承的节点）
+		upstreams, err := convertToURLs(route.Upstreams)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %s: %w", route.Name, err)
+		}
+		if route.Discovery != nil {
+			upstreams = lbProxies[route.Name].LoadBalancer().Upstreams()
+		}
 
-		// 创建健康检查器
+		// 创建健康检查器（Commit 后启动）
 		checker := healthy.NewChecker(model.HealthyConfig{
 			Interval:           route.LoadBalance.HealthyCheck.Interval,
 			Timeout:            route.LoadBalance.HealthyCheck.Timeout,
@@ -100,61 +229,395 @@ func (r *Router) UpdateRoutes(newRoutes []*model.Route) error {
 			HealthyThreshold:   route.LoadBalance.HealthyCheck.HealthyThreshold,
 			UnhealthyThreshold: route.LoadBalance.HealthyCheck.UnhealthyThreshold,
 		})
-		ctx, cancel := context.WithCancel(context.Background())
 		checker.UpdateUpstreams(upstreams)
-		go checker.Run(ctx)
-
-		checker.Cancel = cancel
 		newCheckers[route.Name] = checker
+		lbProxies[route.Name].SetHealthChecker(checker)
 
-		// 创建熔断器
+		// 创建被动健康检查器
+		if route.LoadBalance.OutlierDetection.Enable {
+			passive := healthy.NewPassiveChecker(route.LoadBalance.OutlierDetection)
+			passive.UpdateUpstreams(upstreams)
+			newPassiveCheckers[route.Name] = passive
+			lbProxies[route.Name].SetPassiveChecker(passive)
+		}
+	}
+
+	return &RouteUpdate{
+		router:          r,
+		routes:          newRoutes,
+		proxies:         proxies,
+		lbProxies:       lbProxies,
+		checkers:        newCheckers,
+		passiveCheckers: newPassiveCheckers,
+		providers:       providers,
+		rateLimits:      newRateLimits,
+		auths:           newAuths,
+	}, nil
+}
+
+// Commit 原子替换路由表，启动新路由的健康检查和服务发现，停止旧路由的协程并释放旧的认证器
+func (u *RouteUpdate) Commit() {
+	r := u.router
+	newRoutes, lbProxies := u.routes, u.lbProxies
+	newCheckers, newPassiveCheckers, providers := u.checkers, u.passiveCheckers, u.providers
+	newDiscoveries := make(map[string]context.CancelFunc)
+
+	// 更新熔断器，配置未变化的熔断器保留原状态
+	// 服务发现的节点（包括继承的节点）在转发时按 discovery.circuit_breaker 创建熔断器
+	usedBreakers := make(map[string]bool)
+	for _, route := range newRoutes {
+		for _, upstream := range route.Upstreams {
+			r.breakerManager.SetBreaker(route.Name, upstream.Host+upstream.Path, &upstream.CircuitBreakerConfig)
+		}
+		for _, addr := range lbProxies[route.Name].LoadBalancer().Upstreams() {
+			usedBreakers[circuit_breaker.BreakerKey(route.Name, addr.String())] = true
+		}
+	}
 
+	// 协程的取消函数在替换前设置，替换后立即调用 Stop 也能停止
+	checkerCtx := make(map[string]context.Context, len(newCheckers))
+	for name, checker := range newCheckers {
+		checkerCtx[name], checker.Cancel = context.WithCancel(context.Background())
+	}
+	passiveCtx := make(map[string]context.Context, len(newPassiveCheckers))
+	for name, passive := range newPassiveCheckers {
+		passiveCtx[name], passive.Cancel = context.WithCancel(context.Background())
+	}
+	discoveryCtx := make(map[string]context.Context, len(providers))
+	for name := range providers {
+		discoveryCtx[name], newDiscoveries[name] = context.WithCancel(context.Background())
 	}
 
 	// 2. 原子化替换路由表
 	r.mu.Lock()
+	oldDiscoveries := r.discoveries
+	oldAuths := r.auths
+	r.discoveries = newDiscoveries
 	r.Routes = newRoutes
-	r.proxies = proxies
+	r.proxies = u.proxies
+	r.lbProxies = lbProxies
+	r.rateLimits = u.rateLimits
+	r.auths = u.auths
 
 	oldHealthCheckers := r.healthCheckers
+	oldPassiveCheckers := r.passiveChecker
 
 	r.healthCheckers = newCheckers
+	r.passiveChecker = newPassiveCheckers
 	r.mu.Unlock()
 
-	//  清理旧的健康检查
+	//  清理旧的健康检查、服务发现和认证器
 	for _, cancel := range oldHealthCheckers {
 		cancel.Cancel()
 	}
+	for _, cancel := range oldPassiveCheckers {
+		cancel.Cancel()
+	}
+	for _, cancel := range oldDiscoveries {
+		cancel()
+	}
+	for _, ra := range oldAuths {
+		ra.close()
+	}
+	// 删除的路由和上游节点不再保留熔断器
+	r.breakerManager.RemoveUnused(usedBreakers)
 
-	return nil
+	if r.offline {
+		return
+	}
+
+	// 关闭不再使用的上游连接池（全局共享，离线路由不处理）
+	proxies := make([]*proxy.LoadBalanceReverseProxy, 0, len(lbProxies))
+	for _, p := range lbProxies {
+		proxies = append(proxies, p)
+	}
+	proxy.CloseUnusedTransports(proxies)
+
+	// 3. 启动健康检查并订阅服务发现（路由表替换后才能同步新的健康检查器）
+	// 监听协程绑定到创建它的代理，已取消的协程读到的旧节点列表不会应用到新的代理
+	for name, checker := range newCheckers {
+		go checker.Run(checkerCtx[name])
+	}
+	for name, passive := range newPassiveCheckers {
+		go passive.Run(passiveCtx[name])
+	}
+	for name, provider := range providers {
+		go func(name string, p *proxy.LoadBalanceReverseProxy, updates <-chan []*url.URL) {
+			for upstreams := range updates {
+				r.applyUpstreams(name, p, upstreams)
+			}
+		}(name, lbProxies[name], provider.Watch(discoveryCtx[name]))
+	}
 }
 
 // MatchRoute 路由匹配规则
+// match_claims 需要校验 JWT（可能等待拉取 JWKS），在释放读锁后执行，避免阻塞路由热更新和其他请求
 func (r *Router) MatchRoute(req *http.Request) (*model.Route, http.Handler) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	type candidate struct {
+		route   *model.Route
+		handler http.Handler
+		auth    *routeAuth
+	}
 
-	// 匹配路由方法
+	r.mu.RLock()
+	var candidates []candidate
 	for _, route := range r.Routes {
-		if route.Method != "" && route.Method != req.Method {
+		// 匹配路由方法
+		// 跨域预检请求按请求的方法（Access-Control-Request-Method）匹配
+		if route.Method != "" && route.Method != req.Method &&
+			!(route.CORS != nil && proxy.IsCORSPreflight(req) && req.Header.Get("Access-Control-Request-Method") == route.Method) {
+			continue
+		}
+
+		if !route.Matcher.Match(req.URL.Path) {
 			continue
 		}
 
-		// 如果匹配上则返回
-		if route.Matcher.Match(req.URL.Path) {
-			return route, r.proxies[route.Name]
+		candidates = append(candidates, candidate{route: route, handler: r.proxies[route.Name], auth: r.auths[route.Name]})
+		// 之后的路由只有在前面的路由 claim 不匹配时才会用到
+		if len(route.MatchClaims) == 0 {
+			break
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, c := range candidates {
+		// 根据 JWT claim 匹配，token 无效或不满足时继续匹配下一个路由
+		if len(c.route.MatchClaims) > 0 && !c.auth.matchClaims(req, c.route.MatchClaims) {
+			continue
 		}
+		return c.route, c.handler
 	}
 
 	return nil, nil
 }
 
+// inheritBalancer 热更新时继承旧负载均衡器的状态（加权轮询的当前权重），避免分布重新开始
+func inheritBalancer(p, old *proxy.LoadBalanceReverseProxy) {
+	if old == nil {
+		return
+	}
+	wrr, ok := p.LoadBalancer().(*lb.WeightRoundRobinLoadBalancer)
+	if !ok {
+		return
+	}
+	if prev, ok := old.LoadBalancer().(*lb.WeightRoundRobinLoadBalancer); ok {
+		wrr.Inherit(prev)
+	}
+}
+
+// inheritDiscovered 服务发现配置未变化时继承旧代理当前的节点，避免热更新后到首次发现结果返回前没有可用节点
+func inheritDiscovered(p *proxy.LoadBalanceReverseProxy, route, oldRoute *model.Route, old *proxy.LoadBalanceReverseProxy) {
+	if old == nil || oldRoute == nil || oldRoute.Discovery == nil || !reflect.DeepEqual(*oldRoute.Discovery, *route.Discovery) {
+		return
+	}
+	for _, u := range old.LoadBalancer().Upstreams() {
+		p.AddUpstream(u)
+	}
+}
+
 // 辅助函数：转换配置到URL列表
-func convertToURLs(upstreams []*model.UpstreamsConfig) []*url.URL {
+func convertToURLs(upstreams []*model.UpstreamsConfig) ([]*url.URL, error) {
 	var urls []*url.URL
 	for _, u := range upstreams {
-		parsed, _ := url.Parse(u.Host + u.Path)
+		parsed, err := url.Parse(u.Host + u.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream url %q: %w", u.Host+u.Path, err)
+		}
 		urls = append(urls, parsed)
 	}
-	return urls
+	return urls, nil
+}
+
+// Proxy 获取路由对应的负载均衡反向代理
+func (r *Router) Proxy(name string) (*proxy.LoadBalanceReverseProxy, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.lbProxies[name]
+	return p, ok
+}
+
+// HealthChecker 获取路由的主动健康检查器（未启用时返回 nil）
+func (r *Router) HealthChecker(name string) *healthy.Checker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.healthCheckers[name]
+}
+
+// PassiveChecker 获取路由的被动健康检查器（未启用时返回 nil）
+func (r *Router) PassiveChecker(name string) *healthy.PassiveChecker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.passiveChecker[name]
+}
+
+// BreakerManager 获取熔断器管理器
+func (r *Router) BreakerManager() *circuit_breaker.BreakerManager {
+	return r.breakerManager
+}
+
+// GetRoutes 获取当前生效的路由表
+func (r *Router) GetRoutes() []*model.Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Routes
+}
+
+// AddUpstream 为路由动态添加上游节点，并同步到健康检查器
+func (r *Router) AddUpstream(name string, upstream *url.URL) error {
+	p, ok := r.Proxy(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", constants.ErrRouteNotFound, name)
+	}
+
+	p.AddUpstream(upstream)
+	r.syncCheckers(name, p.LoadBalancer().Upstreams())
+	return nil
+}
+
+// RemoveUpstream 从路由中动态移除上游节点，并同步到健康检查器
+func (r *Router) RemoveUpstream(name string, upstream *url.URL) error {
+	p, ok := r.Proxy(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", constants.ErrRouteNotFound, name)
+	}
+
+	p.RemoveUpstream(upstream)
+	r.syncCheckers(name, p.LoadBalancer().Upstreams())
+	return nil
+}
+
+// DrainUpstream 停止向上游节点分配新请求，并等待正在处理的请求完成或超时
+// 返回剩余未完成的请求数
+func (r *Router) DrainUpstream(ctx context.Context, name string, upstream *url.URL) (int64, error) {
+	if err := r.RemoveUpstream(name, upstream); err != nil {
+		return 0, err
+	}
+
+	p, _ := r.Proxy(name)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		inflight := p.Inflight(upstream)
+		if inflight == 0 {
+			return 0, nil
+		}
+		select {
+		case <-ctx.Done():
+			return inflight, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// UpstreamStatuses 获取所有路由上游节点的健康状态（实现 metrics.StatusSource）
+func (r *Router) UpstreamStatuses() []metrics.UpstreamStatus {
+	var statuses []metrics.UpstreamStatus
+	for _, route := range r.GetRoutes() {
+		p, ok := r.Proxy(route.Name)
+		if !ok {
+			continue
+		}
+		checker := r.HealthChecker(route.Name)
+		passive := r.PassiveChecker(route.Name)
+		for _, u := range p.LoadBalancer().Upstreams() {
+			statuses = append(statuses, metrics.UpstreamStatus{
+				Route:    route.Name,
+				Upstream: u.String(),
+				Healthy:  checker == nil || checker.IsHealthy(u.String()),
+				Ejected:  passive != nil && passive.IsEjected(u.String()),
+			})
+		}
+	}
+	return statuses
+}
+
+// BreakerStates 获取所有熔断器状态（实现 metrics.StatusSource）
+func (r *Router) BreakerStates() []metrics.BreakerStatus {
+	snapshot := r.breakerManager.Snapshot()
+	statuses := make([]metrics.BreakerStatus, 0, len(snapshot))
+	for _, breaker := range snapshot {
+		status := metrics.BreakerStatus{Route: breaker.Route, Upstream: breaker.Upstream}
+		switch breaker.State {
+		case circuit_breaker.StateOpen.String():
+			status.State = int(circuit_breaker.StateOpen)
+		case circuit_breaker.StateHalfOpen.String():
+			status.State = int(circuit_breaker.StateHalfOpen)
+		default:
+			status.State = int(circuit_breaker.StateClosed)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// applyUpstreams 将服务发现得到的节点列表与当前节点做差异比较，只添加/移除变化的节点
+func (r *Router) applyUpstreams(name string, p *proxy.LoadBalanceReverseProxy, upstreams []*url.URL) {
+	desired := make(map[string]*url.URL, len(upstreams))
+	for _, u := range upstreams {
+		desired[u.String()] = u
+	}
+
+	var added, removed int
+	current := make(map[string]bool)
+	for _, u := range p.LoadBalancer().Upstreams() {
+		current[u.String()] = true
+		if _, ok := desired[u.String()]; !ok {
+			p.RemoveUpstream(u)
+			removed++
+		}
+	}
+	for key, u := range desired {
+		if !current[key] {
+			p.AddUpstream(u)
+			added++
+		}
+	}
+	if added == 0 && removed == 0 {
+		return
+	}
+
+	// 代理已被热更新替换时不同步新路由的健康检查器
+	if current, ok := r.Proxy(name); ok && current == p {
+		r.syncCheckers(name, p.LoadBalancer().Upstreams())
+	}
+	logger.Logger.Info("discovered upstreams updated",
+		zap.String("route", name),
+		zap.Int("added", added),
+		zap.Int("removed", removed),
+		zap.Int("upstreams", len(upstreams)))
+}
+
+func (r *Router) syncCheckers(name string, upstreams []*url.URL) {
+	if checker := r.HealthChecker(name); checker != nil {
+		checker.UpdateUpstreams(upstreams)
+	}
+	if passive := r.PassiveChecker(name); passive != nil {
+		passive.UpdateUpstreams(upstreams)
+	}
+}
+
+// Stop 停止所有后台健康检查、服务发现，并释放认证器
+func (r *Router) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, checker := range r.healthCheckers {
+		checker.Cancel()
+	}
+	for _, checker := range r.passiveChecker {
+		checker.Cancel()
+	}
+	for _, cancel := range r.discoveries {
+		cancel()
+	}
+	for _, ra := range r.auths {
+		ra.close()
+	}
+	r.healthCheckers = nil
+	r.passiveChecker = nil
+	r.discoveries = nil
+	r.auths = nil
 }
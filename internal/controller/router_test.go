@@ -0,0 +1,375 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/auth"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb/circuit_breaker"
+	"github.com/lccxxo/bailuoli/internal/validator"
+	"go.uber.org/zap"
+)
+
+const testJWTSecret = "test-secret"
+
+// hs256Token 使用 testJWTSecret 签发 HS256 token
+func hs256Token(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	m := hmac.New(sha256.New, []byte(testJWTSecret))
+	m.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func jwtRoute(name string, matchClaims map[string]string) *model.Route {
+	return &model.Route{
+		Name:        name,
+		Path:        "/orders",
+		MatchType:   "prefix",
+		Upstreams:   []*model.UpstreamsConfig{{Host: "http://127.0.0.1:8080"}},
+		LoadBalance: model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin},
+		MatchClaims: matchClaims,
+		Auth: &model.AuthConfig{
+			Type: constants.AuthTypeJWT,
+			JWT:  &model.JWTConfig{Keys: []model.JWTKeyConfig{{Secret: testJWTSecret}}},
+		},
+	}
+}
+
+func TestMatchRouteByClaims(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	router, err := NewRouter([]*model.Route{
+		jwtRoute("orders-beta", map[string]string{"groups": "beta"}),
+		jwtRoute("orders-admin", map[string]string{"scope": "orders:admin", "iss": "https://issuer.example"}),
+		jwtRoute("orders", nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(router.Stop)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{name: "no token", want: "orders"},
+		{name: "claim matched", token: hs256Token(t, map[string]interface{}{"groups": []string{"dev", "beta"}, "exp": exp}), want: "orders-beta"},
+		{name: "all claims matched", token: hs256Token(t, map[string]interface{}{"scope": "orders:read orders:admin", "iss": "https://issuer.example", "exp": exp}), want: "orders-admin"},
+		{name: "partial match", token: hs256Token(t, map[string]interface{}{"scope": "orders:admin", "exp": exp}), want: "orders"},
+		{name: "claim not matched", token: hs256Token(t, map[string]interface{}{"groups": []string{"dev"}, "exp": exp}), want: "orders"},
+		// token 无效时不按 claim 匹配，交给后续路由的认证中间件拒绝
+		{name: "expired token", token: hs256Token(t, map[string]interface{}{"groups": "beta", "exp": time.Now().Add(-time.Hour).Unix()}), want: "orders"},
+		{name: "bad signature", token: hs256Token(t, map[string]interface{}{"groups": "beta", "exp": exp}) + "x", want: "orders"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			route, _ := router.MatchRoute(r)
+			if route == nil {
+				t.Fatal("no route matched")
+			}
+			if route.Name != tt.want {
+				t.Errorf("matched route %s, want %s", route.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchRouteDoesNotBlockUpdates(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	fetching := make(chan struct{}, 1)
+	release := make(chan struct{})
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case fetching <- struct{}{}:
+		default:
+		}
+		<-release
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer jwks.Close()
+	defer close(release)
+
+	routes := func() []*model.Route {
+		route := jwtRoute("orders-beta", map[string]string{"groups": "beta"})
+		route.Auth.JWT = &model.JWTConfig{JWKSURL: jwks.URL}
+		return []*model.Route{route, jwtRoute("orders", nil)}
+	}
+	router, err := NewRouter(routes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(router.Stop)
+
+	// 匹配 match_claims 时等待拉取 JWKS
+	matched := make(chan string, 1)
+	go func() {
+		r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		r.Header.Set("Authorization", "Bearer "+hs256Token(t, map[string]interface{}{"groups": "beta"}))
+		route, _ := router.MatchRoute(r)
+		matched <- route.Name
+	}()
+	select {
+	case <-fetching:
+	case <-time.After(3 * time.Second):
+		t.Fatal("jwks not fetched")
+	}
+
+	// 等待 JWKS 期间热更新不会被阻塞
+	updated := make(chan error, 1)
+	go func() { updated <- router.UpdateRoutes(routes()) }()
+	select {
+	case err := <-updated:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("UpdateRoutes blocked by a pending jwks fetch")
+	}
+
+	release <- struct{}{}
+	if name := <-matched; name != "orders" {
+		t.Errorf("matched route %s, want orders", name)
+	}
+}
+
+func TestActiveHealthCheckEnabledByDefault(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	router, err := NewRouter([]*model.Route{jwtRoute("orders", nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(router.Stop)
+
+	// 未配置 healthy_check 的路由同样启用主动健康检查
+	if router.HealthChecker("orders") == nil {
+		t.Error("active health checker not started")
+	}
+	if router.PassiveChecker("orders") != nil {
+		t.Error("outlier detection started without being enabled")
+	}
+}
+
+func TestOfflineRouterStartsNoWatchers(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+
+	checked := jwtRoute("orders", nil)
+	checked.Upstreams = []*model.UpstreamsConfig{{Host: srv.URL}}
+	checked.LoadBalance.HealthyCheck = model.HealthyConfig{Interval: 10 * time.Millisecond, Path: "/health"}
+	checked.LoadBalance.OutlierDetection = model.OutlierDetectionConfig{Enable: true, Interval: 10 * time.Millisecond}
+	discovered := jwtRoute("users", nil)
+	discovered.Path = "/users"
+	discovered.Upstreams = nil
+	discovered.Discovery = &model.DiscoveryConfig{Type: constants.DiscoveryConsul, Service: "users", Address: srv.URL}
+
+	router, err := NewOfflineRouter([]*model.Route{checked, discovered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Stop()
+
+	// 离线路由同样可以匹配请求
+	if route, _ := router.MatchRoute(httptest.NewRequest(http.MethodGet, "/users/1", nil)); route == nil || route.Name != "users" {
+		t.Errorf("matched route %v, want users", route)
+	}
+
+	// 不发送健康检查请求，也不查询服务发现
+	time.Sleep(100 * time.Millisecond)
+	if n := hits.Load(); n != 0 {
+		t.Errorf("%d requests sent by the offline router, want 0", n)
+	}
+}
+
+// skipValidation 跳过配置校验，用于构造校验之后才会失败的路由
+type skipValidation struct {
+	validator.BaseValidator
+}
+
+func (*skipValidation) Validate(*model.Route) error { return nil }
+
+func TestUpdateRoutesFailureStartsNothing(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+
+	credentials := basicCredentials(t, "alice", "secret")
+	current := jwtRoute("orders", nil)
+	current.Auth = &model.AuthConfig{Type: constants.AuthTypeBasic, Basic: &model.BasicAuthConfig{CredentialsFile: credentials}}
+	router, err := NewRouter([]*model.Route{current})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(router.Stop)
+	store := router.auths["orders"].credentials
+
+	checked := jwtRoute("orders", nil)
+	checked.Upstreams = []*model.UpstreamsConfig{{Host: srv.URL}}
+	checked.LoadBalance.HealthyCheck = model.HealthyConfig{Interval: 10 * time.Millisecond, Path: "/health"}
+	checked.LoadBalance.OutlierDetection = model.OutlierDetectionConfig{Enable: true, Interval: 10 * time.Millisecond}
+	bobCredentials := basicCredentials(t, "bob", "secret")
+	checked.Auth = &model.AuthConfig{Type: constants.AuthTypeBasic, Basic: &model.BasicAuthConfig{CredentialsFile: bobCredentials}}
+	discovered := jwtRoute("users", nil)
+	discovered.Upstreams = nil
+	discovered.Discovery = &model.DiscoveryConfig{Type: constants.DiscoveryConsul, Service: "users", Address: srv.URL}
+	broken := jwtRoute("broken", nil)
+	broken.Auth.Type = "unknown"
+
+	bobStore, err := auth.GetCredentialStore(bobCredentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 后面的路由创建失败时，前面路由的健康检查和服务发现不会启动
+	router.validator = &skipValidation{}
+	if err := router.UpdateRoutes([]*model.Route{checked, discovered, broken}); err == nil {
+		t.Fatal("UpdateRoutes succeeded with an unknown auth type")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := hits.Load(); n != 0 {
+		t.Errorf("%d requests sent after a failed update, want 0", n)
+	}
+	if route, _ := router.MatchRoute(httptest.NewRequest(http.MethodGet, "/orders", nil)); route != current {
+		t.Errorf("matched route %v, want the route before the failed update", route)
+	}
+
+	// 失败时保留旧的认证器，新创建的认证器已释放
+	if got, err := auth.GetCredentialStore(credentials); err != nil || got != store {
+		t.Errorf("credential store of the current route replaced after a failed update")
+	} else {
+		got.Close()
+	}
+	bobStore.Close()
+	got, err := auth.GetCredentialStore(bobCredentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	if got == bobStore {
+		t.Error("credential store created by the failed update not released")
+	}
+}
+
+func TestUpdateRoutesReleasesAuth(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	credentials := basicCredentials(t, "alice", "secret")
+	basic := func() *model.Route {
+		route := jwtRoute("orders", nil)
+		route.Auth = &model.AuthConfig{Type: constants.AuthTypeBasic, Basic: &model.BasicAuthConfig{CredentialsFile: credentials}}
+		return route
+	}
+	router, err := NewRouter([]*model.Route{basic()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(router.Stop)
+	store := router.auths["orders"].credentials
+
+	// 凭证文件未变化时热更新继续使用同一个存储
+	if err := router.UpdateRoutes([]*model.Route{basic()}); err != nil {
+		t.Fatal(err)
+	}
+	if router.auths["orders"].credentials != store {
+		t.Error("credential store reloaded although the file is unchanged")
+	}
+
+	// 不再使用的凭证文件停止监听
+	if err := router.UpdateRoutes([]*model.Route{jwtRoute("orders", nil)}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := auth.GetCredentialStore(credentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	if got == store {
+		t.Error("credential store of the replaced route not released")
+	}
+}
+
+func TestBreakersPerRoute(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	upstream := "http://127.0.0.1:8080"
+	routes := func(names ...string) []*model.Route {
+		var routes []*model.Route
+		for i, name := range names {
+			route := jwtRoute(name, nil)
+			route.Path = "/" + name
+			route.Upstreams = []*model.UpstreamsConfig{{
+				Host:                 upstream,
+				CircuitBreakerConfig: model.CircuitBreakerConfig{ConsecutiveErrorTrigger: int64(i + 1), OpenStateTimeout: time.Second},
+			}}
+			routes = append(routes, route)
+		}
+		return routes
+	}
+	breaker := func(router *Router, route string) *circuit_breaker.CircuitBreaker {
+		b, _ := router.BreakerManager().Breaker(route, upstream)
+		return b
+	}
+
+	router, err := NewRouter(routes("orders", "users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(router.Stop)
+
+	// 同一个上游节点在不同路由中使用各自的熔断器
+	orders, users := breaker(router, "orders"), breaker(router, "users")
+	if orders == nil || users == nil || orders == users {
+		t.Fatalf("breakers orders = %p users = %p, want two breakers", orders, users)
+	}
+
+	// 配置未变化时热更新保留原熔断器
+	if err := router.UpdateRoutes(routes("orders", "users")); err != nil {
+		t.Fatal(err)
+	}
+	if breaker(router, "orders") != orders || breaker(router, "users") != users {
+		t.Error("breakers recreated although the config is unchanged")
+	}
+
+	// 删除的路由不再保留熔断器
+	if err := router.UpdateRoutes(routes("orders")); err != nil {
+		t.Fatal(err)
+	}
+	if breaker(router, "users") != nil {
+		t.Error("breaker of the removed route not removed")
+	}
+
+	// 移除的上游节点不再保留熔断器
+	u, _ := url.Parse(upstream)
+	if err := router.RemoveUpstream("orders", u); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot := router.BreakerManager().Snapshot(); len(snapshot) != 0 {
+		t.Errorf("breakers after removing the upstream = %v, want none", snapshot)
+	}
+}
@@ -1,3 +1,170 @@
 package discovery
 
-// Consul is a struct that holds the configuration for the Consul client
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+)
+
+// Consul 通过阻塞查询（blocking query）监听 consul 中服务的健康实例
+type Consul struct {
+	client  *http.Client
+	address string
+	config  model.DiscoveryConfig
+}
+
+// consul /v1/health/service 接口返回的实例信息
+type consulServiceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+func NewConsul(config model.DiscoveryConfig) *Consul {
+	if config.Address == "" {
+		config.Address = constants.DefaultConsulAddress
+	}
+	if config.WaitTime <= 0 {
+		config.WaitTime = constants.DefaultConsulWaitTime
+	}
+	if config.Scheme == "" {
+		config.Scheme = "http"
+	}
+
+	return &Consul{
+		// 超时时间需要大于阻塞查询的等待时间（consul 会额外增加最多 wait/16 的抖动）
+		client:  &http.Client{Timeout: config.WaitTime + config.WaitTime/16 + 10*time.Second},
+		address: config.Address,
+		config:  config,
+	}
+}
+
+// Watch 持续监听服务实例变化，每次实例列表变化时发送新的节点列表，直到 ctx 结束
+func (c *Consul) Watch(ctx context.Context) <-chan []*url.URL {
+	ch := make(chan []*url.URL)
+	go func() {
+		defer close(ch)
+		c.watch(ctx, ch)
+	}()
+	return ch
+}
+
+func (c *Consul) watch(ctx context.Context, ch chan<- []*url.URL) {
+	var index uint64
+	var last []string
+	backoff := time.Second
+
+	for {
+		upstreams, newIndex, err := c.fetch(ctx, index)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Logger.Warn("consul discovery failed",
+				zap.String("service", c.config.Service),
+				zap.Duration("retry_after", backoff),
+				zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > constants.DefaultDiscoveryBackoff {
+				backoff = constants.DefaultDiscoveryBackoff
+			}
+			continue
+		}
+		backoff = time.Second
+
+		// index 回退（例如 consul 重启）时从头开始查询，index 必须大于0，避免退化为非阻塞查询
+		if newIndex < index {
+			newIndex = 0
+		}
+		if newIndex < 1 {
+			newIndex = 1
+		}
+		index = newIndex
+
+		keys := urlStrings(upstreams)
+		if !equalStrings(keys, last) {
+			last = keys
+			if !send(ctx, ch, upstreams) {
+				return
+			}
+		}
+	}
+}
+
+// fetch 执行一次阻塞查询，返回健康实例的地址和新的 index
+func (c *Consul) fetch(ctx context.Context, index uint64) ([]*url.URL, uint64, error) {
+	query := url.Values{}
+	query.Set("passing", "true")
+	query.Set("index", strconv.FormatUint(index, 10))
+	query.Set("wait", c.config.WaitTime.String())
+	if c.config.Tag != "" {
+		query.Set("tag", c.config.Tag)
+	}
+	if c.config.Datacenter != "" {
+		query.Set("dc", c.config.Datacenter)
+	}
+
+	reqURL := fmt.Sprintf("%s/v1/health/service/%s?%s", c.address, url.PathEscape(c.config.Service), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, index, err
+	}
+	if c.config.Token != "" {
+		req.Header.Set("X-Consul-Token", c.config.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, index, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, index, fmt.Errorf("consul responded with status %d", resp.StatusCode)
+	}
+
+	newIndex, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return nil, index, fmt.Errorf("invalid X-Consul-Index header: %w", err)
+	}
+
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, index, fmt.Errorf("decode consul response failed: %w", err)
+	}
+
+	upstreams := make([]*url.URL, 0, len(entries))
+	for _, entry := range entries {
+		// 服务未注册地址时使用节点地址
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		upstreams = append(upstreams, &url.URL{
+			Scheme: c.config.Scheme,
+			Host:   net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)),
+			Path:   c.config.Path,
+		})
+	}
+	return upstreams, newIndex, nil
+}
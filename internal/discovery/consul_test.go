@@ -0,0 +1,203 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+)
+
+// fakeConsul 模拟 consul 的 /v1/health/service/<service> 阻塞查询接口
+type fakeConsul struct {
+	mu        sync.Mutex
+	index     uint64
+	instances []fakeInstance
+	changed   chan struct{} // 数据变化时关闭并替换
+	indexes   []uint64      // 收到的查询 index
+	queries   []url.Values
+}
+
+type fakeInstance struct {
+	address string
+	port    int
+	tags    []string
+}
+
+func newFakeConsul(index uint64, instances ...fakeInstance) *fakeConsul {
+	return &fakeConsul{index: index, instances: instances, changed: make(chan struct{})}
+}
+
+// update 修改实例列表和 index，唤醒阻塞的查询
+func (c *fakeConsul) update(index uint64, instances ...fakeInstance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.index = index
+	c.instances = instances
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *fakeConsul) seenIndexes() []uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.indexes)
+}
+
+func (c *fakeConsul) query(i int) url.Values {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.queries[i]
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/health/service/orders" {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	index, _ := strconv.ParseUint(query.Get("index"), 10, 64)
+	wait, _ := time.ParseDuration(query.Get("wait"))
+
+	c.mu.Lock()
+	c.indexes = append(c.indexes, index)
+	c.queries = append(c.queries, query)
+	changed := c.changed
+	blocking := index > 0 && index >= c.index
+	c.mu.Unlock()
+
+	// index 未变化时阻塞到数据变化或等待超时
+	if blocking {
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var entries []map[string]interface{}
+	for _, inst := range c.instances {
+		if tag := query.Get("tag"); tag != "" && !slices.Contains(inst.tags, tag) {
+			continue
+		}
+		entries = append(entries, map[string]interface{}{
+			"Node":    map[string]interface{}{"Address": "192.0.2.1"},
+			"Service": map[string]interface{}{"Address": inst.address, "Port": inst.port, "Tags": inst.tags},
+		})
+	}
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(c.index, 10))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+func watchConsul(t *testing.T, server *fakeConsul, tag string) <-chan []*url.URL {
+	t.Helper()
+	logger.Logger = zap.NewNop()
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return NewConsul(model.DiscoveryConfig{
+		Type:     "consul",
+		Service:  "orders",
+		Tag:      tag,
+		Address:  srv.URL,
+		WaitTime: 5 * time.Second,
+	}).Watch(ctx)
+}
+
+func receive(t *testing.T, updates <-chan []*url.URL) []string {
+	t.Helper()
+	select {
+	case upstreams := <-updates:
+		return urlStrings(upstreams)
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for upstream update")
+		return nil
+	}
+}
+
+func expectUpstreams(t *testing.T, updates <-chan []*url.URL, want ...string) {
+	t.Helper()
+	if got := receive(t, updates); !equalStrings(got, want) {
+		t.Fatalf("upstreams = %v, want %v", got, want)
+	}
+}
+
+func TestConsulBlockingQuery(t *testing.T) {
+	server := newFakeConsul(10, fakeInstance{address: "10.0.0.1", port: 8080})
+	updates := watchConsul(t, server, "")
+
+	expectUpstreams(t, updates, "http://10.0.0.1:8080")
+
+	// 第二次查询携带上次返回的 index 并阻塞，数据变化后立即返回
+	waitForIndex(t, server, 10)
+	select {
+	case upstreams := <-updates:
+		t.Fatalf("unexpected update %v before data changed", upstreams)
+	case <-time.After(200 * time.Millisecond):
+	}
+	server.update(11, fakeInstance{address: "10.0.0.1", port: 8080}, fakeInstance{address: "", port: 9090})
+	// 服务未注册地址时使用节点地址
+	expectUpstreams(t, updates, "http://10.0.0.1:8080", "http://192.0.2.1:9090")
+
+	if got := server.seenIndexes(); got[0] != 0 {
+		t.Errorf("first query index = %d, want 0", got[0])
+	}
+	if q := server.query(0); q.Get("passing") != "true" {
+		t.Errorf("passing = %q, want true", q.Get("passing"))
+	}
+}
+
+func TestConsulIndexGoesBackwards(t *testing.T) {
+	server := newFakeConsul(100, fakeInstance{address: "10.0.0.1", port: 8080})
+	updates := watchConsul(t, server, "")
+	expectUpstreams(t, updates, "http://10.0.0.1:8080")
+	waitForIndex(t, server, 100)
+
+	// consul 重启后 index 回退，需要从头重新查询（index 不能为0，避免退化为非阻塞查询）
+	server.update(5, fakeInstance{address: "10.0.0.2", port: 8080})
+	expectUpstreams(t, updates, "http://10.0.0.2:8080")
+	waitForIndex(t, server, 1)
+	waitForIndex(t, server, 5)
+}
+
+func TestConsulTagFilter(t *testing.T) {
+	server := newFakeConsul(1,
+		fakeInstance{address: "10.0.0.1", port: 8080, tags: []string{"v1"}},
+		fakeInstance{address: "10.0.0.2", port: 8080, tags: []string{"v2"}},
+		fakeInstance{address: "10.0.0.3", port: 8080, tags: []string{"v1", "v2"}},
+	)
+	updates := watchConsul(t, server, "v2")
+	expectUpstreams(t, updates, "http://10.0.0.2:8080", "http://10.0.0.3:8080")
+
+	if tag := server.query(0).Get("tag"); tag != "v2" {
+		t.Errorf("tag = %q, want v2", tag)
+	}
+}
+
+// waitForIndex 等待 consul 收到携带指定 index 的查询
+func waitForIndex(t *testing.T, server *fakeConsul, index uint64) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if slices.Contains(server.seenIndexes(), index) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no query with index %d, got %v", index, server.seenIndexes())
+}
@@ -0,0 +1,342 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNS 周期性解析 A/AAAA 或 SRV 记录，刷新间隔遵循记录的 TTL（不小于 constants.MinDNSTTL）
+// 标准库的 net.Resolver 不返回 TTL，所以这里直接向 DNS 服务器发送查询
+type DNS struct {
+	name       string
+	recordType dnsmessage.Type
+	port       int
+	scheme     string
+	path       string
+	nameserver string
+	refresh    time.Duration
+	minTTL     time.Duration // TTL 小于该值时按该值刷新
+	timeout    time.Duration
+}
+
+func NewDNS(config model.DiscoveryConfig) *DNS {
+	d := &DNS{
+		name:       config.Name,
+		recordType: dnsmessage.TypeA,
+		port:       config.Port,
+		scheme:     config.Scheme,
+		path:       config.Path,
+		nameserver: config.Nameserver,
+		refresh:    config.RefreshInterval,
+		minTTL:     constants.MinDNSTTL,
+		timeout:    5 * time.Second,
+	}
+
+	if !strings.HasSuffix(d.name, ".") {
+		d.name += "."
+	}
+	switch strings.ToUpper(config.RecordType) {
+	case "AAAA":
+		d.recordType = dnsmessage.TypeAAAA
+	case "SRV":
+		d.recordType = dnsmessage.TypeSRV
+	}
+	if d.scheme == "" {
+		d.scheme = "http"
+	}
+	if d.refresh <= 0 {
+		d.refresh = constants.DefaultDNSRefreshInterval
+	}
+	if d.nameserver == "" {
+		d.nameserver = systemNameserver()
+	} else if _, _, err := net.SplitHostPort(d.nameserver); err != nil {
+		d.nameserver = net.JoinHostPort(d.nameserver, "53")
+	}
+	return d
+}
+
+func (d *DNS) Watch(ctx context.Context) <-chan []*url.URL {
+	ch := make(chan []*url.URL)
+
+	go func() {
+		defer close(ch)
+
+		var last []string
+		for {
+			wait := d.refresh
+			upstreams, ttl, err := d.resolve(ctx)
+			if err != nil {
+				// 解析失败时保留上一次的节点列表
+				logger.Logger.Warn("dns discovery failed", zap.String("name", d.name), zap.Error(err))
+			} else {
+				wait = d.interval(ttl)
+				keys := urlStrings(upstreams)
+				if !equalStrings(keys, last) {
+					last = keys
+					if !send(ctx, ch, upstreams) {
+						return
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+
+	return ch
+}
+
+// interval 根据记录的 TTL 计算下一次刷新间隔，没有 TTL 时使用 refresh_interval
+func (d *DNS) interval(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return d.refresh
+	}
+	return max(ttl, d.minTTL)
+}
+
+// resolve 解析节点列表，返回最小的 TTL 作为下一次刷新间隔
+func (d *DNS) resolve(ctx context.Context) ([]*url.URL, time.Duration, error) {
+	if d.recordType != dnsmessage.TypeSRV {
+		ips, ttl, err := d.lookupIP(ctx, d.name, d.recordType)
+		if err != nil {
+			return nil, 0, err
+		}
+		upstreams := make([]*url.URL, 0, len(ips))
+		for _, ip := range ips {
+			upstreams = append(upstreams, d.upstreamURL(ip.String(), d.port))
+		}
+		return upstreams, ttl, nil
+	}
+
+	msg, err := d.query(ctx, d.name, dnsmessage.TypeSRV)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 只使用优先级最高（Priority 最小）的一组记录
+	var srvs []*dnsmessage.SRVResource
+	var ttl uint32
+	for _, answer := range msg.Answers {
+		srv, ok := answer.Body.(*dnsmessage.SRVResource)
+		if !ok {
+			continue
+		}
+		ttl = minTTL(ttl, answer.Header.TTL)
+		if len(srvs) > 0 && srv.Priority > srvs[0].Priority {
+			continue
+		}
+		if len(srvs) > 0 && srv.Priority < srvs[0].Priority {
+			srvs = srvs[:0]
+		}
+		srvs = append(srvs, srv)
+	}
+
+	// 优先使用附加记录中的地址，没有时再单独解析目标主机
+	additional := make(map[string][]net.IP)
+	for _, res := range msg.Additionals {
+		switch body := res.Body.(type) {
+		case *dnsmessage.AResource:
+			additional[res.Header.Name.String()] = append(additional[res.Header.Name.String()], net.IP(body.A[:]))
+			ttl = minTTL(ttl, res.Header.TTL)
+		case *dnsmessage.AAAAResource:
+			additional[res.Header.Name.String()] = append(additional[res.Header.Name.String()], net.IP(body.AAAA[:]))
+			ttl = minTTL(ttl, res.Header.TTL)
+		}
+	}
+
+	var upstreams []*url.URL
+	for _, srv := range srvs {
+		target := srv.Target.String()
+		ips, ok := additional[target]
+		if !ok {
+			var targetTTL time.Duration
+			ips, targetTTL, err = d.lookupIP(ctx, target, dnsmessage.TypeA)
+			if err != nil {
+				return nil, 0, fmt.Errorf("resolve srv target %s failed: %w", target, err)
+			}
+			ttl = minTTL(ttl, uint32(targetTTL/time.Second))
+		}
+		for _, ip := range ips {
+			upstreams = append(upstreams, d.upstreamURL(ip.String(), int(srv.Port)))
+		}
+	}
+	return upstreams, time.Duration(ttl) * time.Second, nil
+}
+
+func (d *DNS) lookupIP(ctx context.Context, name string, qtype dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	msg, err := d.query(ctx, name, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ips []net.IP
+	var ttl uint32
+	for _, answer := range msg.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(body.A[:]))
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(body.AAAA[:]))
+		default:
+			continue
+		}
+		ttl = minTTL(ttl, answer.Header.TTL)
+	}
+	return ips, time.Duration(ttl) * time.Second, nil
+}
+
+// query 发送 DNS 查询，响应被截断时使用 TCP 重试
+func (d *DNS) query(ctx context.Context, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uint16(rand.Intn(1 << 16))
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	// EDNS0：声明支持 4096 字节的 UDP 响应
+	if err := builder.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(4096, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	if err := builder.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, err
+	}
+	packet, err := builder.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := d.exchange(ctx, "udp", packet)
+	if err == nil && msg.Header.Truncated {
+		msg, err = d.exchange(ctx, "tcp", packet)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.Header.ID != id {
+		return nil, errors.New("dns response id mismatch")
+	}
+	if msg.Header.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("dns query %s %s failed: %s", name, qtype, msg.Header.RCode)
+	}
+	return msg, nil
+}
+
+func (d *DNS) exchange(ctx context.Context, network string, packet []byte) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, d.nameserver)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	var resp []byte
+	if network == "tcp" {
+		// TCP 报文前两个字节为长度
+		frame := make([]byte, 2+len(packet))
+		binary.BigEndian.PutUint16(frame, uint16(len(packet)))
+		copy(frame[2:], packet)
+		if _, err := conn.Write(frame); err != nil {
+			return nil, err
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		resp = make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(packet); err != nil {
+			return nil, err
+		}
+		resp = make([]byte, 4096)
+		n, err := conn.Read(resp)
+		if err != nil {
+			return nil, err
+		}
+		resp = resp[:n]
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (d *DNS) upstreamURL(host string, port int) *url.URL {
+	return &url.URL{
+		Scheme: d.scheme,
+		Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:   d.path,
+	}
+}
+
+// minTTL 返回非零的较小值
+func minTTL(current, ttl uint32) uint32 {
+	if current == 0 || (ttl > 0 && ttl < current) {
+		return ttl
+	}
+	return current
+}
+
+// systemNameserver 读取 /etc/resolv.conf 中的第一个 DNS 服务器
+func systemNameserver() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "127.0.0.1:53"
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+	return "127.0.0.1:53"
+}
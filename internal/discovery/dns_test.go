@@ -0,0 +1,166 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNS 在 UDP 端口上响应 A 记录查询
+type fakeDNS struct {
+	conn    net.PacketConn
+	mu      sync.Mutex
+	ips     []string
+	ttl     uint32
+	rcode   dnsmessage.RCode
+	queries int
+}
+
+func newFakeDNS(t *testing.T, ttl uint32, ips ...string) *fakeDNS {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	d := &fakeDNS{conn: conn, ips: ips, ttl: ttl}
+	go d.serve()
+	return d
+}
+
+// update 修改解析结果和响应码
+func (d *fakeDNS) update(rcode dnsmessage.RCode, ips ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rcode = rcode
+	d.ips = ips
+}
+
+func (d *fakeDNS) queryCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.queries
+}
+
+func (d *fakeDNS) serve() {
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+			continue
+		}
+
+		d.mu.Lock()
+		d.queries++
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.Header.ID, Response: true, RCode: d.rcode},
+			Questions: query.Questions,
+		}
+		if d.rcode == dnsmessage.RCodeSuccess {
+			for _, ip := range d.ips {
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Class: dnsmessage.ClassINET, TTL: d.ttl},
+					Body:   &dnsmessage.AResource{A: netip.MustParseAddr(ip).As4()},
+				})
+			}
+		}
+		d.mu.Unlock()
+
+		packet, err := resp.Pack()
+		if err != nil {
+			continue
+		}
+		_, _ = d.conn.WriteTo(packet, addr)
+	}
+}
+
+func watchDNS(t *testing.T, server *fakeDNS, refresh time.Duration) <-chan []*url.URL {
+	t.Helper()
+	logger.Logger = zap.NewNop()
+	d := NewDNS(model.DiscoveryConfig{
+		Type:            "dns",
+		Name:            "orders.service.local",
+		Port:            8080,
+		Nameserver:      server.conn.LocalAddr().String(),
+		RefreshInterval: refresh,
+	})
+	d.timeout = time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return d.Watch(ctx)
+}
+
+func TestDNSRefresh(t *testing.T) {
+	// 记录没有 TTL 时按 refresh_interval 刷新
+	server := newFakeDNS(t, 0, "10.0.0.1", "10.0.0.2")
+	updates := watchDNS(t, server, 20*time.Millisecond)
+	expectUpstreams(t, updates, "http://10.0.0.1:8080", "http://10.0.0.2:8080")
+
+	server.update(dnsmessage.RCodeSuccess, "10.0.0.3")
+	expectUpstreams(t, updates, "http://10.0.0.3:8080")
+
+	// 解析失败时保留上一次的节点列表，恢复后推送新的节点列表
+	server.update(dnsmessage.RCodeServerFailure)
+	queries := server.queryCount()
+	for server.queryCount() < queries+3 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case upstreams := <-updates:
+		t.Fatalf("unexpected upstream update %v after dns failure", urlStrings(upstreams))
+	default:
+	}
+	server.update(dnsmessage.RCodeSuccess, "10.0.0.4")
+	expectUpstreams(t, updates, "http://10.0.0.4:8080")
+}
+
+func TestDNSRefreshFollowsTTL(t *testing.T) {
+	// 记录有 TTL 时按 TTL 刷新，不使用 refresh_interval
+	server := newFakeDNS(t, 60, "10.0.0.1")
+	updates := watchDNS(t, server, 20*time.Millisecond)
+	expectUpstreams(t, updates, "http://10.0.0.1:8080")
+
+	time.Sleep(200 * time.Millisecond)
+	if n := server.queryCount(); n != 1 {
+		t.Errorf("%d queries within the record ttl, want 1", n)
+	}
+}
+
+func TestDNSInterval(t *testing.T) {
+	d := NewDNS(model.DiscoveryConfig{Name: "orders.service.local", Nameserver: "127.0.0.1"})
+	if d.nameserver != "127.0.0.1:53" || d.name != "orders.service.local." {
+		t.Errorf("nameserver = %q name = %q", d.nameserver, d.name)
+	}
+
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{ttl: 0, want: constants.DefaultDNSRefreshInterval},
+		// TTL 过小时使用下限，避免频繁查询
+		{ttl: time.Second, want: constants.MinDNSTTL},
+		{ttl: constants.MinDNSTTL, want: constants.MinDNSTTL},
+		{ttl: time.Minute, want: time.Minute},
+	}
+	for _, tt := range tests {
+		if got := d.interval(tt.ttl); got != tt.want {
+			t.Errorf("interval(%v) = %v, want %v", tt.ttl, got, tt.want)
+		}
+	}
+}
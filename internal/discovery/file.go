@@ -0,0 +1,134 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// File 从 JSON/YAML 文件读取节点列表，文件变化时重新加载，文件格式：
+//
+//	endpoints:
+//	  - "http://10.0.0.1:8080"
+//	  - "http://10.0.0.2:8080"
+type File struct {
+	path     string
+	debounce time.Duration
+}
+
+type endpointsFile struct {
+	Endpoints []string `yaml:"endpoints" json:"endpoints"`
+}
+
+func NewFile(config model.DiscoveryConfig) *File {
+	path, err := filepath.Abs(config.File)
+	if err != nil {
+		path = config.File
+	}
+	return &File{
+		path:     path,
+		debounce: time.Second,
+	}
+}
+
+func (f *File) Watch(ctx context.Context) <-chan []*url.URL {
+	ch := make(chan []*url.URL)
+
+	go func() {
+		defer close(ch)
+
+		var last []string
+		reload := func() bool {
+			upstreams, err := f.load()
+			if err != nil {
+				logger.Logger.Warn("file discovery reload failed", zap.String("file", f.path), zap.Error(err))
+				return true
+			}
+			keys := urlStrings(upstreams)
+			if equalStrings(keys, last) {
+				return true
+			}
+			last = keys
+			return send(ctx, ch, upstreams)
+		}
+
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			logger.Logger.Error("file discovery watcher create failed", zap.Error(err))
+			return
+		}
+		defer w.Close()
+
+		// 监听文件所在目录，兼容编辑器先写临时文件再重命名的方式
+		if err := w.Add(filepath.Dir(f.path)); err != nil {
+			logger.Logger.Error("file discovery watch failed", zap.String("file", f.path), zap.Error(err))
+			return
+		}
+
+		if !reload() {
+			return
+		}
+
+		// 去抖动：文件变化后等待一段时间再加载
+		timer := time.NewTimer(f.debounce)
+		timer.Stop()
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if event.Name == f.path && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					timer.Reset(f.debounce)
+				}
+			case <-timer.C:
+				if !reload() {
+					return
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				logger.Logger.Warn("file discovery watcher error", zap.Error(err))
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (f *File) load() ([]*url.URL, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON 是 YAML 的子集，统一使用 YAML 解析
+	var file endpointsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	upstreams := make([]*url.URL, 0, len(file.Endpoints))
+	for _, endpoint := range file.Endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q", endpoint)
+		}
+		upstreams = append(upstreams, u)
+	}
+	return upstreams, nil
+}
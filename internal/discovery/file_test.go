@@ -0,0 +1,110 @@
+package discovery
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+)
+
+func writeEndpoints(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func watchFile(t *testing.T, path string) <-chan []*url.URL {
+	t.Helper()
+	logger.Logger = zap.NewNop()
+	f := NewFile(model.DiscoveryConfig{Type: "file", File: path})
+	f.debounce = 20 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return f.Watch(ctx)
+}
+
+// expectNoUpdate 等待超过去抖动时间，确认没有推送新的节点列表
+func expectNoUpdate(t *testing.T, updates <-chan []*url.URL) {
+	t.Helper()
+	select {
+	case upstreams := <-updates:
+		t.Fatalf("unexpected upstream update %v", urlStrings(upstreams))
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints.yaml")
+	writeEndpoints(t, path, `endpoints: ["http://10.0.0.1:8080", "http://10.0.0.2:8080"]`)
+
+	updates := watchFile(t, path)
+	expectUpstreams(t, updates, "http://10.0.0.1:8080", "http://10.0.0.2:8080")
+
+	// 文件修改后重新加载
+	writeEndpoints(t, path, "endpoints:\n  - \"http://10.0.0.3:8080\"\n")
+	expectUpstreams(t, updates, "http://10.0.0.3:8080")
+
+	// 内容不变（节点列表相同）时不推送
+	writeEndpoints(t, path, `{"endpoints": ["http://10.0.0.3:8080"]}`)
+	expectNoUpdate(t, updates)
+
+	// 加载失败时保留上一次的节点列表
+	writeEndpoints(t, path, `endpoints: ["10.0.0.4"]`)
+	expectNoUpdate(t, updates)
+	writeEndpoints(t, path, `endpoints: [`)
+	expectNoUpdate(t, updates)
+
+	// 编辑器先写临时文件再重命名
+	tmp := filepath.Join(filepath.Dir(path), "endpoints.yaml.tmp")
+	writeEndpoints(t, tmp, `endpoints: ["http://10.0.0.5:8080"]`)
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	expectUpstreams(t, updates, "http://10.0.0.5:8080")
+
+	// 同目录的其他文件变化不会触发加载
+	writeEndpoints(t, filepath.Join(filepath.Dir(path), "other.yaml"), `endpoints: ["http://10.0.0.6:8080"]`)
+	expectNoUpdate(t, updates)
+}
+
+func TestFileDebounce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints.yaml")
+	writeEndpoints(t, path, `endpoints: ["http://10.0.0.1:8080"]`)
+
+	updates := watchFile(t, path)
+	expectUpstreams(t, updates, "http://10.0.0.1:8080")
+
+	// 连续多次写入只加载最后的内容
+	writeEndpoints(t, path, `endpoints: ["http://10.0.0.2:8080"]`)
+	writeEndpoints(t, path, `endpoints: ["http://10.0.0.3:8080"]`)
+	expectUpstreams(t, updates, "http://10.0.0.3:8080")
+	expectNoUpdate(t, updates)
+}
+
+func TestFileWatchStops(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	path := filepath.Join(t.TempDir(), "endpoints.yaml")
+	writeEndpoints(t, path, `endpoints: ["http://10.0.0.1:8080"]`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := NewFile(model.DiscoveryConfig{File: path}).Watch(ctx)
+	expectUpstreams(t, updates, "http://10.0.0.1:8080")
+
+	cancel()
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Fatal("update received after cancel")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+}
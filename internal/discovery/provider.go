@@ -0,0 +1,68 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 服务发现
+
+// Provider 服务发现提供者，持续推送路由上游节点集合的变化
+type Provider interface {
+	// Watch 监听节点变化，节点集合每次变化时发送完整的节点列表，ctx 结束后关闭 channel
+	Watch(ctx context.Context) <-chan []*url.URL
+}
+
+// NewProvider 工厂模式 根据路由配置创建服务发现提供者，未配置 discovery 时使用静态节点列表
+func NewProvider(route *model.Route) (Provider, error) {
+	if route.Discovery == nil {
+		return NewStatic(route.Upstreams)
+	}
+
+	switch route.Discovery.Type {
+	case constants.DiscoveryConsul:
+		return NewConsul(*route.Discovery), nil
+	case constants.DiscoveryFile:
+		return NewFile(*route.Discovery), nil
+	case constants.DiscoveryDNS:
+		return NewDNS(*route.Discovery), nil
+	default:
+		return nil, fmt.Errorf("unknown discovery type: %s", route.Discovery.Type)
+	}
+}
+
+// send 发送节点列表，ctx 结束时返回 false
+func send(ctx context.Context, ch chan<- []*url.URL, upstreams []*url.URL) bool {
+	select {
+	case ch <- upstreams:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func urlStrings(urls []*url.URL) []string {
+	keys := make([]string, 0, len(urls))
+	for _, u := range urls {
+		keys = append(keys, u.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1 +1,37 @@
 package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// Static 静态节点列表，即路由配置中的 upstreams
+type Static struct {
+	upstreams []*url.URL
+}
+
+func NewStatic(upstreams []*model.UpstreamsConfig) (*Static, error) {
+	urls := make([]*url.URL, 0, len(upstreams))
+	for _, u := range upstreams {
+		parsed, err := url.Parse(u.Host + u.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream url %q: %w", u.Host+u.Path, err)
+		}
+		urls = append(urls, parsed)
+	}
+	return &Static{upstreams: urls}, nil
+}
+
+// Watch 发送一次静态节点列表，节点只会随配置热更新变化
+func (s *Static) Watch(ctx context.Context) <-chan []*url.URL {
+	ch := make(chan []*url.URL, 1)
+	ch <- s.upstreams
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch
+}
@@ -102,6 +102,11 @@ func UpdateLogLevel(level string) error {
 	return nil
 }
 
+// GetLogLevel 获取当前日志级别
+func GetLogLevel() string {
+	return atomicLevel.Level().String()
+}
+
 // Sync 刷新未写入的日志
 func Sync() {
 	_ = Logger.Sync()
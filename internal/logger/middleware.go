@@ -1,6 +1,9 @@
 package logger
 
 import (
+	"context"
+	"github.com/lccxxo/bailuoli/internal/clientip"
+	"github.com/lccxxo/bailuoli/internal/metrics"
 	"go.uber.org/zap"
 	"net/http"
 	"time"
@@ -12,6 +15,21 @@ type responseWriter struct {
 	size   int64
 }
 
+// RequestInfo 请求处理过程中补充的信息（命中的路由、转发的上游节点、认证的调用方），供访问日志和监控指标使用
+type RequestInfo struct {
+	Route    string
+	Upstream string
+	Consumer string
+}
+
+// GetRequestInfo 从上下文中获取请求信息，不存在时返回一个临时对象，调用方可直接赋值
+func GetRequestInfo(ctx context.Context) *RequestInfo {
+	if info, ok := ctx.Value("request_info").(*RequestInfo); ok {
+		return info
+	}
+	return &RequestInfo{}
+}
+
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -22,19 +40,31 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 			size:           0,
 		}
 
+		info := &RequestInfo{}
+		r = r.WithContext(context.WithValue(r.Context(), "request_info", info))
+
 		next.ServeHTTP(&wrappedWriter, r)
 
+		duration := time.Since(start)
+
 		Logger.Info("HTTP Request",
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
 			zap.String("query", r.URL.RawQuery),
-			zap.String("ip", r.RemoteAddr),
+			zap.String("ip", clientip.FromRequest(r)),
+			zap.String("remote_addr", r.RemoteAddr),
 			zap.String("agent", r.UserAgent()),
+			zap.String("route", info.Route),
+			zap.String("upstream", info.Upstream),
+			zap.String("consumer", info.Consumer),
 			zap.Int("status", wrappedWriter.status),
-			zap.Duration("duration", time.Since(start)),
+			zap.Duration("duration", duration),
 			zap.Int64("response_size", wrappedWriter.size),
 			zap.String("request_id", r.Header.Get("X-Request-ID")), // 分布式追踪ID
 		)
+
+		// 监控指标与访问日志在同一位置采集
+		metrics.ObserveRequest(info.Route, info.Upstream, wrappedWriter.status, duration, wrappedWriter.size)
 	})
 }
 
@@ -44,6 +74,10 @@ func (rw *responseWriter) WriteHeader(code int) {
 }
 
 func (rw *responseWriter) Write(b []byte) (int, error) {
+	// 未显式调用 WriteHeader 时默认为 200
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
 	size, err := rw.ResponseWriter.Write(b)
 	rw.size += int64(size)
 	return size, err
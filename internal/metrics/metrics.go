@@ -0,0 +1,250 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus 监控指标
+
+const namespace = "bailuoli"
+
+var (
+	// Registry 网关指标注册表
+	Registry = prometheus.NewRegistry()
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests by route, upstream and status code.",
+	}, []string{"route", "upstream", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and upstream.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "upstream"})
+
+	responseSize = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "response_size_bytes_total",
+		Help:      "Total bytes written to clients by route.",
+	}, []string{"route"})
+
+	routeInflight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "route_requests_in_flight",
+		Help:      "Number of requests currently being served by route.",
+	}, []string{"route"})
+
+	upstreamInflight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upstream_requests_in_flight",
+		Help:      "Number of requests currently being proxied by upstream.",
+	}, []string{"route", "upstream"})
+
+	breakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_transitions_total",
+		Help:      "Total number of circuit breaker state transitions by route, upstream and target state.",
+	}, []string{"route", "upstream", "state"})
+
+	upstreamRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_retries_total",
+		Help:      "Total number of upstream retries by route and result.",
+	}, []string{"route", "result"})
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Total number of requests rejected by rate limiting by route and rule.",
+	}, []string{"route", "rule"})
+
+	rateLimitErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_backend_errors_total",
+		Help:      "Total number of rate limit backend failures by route and rule.",
+	}, []string{"route", "rule"})
+
+	connQueueRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_queue_rejected_total",
+		Help:      "Total number of requests rejected by the upstream concurrency limit by route and reason.",
+	}, []string{"route", "reason"})
+
+	authFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Total number of requests rejected by authentication by route, auth type and reason.",
+	}, []string{"route", "type", "reason"})
+
+	configReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Total number of configuration reloads by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestDuration,
+		responseSize,
+		routeInflight,
+		upstreamInflight,
+		breakerTransitions,
+		upstreamRetries,
+		rateLimited,
+		rateLimitErrors,
+		connQueueRejected,
+		authFailures,
+		configReloads,
+	)
+}
+
+// Handler /metrics 接口
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest 记录一次请求（在访问日志中间件中调用）
+func ObserveRequest(route, upstream string, status int, duration time.Duration, size int64) {
+	requestsTotal.WithLabelValues(route, upstream, strconv.Itoa(status)).Inc()
+	requestDuration.WithLabelValues(route, upstream).Observe(duration.Seconds())
+	responseSize.WithLabelValues(route).Add(float64(size))
+}
+
+// RouteRequestStarted 路由开始处理请求，返回结束时调用的函数
+func RouteRequestStarted(route string) func() {
+	gauge := routeInflight.WithLabelValues(route)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// UpstreamRequestStarted 开始向上游节点转发请求，返回结束时调用的函数
+func UpstreamRequestStarted(route, upstream string) func() {
+	gauge := upstreamInflight.WithLabelValues(route, upstream)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// ObserveBreakerTransition 记录熔断器状态变更
+func ObserveBreakerTransition(route, upstream, state string) {
+	breakerTransitions.WithLabelValues(route, upstream, state).Inc()
+}
+
+// ObserveRetry 记录一次重试，result 为 attempted（已重试）或 budget_exhausted（重试预算不足放弃）
+func ObserveRetry(route, result string) {
+	upstreamRetries.WithLabelValues(route, result).Inc()
+}
+
+// ObserveRateLimited 记录一次被限流的请求
+func ObserveRateLimited(route, rule string) {
+	rateLimited.WithLabelValues(route, rule).Inc()
+}
+
+// ObserveRateLimitError 记录一次限流存储不可用
+func ObserveRateLimitError(route, rule string) {
+	rateLimitErrors.WithLabelValues(route, rule).Inc()
+}
+
+// ObserveConnQueueRejected 记录一次因并发上限被拒绝的请求，reason 为 busy（未配置队列）、full（队列已满）或 timeout（等待超时）
+func ObserveConnQueueRejected(route, reason string) {
+	connQueueRejected.WithLabelValues(route, reason).Inc()
+}
+
+// ObserveAuthFailure 记录一次认证失败，authType 为认证方式（如 client_cert）
+func ObserveAuthFailure(route, authType, reason string) {
+	authFailures.WithLabelValues(route, authType, reason).Inc()
+}
+
+// ObserveConfigReload 记录配置重新加载结果
+func ObserveConfigReload(err error) {
+	if err != nil {
+		configReloads.WithLabelValues("failure").Inc()
+		return
+	}
+	configReloads.WithLabelValues("success").Inc()
+}
+
+// UpstreamStatus 上游节点状态
+type UpstreamStatus struct {
+	Route    string
+	Upstream string
+	Healthy  bool // 主动健康检查结果
+	Ejected  bool // 是否被被动健康检查驱逐
+}
+
+// BreakerStatus 熔断器状态
+type BreakerStatus struct {
+	Route    string
+	Upstream string
+	State    int // 0 关闭 1 打开 2 半开
+}
+
+// StatusSource 在采集时提供上游节点健康状态和熔断器状态
+type StatusSource interface {
+	UpstreamStatuses() []UpstreamStatus
+	BreakerStates() []BreakerStatus
+}
+
+var registerOnce sync.Once
+
+// RegisterStatusSource 注册状态来源，只生效一次
+func RegisterStatusSource(source StatusSource) {
+	registerOnce.Do(func() {
+		Registry.MustRegister(&statusCollector{source: source})
+	})
+}
+
+var (
+	upstreamHealthyDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "upstream", "healthy"),
+		"Whether the upstream passes active health checks (1) or not (0).",
+		[]string{"route", "upstream"}, nil)
+	upstreamEjectedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "upstream", "ejected"),
+		"Whether the upstream is ejected by outlier detection (1) or not (0).",
+		[]string{"route", "upstream"}, nil)
+	breakerStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "circuit_breaker", "state"),
+		"Circuit breaker state by route and upstream: 0 closed, 1 open, 2 half-open.",
+		[]string{"route", "upstream"}, nil)
+)
+
+type statusCollector struct {
+	source StatusSource
+}
+
+func (c *statusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- upstreamHealthyDesc
+	ch <- upstreamEjectedDesc
+	ch <- breakerStateDesc
+}
+
+func (c *statusCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.source.UpstreamStatuses() {
+		ch <- prometheus.MustNewConstMetric(upstreamHealthyDesc, prometheus.GaugeValue, boolValue(s.Healthy), s.Route, s.Upstream)
+		ch <- prometheus.MustNewConstMetric(upstreamEjectedDesc, prometheus.GaugeValue, boolValue(s.Ejected), s.Route, s.Upstream)
+	}
+	for _, s := range c.source.BreakerStates() {
+		ch <- prometheus.MustNewConstMetric(breakerStateDesc, prometheus.GaugeValue, float64(s.State), s.Route, s.Upstream)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package model
+
+import "time"
+
+// ClientCertConfig 客户端证书认证配置，需要在 server.tls 中配置 client_ca_file
+// 配置后请求必须携带通过 CA 校验的客户端证书；配置了允许列表时证书需要匹配其中任意一项
+type ClientCertConfig struct {
+	AllowedSubjects  []string `yaml:"allowed_subjects"`   // 允许的证书主题 CN
+	AllowedSANs      []string `yaml:"allowed_sans"`       // 允许的 SAN（DNS、邮箱、IP、URI）
+	AllowedSPIFFEIDs []string `yaml:"allowed_spiffe_ids"` // 允许的 SPIFFE ID，以 /* 结尾时匹配该路径下的所有 ID
+	ForwardIdentity  bool     `yaml:"forward_identity"`   // 通过请求头将客户端身份转发给上游
+}
+
+// IPRestrictionConfig 路由的客户端 IP 访问控制，客户端 IP 根据 server.trusted_proxies 解析
+// 匹配 deny 时拒绝；配置了 allow 时只允许匹配其中任意一项的地址
+type IPRestrictionConfig struct {
+	Allow []string `yaml:"allow"` // 允许的 IP 或 CIDR
+	Deny  []string `yaml:"deny"`  // 拒绝的 IP 或 CIDR，优先于 allow
+}
+
+// AuthConfig 路由认证配置
+type AuthConfig struct {
+	Type            string           `yaml:"type"`             // 认证方式 jwt、api_key、basic
+	JWT             *JWTConfig       `yaml:"jwt"`              // type 为 jwt 时必填
+	APIKey          *APIKeyConfig    `yaml:"api_key"`          // type 为 api_key 时必填
+	Basic           *BasicAuthConfig `yaml:"basic"`            // type 为 basic 时必填
+	HideCredentials bool             `yaml:"hide_credentials"` // 认证通过后删除凭证（API Key、Authorization 请求头），不转发给上游
+}
+
+// JWTConfig JWT 认证配置，签名密钥来自静态密钥或 JWKS（可同时配置）
+type JWTConfig struct {
+	Issuer              string            `yaml:"issuer"`                // 期望的 iss，为空则不校验
+	Audiences           []string          `yaml:"audiences"`             // 允许的 aud，token 中的 aud 匹配任意一项即可，为空则不校验
+	Algorithms          []string          `yaml:"algorithms"`            // 允许的签名算法，为空则允许所有支持的算法
+	JWKSURL             string            `yaml:"jwks_url"`              // JWKS 地址
+	JWKSRefreshInterval time.Duration     `yaml:"jwks_refresh_interval"` // JWKS 刷新间隔（默认5m）
+	Keys                []JWTKeyConfig    `yaml:"keys"`                  // 静态密钥
+	ClockSkew           time.Duration     `yaml:"clock_skew"`            // 校验 exp、nbf 允许的时钟偏差（默认30s）
+	RequiredClaims      map[string]string `yaml:"required_claims"`       // 必须满足的 claim，不满足返回 403
+	ForwardClaims       map[string]string `yaml:"forward_claims"`        // 转发给上游的 claim：claim 名称 -> 请求头
+}
+
+// JWTKeyConfig 静态签名密钥，secret 与 public_key_file 二选一
+type JWTKeyConfig struct {
+	KID           string `yaml:"kid"`             // 密钥 ID，为空时可以校验任意 kid 的 token
+	Secret        string `yaml:"secret"`          // HS 算法的共享密钥
+	PublicKeyFile string `yaml:"public_key_file"` // RS、ES 算法的 PEM 公钥或证书
+}
+
+// APIKeyConfig API Key 认证配置
+// 请求携带的 API Key 格式为 <key_id>.<secret>，key_id 用于查找凭证，secret 与凭证文件中的哈希比较
+type APIKeyConfig struct {
+	CredentialsFile string `yaml:"credentials_file"` // 凭证文件，文件变化时自动重新加载
+	Header          string `yaml:"header"`           // 携带 API Key 的请求头（默认 X-API-Key）
+	Query           string `yaml:"query"`            // 携带 API Key 的查询参数，为空则不从查询参数读取
+}
+
+// BasicAuthConfig Basic 认证配置
+type BasicAuthConfig struct {
+	CredentialsFile string `yaml:"credentials_file"` // 凭证文件，文件变化时自动重新加载
+}
+
+// CredentialsConfig 凭证文件，密码和 API Key 只保存 bcrypt 或 argon2 哈希
+type CredentialsConfig struct {
+	Consumers []ConsumerConfig `yaml:"consumers"`
+}
+
+// ConsumerConfig 调用方，认证通过后写入请求上下文（consumer），访问日志记录调用方名称
+type ConsumerConfig struct {
+	Name         string            `yaml:"name"`          // 调用方名称
+	APIKeys      []APIKeyHash      `yaml:"api_keys"`      // API Key
+	Username     string            `yaml:"username"`      // Basic 认证用户名
+	PasswordHash string            `yaml:"password_hash"` // Basic 认证密码哈希
+	Routes       []string          `yaml:"routes"`        // 允许访问的路由，为空则不限制
+	Tier         string            `yaml:"tier"`          // 限流等级
+	Metadata     map[string]string `yaml:"metadata"`      // 其他元数据
+}
+
+// APIKeyHash API Key 的 ID 和 secret 哈希
+type APIKeyHash struct {
+	ID   string `yaml:"id"`   // key_id
+	Hash string `yaml:"hash"` // secret 的 bcrypt（$2a$、$2b$、$2y$）或 argon2（$argon2id$、$argon2i$）哈希
+}
+
+// ExtAuthzConfig 外部授权配置，由外部 HTTP 服务决定是否放行请求
+// 授权请求使用原请求的方法，通过 X-Forwarded-Method、X-Forwarded-Uri 等请求头传递原请求信息，不携带请求体
+// 授权服务返回 2xx 时放行，其他状态码时将其状态码、响应头和响应体返回给客户端，请求失败或返回 5xx 时按 failure_mode 处理
+type ExtAuthzConfig struct {
+	URL             string        `yaml:"url"`              // 授权服务地址
+	Timeout         time.Duration `yaml:"timeout"`          // 授权请求超时（默认1s）
+	ForwardHeaders  []string      `yaml:"forward_headers"`  // 转发给授权服务的请求头（默认 Authorization）
+	UpstreamHeaders []string      `yaml:"upstream_headers"` // 放行时从授权响应复制到上游请求的响应头，为空则不复制（不能包含 Host、Authorization 和逐跳请求头）
+	CacheTTL        time.Duration `yaml:"cache_ttl"`        // 授权结果缓存时间，为0则不缓存
+	FailureMode     string        `yaml:"failure_mode"`     // 授权服务不可用时 open 放行、closed 拒绝（默认 closed）
+	StatusOnError   int           `yaml:"status_on_error"`  // failure_mode 为 closed 时返回的状态码（默认403）
+}
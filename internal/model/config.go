@@ -3,5 +3,6 @@ package model
 type Config struct {
 	Server ServerConfig  `yaml:"server"`
 	Log    LoggingConfig `yaml:"log"`
+	Redis  RedisConfig   `yaml:"redis"` // 共享存储，分布式限流使用
 	Routes []*Route      `yaml:"routes"`
 }
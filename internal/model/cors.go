@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// CORSConfig 路由跨域配置，预检请求（OPTIONS）由网关直接响应，不转发给上游
+type CORSConfig struct {
+	AllowOrigins       []string      `yaml:"allow_origins"`        // 允许的来源，* 表示所有来源，支持通配符子域名（如 https://*.example.com）
+	AllowOriginRegexes []string      `yaml:"allow_origin_regexes"` // 允许的来源正则表达式（完整匹配）
+	AllowMethods       []string      `yaml:"allow_methods"`        // 允许的方法（默认 GET、HEAD、POST、PUT、PATCH、DELETE）
+	AllowHeaders       []string      `yaml:"allow_headers"`        // 允许的请求头，为空或 * 时允许预检请求中的所有请求头
+	ExposeHeaders      []string      `yaml:"expose_headers"`       // 允许浏览器读取的响应头
+	AllowCredentials   bool          `yaml:"allow_credentials"`    // 是否允许携带 Cookie 等凭证（不能与 allow_origins: ["*"] 同时使用）
+	MaxAge             time.Duration `yaml:"max_age"`              // 预检结果缓存时间（为0则不返回 Access-Control-Max-Age）
+}
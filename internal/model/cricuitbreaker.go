@@ -9,4 +9,5 @@ type CircuitBreakerConfig struct {
 	HalfOpenMaxRequests     int64         `yaml:"half_open_max_requests"`    // 半开状态允许的最大试探请求数
 	OpenStateTimeout        time.Duration `yaml:"open_state_timeout"`        // 熔断后进入半开的等待时间
 	WindowDuration          time.Duration `yaml:"window_duration"`           // 统计窗口时长
+	FailureStatusCodes      []int         `yaml:"failure_status_codes"`      // 计为失败的响应状态码（默认所有5xx）
 }
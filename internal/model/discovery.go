@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// DiscoveryConfig 服务发现配置，配置后路由的上游节点由服务发现动态维护
+type DiscoveryConfig struct {
+	Type                 string               `yaml:"type"`            // 服务发现类型（consul、file、dns）
+	Service              string               `yaml:"service"`         // 服务名称
+	Tag                  string               `yaml:"tag"`             // 只使用带有该标签的实例
+	Scheme               string               `yaml:"scheme"`          // 上游节点协议（默认 http）
+	Path                 string               `yaml:"path"`            // 转发后的基础路径（默认为空）
+	CircuitBreakerConfig CircuitBreakerConfig `yaml:"circuit_breaker"` // 发现的上游节点使用的熔断器配置
+	TLS                  *UpstreamTLSConfig   `yaml:"tls"`             // 发现的上游节点使用的 TLS 配置
+
+	// consul 配置
+	Address    string        `yaml:"address"`    // consul 地址（默认 http://127.0.0.1:8500）
+	Datacenter string        `yaml:"datacenter"` // 数据中心（默认使用 agent 所在数据中心）
+	Token      string        `yaml:"token"`      // ACL token
+	WaitTime   time.Duration `yaml:"wait_time"`  // 阻塞查询最长等待时间（默认 5m）
+
+	// file 配置
+	File string `yaml:"file"` // 节点列表文件路径（JSON 或 YAML），文件变化时自动重新加载
+
+	// dns 配置
+	Name            string        `yaml:"name"`             // 解析的域名
+	RecordType      string        `yaml:"record_type"`      // 记录类型 A、AAAA、SRV（默认 A）
+	Port            int           `yaml:"port"`             // A/AAAA 记录使用的端口（SRV 记录自带端口）
+	Nameserver      string        `yaml:"nameserver"`       // DNS 服务器地址（默认读取 /etc/resolv.conf）
+	RefreshInterval time.Duration `yaml:"refresh_interval"` // 记录没有 TTL 或解析失败时的刷新间隔（默认 30s）
+}
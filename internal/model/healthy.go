@@ -10,3 +10,16 @@ type HealthyConfig struct {
 	HealthyThreshold   int           `yaml:"healthy_threshold"`   // 健康检查成功阈值
 	UnhealthyThreshold int           `yaml:"unhealthy_threshold"` // 健康检查失败阈值
 }
+
+// OutlierDetectionConfig 被动健康检查（异常节点驱逐）配置
+type OutlierDetectionConfig struct {
+	Enable                   bool          `yaml:"enable"`                      // 是否启用被动健康检查
+	ConsecutiveErrors        int           `yaml:"consecutive_errors"`          // 连续错误（5xx或连接错误）驱逐阈值
+	Interval                 time.Duration `yaml:"interval"`                    // 成功率统计及驱逐恢复的检查间隔
+	BaseEjectionTime         time.Duration `yaml:"base_ejection_time"`          // 基础驱逐时长，随驱逐次数递增
+	MaxEjectionTime          time.Duration `yaml:"max_ejection_time"`           // 最大驱逐时长
+	MaxEjectionPercent       int           `yaml:"max_ejection_percent"`        // 最多可驱逐的节点百分比
+	SuccessRateMinimumHosts  int           `yaml:"success_rate_minimum_hosts"`  // 启用成功率检测所需的最少节点数
+	SuccessRateRequestVolume int           `yaml:"success_rate_request_volume"` // 单个节点参与成功率检测的最少请求数
+	SuccessRateStdevFactor   float64       `yaml:"success_rate_stdev_factor"`   // 成功率低于 均值-因子*标准差 时驱逐
+}
@@ -1,9 +1,42 @@
 package model
 
+import "time"
+
 // LoadBalanceConfig 负载均衡配置
 type LoadBalanceConfig struct {
-	Strategy     string         `yaml:"strategy"`      // 负载均衡策略名称 默认 round-robin
-	Weighted     map[string]int `yaml:"weight"`        // 权重配置
-	MaxConn      int            `yaml:"max_conn"`      // 最大连接数
-	HealthyCheck HealthyConfig  `yaml:"healthy_check"` // 健康检查配置
+	Strategy         string                 `yaml:"strategy"`          // 负载均衡策略名称 默认 round-robin
+	Weighted         map[string]int         `yaml:"weight"`            // 权重配置（key 为上游地址、upstreams.host 或 host:port，未配置的节点权重为1）
+	HashKey          HashKeyConfig          `yaml:"hash_key"`          // 一致性哈希（consistent_hash、maglev）使用的哈希 key
+	VirtualNodes     int                    `yaml:"virtual_nodes"`     // consistent_hash 每单位权重的虚拟节点数（默认160）
+	EWMADecay        time.Duration          `yaml:"ewma_decay"`        // p2c、ewma 延迟平均值的衰减时间，越小越快反映延迟下降（默认10s）
+	Sticky           *StickyConfig          `yaml:"sticky"`            // 会话保持（为空则不启用）
+	MaxConn          int                    `yaml:"max_conn"`          // 每个上游节点的最大并发请求数，达到上限的节点不会被选择（为0则不限制）
+	MaxRequests      int                    `yaml:"max_requests"`      // 路由所有上游节点的最大并发请求数（为0则不限制）
+	Queue            ConnQueueConfig        `yaml:"queue"`             // 所有节点都达到并发上限时的等待队列
+	HealthyCheck     HealthyConfig          `yaml:"healthy_check"`     // 健康检查配置
+	OutlierDetection OutlierDetectionConfig `yaml:"outlier_detection"` // 被动健康检查配置
+}
+
+// ConnQueueConfig 并发等待队列配置
+// 所有上游节点都达到并发上限时请求进入队列等待，队列已满或等待超时时返回 503
+type ConnQueueConfig struct {
+	Size    int           `yaml:"size"`    // 队列长度，为0则不排队直接返回 503
+	Timeout time.Duration `yaml:"timeout"` // 最长等待时间（默认1s）
+}
+
+// HashKeyConfig 一致性哈希的 key，请求中没有对应的值时退化为按客户端 IP 哈希
+type HashKeyConfig struct {
+	Source string `yaml:"source"` // ip（默认）、header、cookie、query、path
+	Name   string `yaml:"name"`   // 请求头、Cookie 或查询参数名称（source 为 header、cookie、query 时必填）
+}
+
+// StickyConfig 会话保持配置
+// 网关通过签名的 Cookie 记录选择的节点，之后的请求在节点可用时转发到同一个节点，不可用时按负载均衡策略重新选择并更新 Cookie
+type StickyConfig struct {
+	CookieName string        `yaml:"cookie_name"` // Cookie 名称（默认 bailuoli_sticky）
+	TTL        time.Duration `yaml:"ttl"`         // 有效期，为0则为会话 Cookie（浏览器关闭后失效）
+	Path       string        `yaml:"path"`        // Cookie 路径（默认 /）
+	SameSite   string        `yaml:"same_site"`   // lax（默认）、strict、none（none 时自动设置 Secure）
+	Secure     bool          `yaml:"secure"`      // 只通过 HTTPS 发送
+	Secret     string        `yaml:"secret"`      // 签名密钥，多个网关实例需要配置相同的密钥（为空则每个进程随机生成）
 }
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// RateLimitConfig 令牌桶限流规则
+type RateLimitConfig struct {
+	Name        string        `yaml:"name"`         // 规则名称，用于日志和监控指标（默认使用规则序号）
+	Key         string        `yaml:"key"`          // 限流维度 route、ip、header、jwt_claim（默认 route）
+	Header      string        `yaml:"header"`       // key 为 header 时使用的请求头，如 X-API-Key
+	Claim       string        `yaml:"claim"`        // key 为 jwt_claim 时使用的 claim，如 sub（需要配置 jwt 认证，只使用校验过签名的 claim）
+	Rate        int           `yaml:"rate"`         // 每个周期生成的令牌数
+	Period      time.Duration `yaml:"period"`       // 令牌生成周期（默认1s）
+	Burst       int           `yaml:"burst"`        // 桶容量，允许的突发请求数（默认等于 rate）
+	StatusCode  int           `yaml:"status_code"`  // 被限流时返回的状态码（默认429）
+	MaxKeys     int           `yaml:"max_keys"`     // 最多保存的 key 数量，超出时淘汰最久未使用的 key（默认10000，只对 local 生效）
+	Backend     string        `yaml:"backend"`      // 限流存储 local（进程内）、redis（多实例共享）（默认 local）
+	FailureMode string        `yaml:"failure_mode"` // 存储不可用时的处理方式 open（放行）、closed（拒绝）（默认 open）
+}
+
+// RedisConfig Redis 连接配置
+type RedisConfig struct {
+	Addr        string        `yaml:"addr"`         // 地址，如 127.0.0.1:6379
+	Password    string        `yaml:"password"`     // 密码
+	DB          int           `yaml:"db"`           // 数据库编号
+	DialTimeout time.Duration `yaml:"dial_timeout"` // 连接超时（默认1s）
+	Timeout     time.Duration `yaml:"timeout"`      // 单次命令超时（默认200ms），超时按 failure_mode 处理
+	PoolSize    int           `yaml:"pool_size"`    // 最多保留的空闲连接数（默认16）
+	KeyPrefix   string        `yaml:"key_prefix"`   // key 前缀（默认 bailuoli:ratelimit:）
+}
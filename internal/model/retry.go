@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// RetryConfig 路由级别的重试策略
+type RetryConfig struct {
+	Attempts             int           `yaml:"attempts"`               // 最大尝试次数（包含首次请求），小于2时不重试
+	RetryOn              []string      `yaml:"retry_on"`               // 重试条件 connect-failure、reset、gateway-error、5xx（默认 connect-failure,gateway-error）
+	RetriableStatusCodes []int         `yaml:"retriable_status_codes"` // 额外需要重试的响应状态码
+	RetryNonIdempotent   bool          `yaml:"retry_non_idempotent"`   // 是否重试非幂等请求（连接失败时请求未发出，总是可以重试）
+	PerTryTimeout        time.Duration `yaml:"per_try_timeout"`        // 单次尝试等待响应头的超时时间（默认不限制）
+	BaseInterval         time.Duration `yaml:"base_interval"`          // 退避基础间隔（默认25ms）
+	MaxInterval          time.Duration `yaml:"max_interval"`           // 退避最大间隔（默认基础间隔的10倍）
+	MaxBodySize          int64         `yaml:"max_body_size"`          // 为重放而缓存的最大请求体字节数，超过时不重试（默认64KB）
+}
+
+// RetryBudgetConfig 全局重试预算，限制同时进行的重试请求数，避免重试风暴
+type RetryBudgetConfig struct {
+	BudgetPercent       float64 `yaml:"budget_percent"`        // 允许的重试请求占活跃请求的百分比（默认20）
+	MinRetryConcurrency int     `yaml:"min_retry_concurrency"` // 不受百分比限制的最少并发重试数（默认3）
+}
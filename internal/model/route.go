@@ -5,14 +5,24 @@ import (
 )
 
 type Route struct {
-	Name        string             `yaml:"name"`         // 路由名称
-	Path        string             `yaml:"path"`         // 匹配路径（精确匹配、前缀匹配、正则匹配）
-	Method      string             `yaml:"method"`       // HTTP方法（GET、POST等）
-	MatchType   string             `yaml:"match_type"`   // 匹配规则类型（exact、prefix、regex）
-	Upstreams   []*UpstreamsConfig `yaml:"upstreams"`    // 后端服务列表
-	StripPrefix bool               `yaml:"strip_prefix"` // 是否去除前缀
-	LoadBalance LoadBalanceConfig  `yaml:"load_balance"` // 负载均衡配置
-	Matcher     match.Matcher      // 匹配器
+	Name          string               `yaml:"name"`           // 路由名称
+	Path          string               `yaml:"path"`           // 匹配路径（精确匹配、前缀匹配、正则匹配）
+	Method        string               `yaml:"method"`         // HTTP方法（GET、POST等）
+	MatchType     string               `yaml:"match_type"`     // 匹配规则类型（exact、prefix、regex）
+	Upstreams     []*UpstreamsConfig   `yaml:"upstreams"`      // 后端服务列表
+	Discovery     *DiscoveryConfig     `yaml:"discovery"`      // 服务发现配置（与 upstreams 二选一）
+	StripPrefix   bool                 `yaml:"strip_prefix"`   // 是否去除前缀
+	LoadBalance   LoadBalanceConfig    `yaml:"load_balance"`   // 负载均衡配置
+	Retry         *RetryConfig         `yaml:"retry"`          // 重试策略（为空则不重试）
+	Timeout       TimeoutConfig        `yaml:"timeout"`        // 超时配置
+	RateLimits    []*RateLimitConfig   `yaml:"rate_limits"`    // 限流规则（所有规则都通过才放行）
+	IPRestriction *IPRestrictionConfig `yaml:"ip_restriction"` // 客户端 IP 访问控制（在认证之前执行）
+	ClientCert    *ClientCertConfig    `yaml:"client_cert"`    // 客户端证书认证（为空则不校验）
+	Auth          *AuthConfig          `yaml:"auth"`           // 认证配置（为空则不认证）
+	MatchClaims   map[string]string    `yaml:"match_claims"`   // 根据 JWT claim 匹配路由（需要配置 jwt 认证），token 无效时不匹配
+	ExtAuthz      *ExtAuthzConfig      `yaml:"ext_authz"`      // 外部授权（在认证之后执行）
+	CORS          *CORSConfig          `yaml:"cors"`           // 跨域配置（为空则不处理，由上游返回跨域响应头）
+	Matcher       match.Matcher        // 匹配器
 }
 
 type RouteConfig struct {
@@ -25,4 +35,6 @@ type UpstreamsConfig struct {
 	Method               string               `yaml:"method"`          // 请求方法（默认 GET）
 	ContentType          string               `yaml:"content_type"`    // 请求头中的 Content-Type（默认 application/json）
 	CircuitBreakerConfig CircuitBreakerConfig `yaml:"circuit_breaker"` // 熔断器配置
+	TLS                  *UpstreamTLSConfig   `yaml:"tls"`             // 上游 TLS 配置（https 上游节点使用）
+	MaxConn              int                  `yaml:"max_conn"`        // 最大并发请求数，覆盖 load_balance.max_conn（为0则使用 load_balance.max_conn）
 }
@@ -3,9 +3,14 @@ package model
 import "time"
 
 type ServerConfig struct {
-	Addr            string        `yaml:"addr"`
-	Mode            string        `yaml:"mode"`
-	ReadTimeout     time.Duration `yaml:"read_timeout"`
-	WriteTimeout    time.Duration `yaml:"write_timeout"`
-	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	Addr            string            `yaml:"addr"`
+	Mode            string            `yaml:"mode"`
+	ReadTimeout     time.Duration     `yaml:"read_timeout"`
+	WriteTimeout    time.Duration     `yaml:"write_timeout"`
+	ShutdownTimeout time.Duration     `yaml:"shutdown_timeout"`
+	AdminAddr       string            `yaml:"admin_addr"`      // 管理接口监听地址，为空则不启用
+	AdminToken      string            `yaml:"admin_token"`     // 管理接口修改类请求的 Bearer token，监听非本地地址时必填（查询接口同样校验）
+	RetryBudget     RetryBudgetConfig `yaml:"retry_budget"`    // 全局重试预算
+	TLS             *TLSConfig        `yaml:"tls"`             // HTTPS 配置，为空则监听 HTTP
+	TrustedProxies  []string          `yaml:"trusted_proxies"` // 可信代理的 IP 或 CIDR，只信任来自这些地址的 X-Forwarded-For
 }
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// TimeoutConfig 路由级别的超时配置，超时后返回 504
+type TimeoutConfig struct {
+	Connect        time.Duration `yaml:"connect"`         // 连接上游超时时间（默认30s）
+	ResponseHeader time.Duration `yaml:"response_header"` // 发送请求后等待响应头的超时时间（默认不限制）
+	Request        time.Duration `yaml:"request"`         // 整个请求（包含重试）的超时时间（默认不限制）
+	Idle           time.Duration `yaml:"idle"`            // 传输响应体时两次读取数据之间的最大间隔（默认不限制）
+}
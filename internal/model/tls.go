@@ -0,0 +1,26 @@
+package model
+
+// TLSConfig HTTPS 监听配置
+type TLSConfig struct {
+	Certificates []CertificateConfig `yaml:"certificates"`   // 证书列表，根据 SNI 选择，未匹配时使用第一个
+	MinVersion   string              `yaml:"min_version"`    // 最低 TLS 版本 1.0、1.1、1.2、1.3（默认1.2）
+	CipherSuites []string            `yaml:"cipher_suites"`  // 允许的加密套件（TLS1.3 不可配置），为空则使用 Go 默认值
+	ALPN         []string            `yaml:"alpn"`           // 应用层协议协商 h2、http/1.1（默认 h2,http/1.1）
+	RedirectAddr string              `yaml:"redirect_addr"`  // HTTP 重定向到 HTTPS 的监听地址，为空则不启用
+	ClientCAFile string              `yaml:"client_ca_file"` // 校验客户端证书的 CA，配置后客户端可以提供证书，是否必须由路由的 client_cert 决定
+}
+
+// CertificateConfig 证书文件，文件变化时自动重新加载
+type CertificateConfig struct {
+	CertFile string `yaml:"cert_file"` // 证书（可包含证书链）
+	KeyFile  string `yaml:"key_file"`  // 私钥
+}
+
+// UpstreamTLSConfig 连接上游节点使用的 TLS 配置，相同配置的上游节点共享连接池
+type UpstreamTLSConfig struct {
+	CAFile             string `yaml:"ca_file"`              // 校验上游证书的 CA（默认使用系统 CA）
+	CertFile           string `yaml:"cert_file"`            // 客户端证书（mTLS）
+	KeyFile            string `yaml:"key_file"`             // 客户端证书私钥
+	ServerName         string `yaml:"server_name"`          // 覆盖 SNI 和证书校验使用的域名（默认使用上游地址中的主机名）
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // 跳过证书校验，仅用于测试环境
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 并发上限与等待队列
+// 每个上游节点的并发请求数不超过 max_conn（upstreams[].max_conn 覆盖），路由的总并发请求数不超过 max_requests
+// 达到上限的节点不会被负载均衡选择，所有节点都达到上限时请求进入等待队列，有请求结束时重新选择节点
+// 未配置队列、队列已满或等待超时时返回 503 和 Retry-After
+
+type connQueue struct {
+	size    int64
+	timeout time.Duration
+	waiting atomic.Int64 // 正在等待的请求数
+
+	mu       sync.Mutex
+	released chan struct{} // 有请求结束时关闭并替换，唤醒所有等待的请求
+}
+
+func newConnQueue(config model.ConnQueueConfig) *connQueue {
+	if config.Size <= 0 {
+		return nil
+	}
+	q := &connQueue{
+		size:     int64(config.Size),
+		timeout:  config.Timeout,
+		released: make(chan struct{}),
+	}
+	if q.timeout <= 0 {
+		q.timeout = constants.DefaultConnQueueTimeout
+	}
+	return q
+}
+
+// enter 进入队列，队列已满时返回 false
+func (q *connQueue) enter() bool {
+	for {
+		n := q.waiting.Load()
+		if n >= q.size {
+			return false
+		}
+		if q.waiting.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+func (q *connQueue) leave() {
+	q.waiting.Add(-1)
+}
+
+// changed 获取下一次有请求结束时关闭的 channel，需要在重新选择节点之前获取，避免错过通知
+func (q *connQueue) changed() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.released
+}
+
+// notify 有请求结束（释放了并发名额）时唤醒等待的请求
+func (q *connQueue) notify() {
+	if q.waiting.Load() == 0 {
+		return
+	}
+	q.mu.Lock()
+	close(q.released)
+	q.released = make(chan struct{})
+	q.mu.Unlock()
+}
+
+// releaseConn 释放上游节点的并发名额
+func (p *LoadBalanceReverseProxy) releaseConn(key string) {
+	p.inflight.Release(key)
+	if p.queue != nil {
+		p.queue.notify()
+	}
+}
+
+// acquireUpstream 选择上游节点并占用一个并发名额
+// 所有节点都达到并发上限时进入等待队列，返回 ErrUpstreamsBusy（未配置队列）、ErrConnQueueFull、ErrConnQueueTimeout 或请求上下文的错误
+func (p *requestContext) acquireUpstream(r *http.Request, tried map[string]bool) (*url.URL, error) {
+	queue := p.proxy.queue
+	var timeout <-chan time.Time
+	for {
+		var released <-chan struct{}
+		if timeout != nil {
+			released = queue.changed()
+		}
+
+		target, err := p.nextUpstream(r, tried)
+		if err == nil {
+			key := target.String()
+			if p.proxy.inflight.TryAcquire(key, p.proxy.limits.Upstream(key), p.proxy.limits.Total) {
+				return target, nil
+			}
+			// 选择节点后名额被其他请求占用，与所有节点都达到上限一样排队等待后重新选择
+			if release, ok := r.Context().Value("least_conn_counter").(func()); ok {
+				release()
+			}
+			delete(tried, key)
+			err = constants.ErrUpstreamsBusy
+		}
+		if !errors.Is(err, constants.ErrUpstreamsBusy) {
+			return nil, err
+		}
+
+		if timeout == nil {
+			if queue == nil {
+				return nil, err
+			}
+			if !queue.enter() {
+				return nil, constants.ErrConnQueueFull
+			}
+			defer queue.leave()
+			timer := time.NewTimer(queue.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+			// 进入队列后获取通知 channel 再重新选择一次，之后每次重新选择前都等待有请求结束
+			continue
+		}
+
+		select {
+		case <-released:
+		case <-timeout:
+			return nil, constants.ErrConnQueueTimeout
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}
+}
+
+// writeBusy 达到并发上限时返回 503
+func writeBusy(w http.ResponseWriter, err error) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(constants.ConnQueueRetryAfter/time.Second)))
+	http.Error(w, err.Error(), http.StatusServiceUnavailable)
+}
+
+// busyReason 并发上限拒绝请求的原因，用于监控指标
+func busyReason(err error) string {
+	switch {
+	case errors.Is(err, constants.ErrConnQueueFull):
+		return "full"
+	case errors.Is(err, constants.ErrConnQueueTimeout):
+		return "timeout"
+	default:
+		return "busy"
+	}
+}
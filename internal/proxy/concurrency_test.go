@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb/circuit_breaker"
+	"go.uber.org/zap"
+)
+
+// blockingUpstream 收到请求后通知 entered，等待 release 后响应
+type blockingUpstream struct {
+	srv     *httptest.Server
+	entered chan string
+	release chan struct{}
+}
+
+func newBlockingUpstream(t *testing.T) *blockingUpstream {
+	t.Helper()
+	u := &blockingUpstream{entered: make(chan string, 8), release: make(chan struct{}, 8)}
+	u.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.entered <- r.URL.Query().Get("id")
+		select {
+		case <-u.release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(u.srv.Close)
+	return u
+}
+
+// waitEntered 等待上游收到指定请求
+func (u *blockingUpstream) waitEntered(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case id := <-u.entered:
+		if id != want {
+			t.Fatalf("upstream received request %q, want %q", id, want)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("request %q not forwarded", want)
+	}
+}
+
+// queueProxy 上游节点并发上限为 1 的反向代理
+func queueProxy(upstream string, queue model.ConnQueueConfig) *LoadBalanceReverseProxy {
+	return NewLoadBalanceReverseProxy(
+		"orders",
+		model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin, MaxConn: 1, Queue: queue},
+		[]*model.UpstreamsConfig{{Host: upstream}},
+		circuit_breaker.NewBreakerManager(),
+	)
+}
+
+// serveAsync 在后台发送请求，返回响应
+func serveAsync(ctx context.Context, p *LoadBalanceReverseProxy, id string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders?id="+id, nil).WithContext(ctx))
+		done <- w
+	}()
+	return done
+}
+
+func waitResponse(t *testing.T, done <-chan *httptest.ResponseRecorder) *httptest.ResponseRecorder {
+	t.Helper()
+	select {
+	case w := <-done:
+		return w
+	case <-time.After(3 * time.Second):
+		t.Fatal("request not finished")
+		return nil
+	}
+}
+
+// waitQueued 等待指定数量的请求进入队列
+func waitQueued(t *testing.T, p *LoadBalanceReverseProxy, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for p.queue.waiting.Load() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests queued, want %d", p.queue.waiting.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expectBusy(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+}
+
+func TestConcurrencyLimitWithoutQueue(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	upstream := newBlockingUpstream(t)
+	p := queueProxy(upstream.srv.URL, model.ConnQueueConfig{})
+
+	first := serveAsync(context.Background(), p, "1")
+	upstream.waitEntered(t, "1")
+
+	// 未配置队列时达到并发上限直接返回 503
+	w := waitResponse(t, serveAsync(context.Background(), p, "2"))
+	expectBusy(t, w)
+
+	upstream.release <- struct{}{}
+	if w := waitResponse(t, first); w.Code != http.StatusOK {
+		t.Errorf("first request status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestConnQueueHandoff(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	upstream := newBlockingUpstream(t)
+	p := queueProxy(upstream.srv.URL, model.ConnQueueConfig{Size: 1, Timeout: 5 * time.Second})
+
+	first := serveAsync(context.Background(), p, "1")
+	upstream.waitEntered(t, "1")
+	second := serveAsync(context.Background(), p, "2")
+	waitQueued(t, p, 1)
+
+	// 排队的请求在名额释放前不会被转发
+	select {
+	case id := <-upstream.entered:
+		t.Fatalf("request %q forwarded while the upstream is at its limit", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 前一个请求结束后名额交给排队的请求
+	upstream.release <- struct{}{}
+	if w := waitResponse(t, first); w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want %d", w.Code, http.StatusOK)
+	}
+	upstream.waitEntered(t, "2")
+	waitQueued(t, p, 0)
+	upstream.release <- struct{}{}
+	if w := waitResponse(t, second); w.Code != http.StatusOK {
+		t.Errorf("queued request status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if n, ok := p.InflightSnapshot()[upstream.srv.URL]; !ok || n != 0 {
+		t.Errorf("%d inflight requests after all finished (tracked = %v), want 0", n, ok)
+	}
+}
+
+func TestConnQueueFullAndTimeout(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	upstream := newBlockingUpstream(t)
+	timeout := 100 * time.Millisecond
+	p := queueProxy(upstream.srv.URL, model.ConnQueueConfig{Size: 1, Timeout: timeout})
+
+	first := serveAsync(context.Background(), p, "1")
+	upstream.waitEntered(t, "1")
+
+	// 队列已满时立即返回 503
+	start := time.Now()
+	queued := serveAsync(context.Background(), p, "2")
+	waitQueued(t, p, 1)
+	w := waitResponse(t, serveAsync(context.Background(), p, "3"))
+	expectBusy(t, w)
+	if w.Body.String() != constants.ErrConnQueueFull.Error()+"\n" {
+		t.Errorf("body = %q, want queue full", w.Body.String())
+	}
+
+	// 等待超时后返回 503
+	w = waitResponse(t, queued)
+	expectBusy(t, w)
+	if w.Body.String() != constants.ErrConnQueueTimeout.Error()+"\n" {
+		t.Errorf("body = %q, want queue timeout", w.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Errorf("queued request rejected after %v, want at least %v", elapsed, timeout)
+	}
+	waitQueued(t, p, 0)
+
+	upstream.release <- struct{}{}
+	waitResponse(t, first)
+}
+
+func TestConnQueueClientCancel(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	upstream := newBlockingUpstream(t)
+	p := queueProxy(upstream.srv.URL, model.ConnQueueConfig{Size: 1, Timeout: 5 * time.Second})
+
+	first := serveAsync(context.Background(), p, "1")
+	upstream.waitEntered(t, "1")
+
+	// 客户端断开后离开队列，不占用队列位置
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := serveAsync(ctx, p, "2")
+	waitQueued(t, p, 1)
+	cancel()
+	waitResponse(t, queued)
+	waitQueued(t, p, 0)
+
+	upstream.release <- struct{}{}
+	waitResponse(t, first)
+	select {
+	case id := <-upstream.entered:
+		t.Errorf("canceled request %q forwarded", id)
+	default:
+	}
+}
@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 跨域（CORS）
+// 1. 预检请求由 ServePreflight 直接响应，不转发给上游
+// 2. 实际请求的跨域响应头在 modifyResponse 中添加，并删除上游返回的跨域响应头，避免重复
+
+// 通配符匹配一级或多级子域名
+const originWildcard = `[a-z0-9-]+(?:\.[a-z0-9-]+)*`
+
+type CORSPolicy struct {
+	allowAll      bool
+	origins       map[string]bool
+	patterns      []*regexp.Regexp // 通配符和正则表达式
+	methods       map[string]bool
+	allowMethods  string
+	headers       map[string]bool // 为空时允许预检请求中的所有请求头
+	allowHeaders  string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+}
+
+// NewCORSPolicy 根据配置创建跨域策略，config 为空时返回 nil
+func NewCORSPolicy(config *model.CORSConfig) (*CORSPolicy, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	c := &CORSPolicy{
+		origins:       make(map[string]bool),
+		methods:       make(map[string]bool),
+		exposeHeaders: strings.Join(config.ExposeHeaders, ", "),
+		credentials:   config.AllowCredentials,
+	}
+	for _, origin := range config.AllowOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			c.allowAll = true
+		case strings.Contains(origin, "*"):
+			pattern := strings.ReplaceAll(regexp.QuoteMeta(origin), `\*`, originWildcard)
+			c.patterns = append(c.patterns, regexp.MustCompile("^"+pattern+"$"))
+		default:
+			c.origins[origin] = true
+		}
+	}
+	for _, expr := range config.AllowOriginRegexes {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid origin regex %q: %w", expr, err)
+		}
+		c.patterns = append(c.patterns, re)
+	}
+
+	methods := config.AllowMethods
+	if len(methods) == 0 {
+		methods = constants.CORSDefaultMethods
+	}
+	allowMethods := make([]string, 0, len(methods))
+	for _, method := range methods {
+		method = strings.ToUpper(method)
+		c.methods[method] = true
+		allowMethods = append(allowMethods, method)
+	}
+	c.allowMethods = strings.Join(allowMethods, ", ")
+
+	if len(config.AllowHeaders) > 0 && !slices.Contains(config.AllowHeaders, "*") {
+		c.headers = make(map[string]bool)
+		for _, header := range config.AllowHeaders {
+			c.headers[strings.ToLower(header)] = true
+		}
+		c.allowHeaders = strings.Join(config.AllowHeaders, ", ")
+	}
+
+	if config.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(config.MaxAge.Seconds()))
+	}
+	return c, nil
+}
+
+// IsCORSPreflight 是否为跨域预检请求
+func IsCORSPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// AllowOrigin 是否允许来源
+func (c *CORSPolicy) AllowOrigin(origin string) bool {
+	if c.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if c.origins[origin] {
+		return true
+	}
+	for _, re := range c.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServePreflight 响应预检请求，来源、方法或请求头不允许时返回 403
+func (c *CORSPolicy) ServePreflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+
+	origin := r.Header.Get("Origin")
+	if !c.AllowOrigin(origin) || !c.methods[r.Header.Get("Access-Control-Request-Method")] {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	allowHeaders := c.allowHeaders
+	requested := r.Header.Values("Access-Control-Request-Headers")
+	if c.headers == nil {
+		// 允许所有请求头时原样返回预检请求中的请求头（携带凭证时浏览器不支持 *）
+		allowHeaders = strings.Join(requested, ", ")
+	} else {
+		for _, v := range requested {
+			for _, name := range strings.Split(v, ",") {
+				if name = strings.ToLower(strings.TrimSpace(name)); name != "" && !c.headers[name] {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+			}
+		}
+	}
+
+	c.setOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", c.allowMethods)
+	if allowHeaders != "" {
+		h.Set("Access-Control-Allow-Headers", allowHeaders)
+	}
+	if c.maxAge != "" {
+		h.Set("Access-Control-Max-Age", c.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyResponse 为实际请求的响应添加跨域响应头
+func (c *CORSPolicy) applyResponse(r *http.Request, h http.Header) {
+	for name := range h {
+		if strings.HasPrefix(name, "Access-Control-") {
+			delete(h, name)
+		}
+	}
+	// 响应随来源变化时需要告知缓存
+	if !c.allowAll || c.credentials {
+		addVary(h, "Origin")
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !c.AllowOrigin(origin) {
+		return
+	}
+	c.setOrigin(h, origin)
+	if c.exposeHeaders != "" {
+		h.Set("Access-Control-Expose-Headers", c.exposeHeaders)
+	}
+}
+
+func (c *CORSPolicy) setOrigin(h http.Header, origin string) {
+	// 携带凭证时浏览器不支持 *，需要返回具体的来源
+	if c.allowAll && !c.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func addVary(h http.Header, name string) {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if field = strings.TrimSpace(field); field == "*" || strings.EqualFold(field, name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb/circuit_breaker"
+	"go.uber.org/zap"
+)
+
+func newTestCORSPolicy(t *testing.T, config *model.CORSConfig) *CORSPolicy {
+	t.Helper()
+	c, err := NewCORSPolicy(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func preflight(c *CORSPolicy, origin, method string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodOptions, "/orders", nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	for _, h := range headers {
+		r.Header.Add("Access-Control-Request-Headers", h)
+	}
+	w := httptest.NewRecorder()
+	c.ServePreflight(w, r)
+	return w
+}
+
+func TestCORSPreflight(t *testing.T) {
+	c := newTestCORSPolicy(t, &model.CORSConfig{
+		AllowOrigins:       []string{"https://app.example.com", "https://*.example.org"},
+		AllowOriginRegexes: []string{`https://pr-[0-9]+\.preview\.example\.com`},
+		AllowMethods:       []string{"get", "POST"},
+		AllowHeaders:       []string{"Authorization", "Content-Type"},
+		MaxAge:             10 * time.Minute,
+	})
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		headers []string
+		want    int
+	}{
+		{name: "exact origin", origin: "https://app.example.com", method: "GET", want: http.StatusNoContent},
+		{name: "origin case insensitive", origin: "https://APP.example.com", method: "GET", want: http.StatusNoContent},
+		{name: "wildcard subdomain", origin: "https://a.b.example.org", method: "POST", want: http.StatusNoContent},
+		{name: "wildcard requires subdomain", origin: "https://example.org", method: "GET", want: http.StatusForbidden},
+		{name: "wildcard suffix", origin: "https://a.example.org.evil.com", method: "GET", want: http.StatusForbidden},
+		{name: "regex", origin: "https://pr-42.preview.example.com", method: "GET", want: http.StatusNoContent},
+		{name: "regex full match", origin: "https://pr-42.preview.example.com.evil.com", method: "GET", want: http.StatusForbidden},
+		{name: "scheme mismatch", origin: "http://app.example.com", method: "GET", want: http.StatusForbidden},
+		{name: "method not allowed", origin: "https://app.example.com", method: "DELETE", want: http.StatusForbidden},
+		{name: "allowed headers", origin: "https://app.example.com", method: "GET", headers: []string{"authorization, content-type"}, want: http.StatusNoContent},
+		{name: "header not allowed", origin: "https://app.example.com", method: "GET", headers: []string{"Authorization", "X-Debug"}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := preflight(c, tt.origin, tt.method, tt.headers...)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			h := w.Header()
+			if h.Get("Vary") == "" {
+				t.Error("preflight response without Vary")
+			}
+			if tt.want != http.StatusNoContent {
+				if h.Get("Access-Control-Allow-Origin") != "" {
+					t.Errorf("rejected preflight Access-Control-Allow-Origin = %q", h.Get("Access-Control-Allow-Origin"))
+				}
+				return
+			}
+			want := map[string]string{
+				"Access-Control-Allow-Origin":      tt.origin,
+				"Access-Control-Allow-Methods":     "GET, POST",
+				"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+				"Access-Control-Max-Age":           "600",
+				"Access-Control-Allow-Credentials": "",
+			}
+			for name, v := range want {
+				if got := h.Get(name); got != v {
+					t.Errorf("%s = %q, want %q", name, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSPreflightAnyHeader(t *testing.T) {
+	c := newTestCORSPolicy(t, &model.CORSConfig{AllowOrigins: []string{"*"}})
+	w := preflight(c, "https://app.example.com", "PATCH", "X-Debug", "Content-Type")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	h := w.Header()
+	if got := h.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	// 未配置 allow_headers 时原样返回请求的请求头
+	if got := h.Get("Access-Control-Allow-Headers"); got != "X-Debug, Content-Type" {
+		t.Errorf("Access-Control-Allow-Headers = %q, want the requested headers", got)
+	}
+	if got := h.Get("Access-Control-Allow-Methods"); got != "GET, HEAD, POST, PUT, PATCH, DELETE" {
+		t.Errorf("Access-Control-Allow-Methods = %q, want the default methods", got)
+	}
+	if h.Get("Access-Control-Max-Age") != "" {
+		t.Error("Access-Control-Max-Age set without max_age")
+	}
+}
+
+func TestCORSCredentials(t *testing.T) {
+	c := newTestCORSPolicy(t, &model.CORSConfig{
+		AllowOrigins:     []string{"https://app.example.com"},
+		AllowCredentials: true,
+		ExposeHeaders:    []string{"X-Request-ID"},
+	})
+
+	// 携带凭证时返回具体的来源，不能使用 *
+	w := preflight(c, "https://app.example.com", "POST", "Authorization")
+	h := w.Header()
+	if w.Code != http.StatusNoContent || h.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		h.Get("Access-Control-Allow-Credentials") != "true" || h.Get("Access-Control-Allow-Headers") != "Authorization" {
+		t.Errorf("preflight status = %d headers = %v", w.Code, h)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	h = http.Header{}
+	c.applyResponse(r, h)
+	if h.Get("Access-Control-Allow-Origin") != "https://app.example.com" || h.Get("Access-Control-Allow-Credentials") != "true" ||
+		h.Get("Access-Control-Expose-Headers") != "X-Request-ID" || h.Get("Vary") != "Origin" {
+		t.Errorf("credentialed response headers = %v", h)
+	}
+
+	// 不允许的来源不返回跨域响应头，但仍需要 Vary: Origin
+	r.Header.Set("Origin", "https://evil.example.com")
+	h = http.Header{}
+	c.applyResponse(r, h)
+	if h.Get("Access-Control-Allow-Origin") != "" || h.Get("Access-Control-Allow-Credentials") != "" || h.Get("Vary") != "Origin" {
+		t.Errorf("disallowed origin response headers = %v", h)
+	}
+}
+
+func TestCORSActualResponse(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET")
+		w.Header().Set("Vary", "Accept-Encoding, origin")
+	}))
+	defer upstream.Close()
+
+	p := NewLoadBalanceReverseProxy(
+		"orders",
+		model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin},
+		[]*model.UpstreamsConfig{{Host: upstream.URL}},
+		circuit_breaker.NewBreakerManager(),
+	)
+	p.SetCORSPolicy(newTestCORSPolicy(t, &model.CORSConfig{AllowOrigins: []string{"https://app.example.com"}}))
+
+	// 上游返回的跨域响应头被网关的策略覆盖，Vary 中已有 Origin 时不重复添加
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	h := w.Header()
+	if got := h.Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", got)
+	}
+	if got := h.Get("Access-Control-Allow-Methods"); got != "" {
+		t.Errorf("upstream Access-Control-Allow-Methods = %q not removed", got)
+	}
+	if got := h.Values("Vary"); len(got) != 1 || got[0] != "Accept-Encoding, origin" {
+		t.Errorf("Vary = %q", got)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("disallowed origin Access-Control-Allow-Origin = %q", got)
+	}
+}
@@ -1,8 +1,11 @@
 package circuit_breaker
 
 import (
+	"context"
+	"errors"
 	"github.com/lccxxo/bailuoli/internal/constants"
 	"github.com/lccxxo/bailuoli/internal/model"
+	"reflect"
 	"sync"
 	"time"
 )
@@ -18,22 +21,53 @@ const (
 	StateHalfOpen
 )
 
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
 // CircuitBreaker 熔断器
 type CircuitBreaker struct {
+	// 所属路由及上游节点
+	route    string
+	upstream string
 	// 熔断器配置
 	config model.CircuitBreakerConfig
 	// 熔断器状态
 	state State
 	// 熔断器统计窗口
 	metrics Metrics
+	// 半开状态下正在进行的试探请求数
+	halfOpenPending int64
 	// 状态变更通知
 	stopChan chan State
-	mu       sync.RWMutex
+	// 熔断器被替换或移除时关闭，停止转发状态变更通知
+	done chan struct{}
+	mu   sync.RWMutex
 }
 
+// StateListener 熔断器状态变更监听函数
+type StateListener func(route, upstream string, state State)
+
+// BreakerManager 熔断器管理器
+// 熔断器按 路由名称/上游节点 区分，同一个上游节点在不同路由中使用各自的配置和统计窗口
 type BreakerManager struct {
-	breakers map[string]*CircuitBreaker
-	mu       sync.RWMutex
+	breakers  map[string]*CircuitBreaker // BreakerKey -> 熔断器
+	listeners []StateListener
+	mu        sync.RWMutex
+}
+
+// BreakerKey 熔断器的 key：路由名称/上游节点
+func BreakerKey(route, upstream string) string {
+	return route + "/" + upstream
 }
 
 func NewBreakerManager() *BreakerManager {
@@ -42,7 +76,9 @@ func NewBreakerManager() *BreakerManager {
 	}
 }
 
-func (m *BreakerManager) GetBreaker(key string, config model.CircuitBreakerConfig) *CircuitBreaker {
+// GetBreaker 获取熔断器，不存在时按 config 创建（服务发现、动态添加的上游节点）
+func (m *BreakerManager) GetBreaker(route, upstream string, config model.CircuitBreakerConfig) *CircuitBreaker {
+	key := BreakerKey(route, upstream)
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -50,18 +86,108 @@ func (m *BreakerManager) GetBreaker(key string, config model.CircuitBreakerConfi
 		return b
 	}
 
-	b := NewCircuitBreaker(config)
+	b := NewCircuitBreaker(route, upstream, config)
 	m.breakers[key] = b
+	m.watch(b)
 	return b
 }
 
-func (m *BreakerManager) SetBreaker(key string, breaker *model.CircuitBreakerConfig) {
+// SetBreaker 设置上游节点的熔断器，配置未变化时保留原熔断器（及其状态和统计窗口）
+func (m *BreakerManager) SetBreaker(route, upstream string, breaker *model.CircuitBreakerConfig) {
+	key := BreakerKey(route, upstream)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if old, ok := m.breakers[key]; ok {
+		if reflect.DeepEqual(old.config, *breaker) {
+			return
+		}
+		close(old.done)
+	}
+	b := NewCircuitBreaker(route, upstream, *breaker)
+	m.breakers[key] = b
+	m.watch(b)
+}
+
+// RemoveBreaker 移除上游节点的熔断器（节点被移除或服务发现不再返回该节点）
+func (m *BreakerManager) RemoveBreaker(route, upstream string) {
+	key := BreakerKey(route, upstream)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if b, ok := m.breakers[key]; ok {
+		close(b.done)
+		delete(m.breakers, key)
+	}
+}
+
+// RemoveUnused 移除 used 之外的熔断器（路由热更新后删除的路由和上游节点），used 的 key 为 BreakerKey
+func (m *BreakerManager) RemoveUnused(used map[string]bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, b := range m.breakers {
+		if !used[key] {
+			close(b.done)
+			delete(m.breakers, key)
+		}
+	}
+}
+
+// AddListener 注册熔断器状态变更监听
+func (m *BreakerManager) AddListener(listener StateListener) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+// watch 将熔断器 stopChan 中的状态变更通知转发给监听者（调用方需持有锁）
+func (m *BreakerManager) watch(b *CircuitBreaker) {
+	go func() {
+		for {
+			select {
+			case state := <-b.stopChan:
+				m.mu.RLock()
+				listeners := m.listeners
+				m.mu.RUnlock()
+				for _, listener := range listeners {
+					listener(b.route, b.upstream, state)
+				}
+			case <-b.done:
+				return
+			}
+		}
+	}()
+}
 
-	m.breakers[key] = NewCircuitBreaker(*breaker)
+// Breaker 获取已存在的熔断器
+func (m *BreakerManager) Breaker(route, upstream string) (*CircuitBreaker, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	return
+	b, ok := m.breakers[BreakerKey(route, upstream)]
+	return b, ok
+}
+
+// Allow 判断上游节点是否可以接收请求（没有熔断器的节点默认可用）
+func (m *BreakerManager) Allow(route, upstream string) bool {
+	b, ok := m.Breaker(route, upstream)
+	if !ok {
+		return true
+	}
+	return b.Available()
+}
+
+// Snapshot 获取所有熔断器的状态快照，key 为 BreakerKey
+func (m *BreakerManager) Snapshot() map[string]Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snapshot := make(map[string]Snapshot, len(m.breakers))
+	for key, b := range m.breakers {
+		snapshot[key] = b.Snapshot()
+	}
+	return snapshot
 }
 
 // Metrics 熔断器统计窗口
@@ -74,29 +200,99 @@ type Metrics struct {
 	WindowDuration    time.Duration // 统计窗口时长（例如10秒）
 }
 
-func NewCircuitBreaker(config model.CircuitBreakerConfig) *CircuitBreaker {
+func NewCircuitBreaker(route, upstream string, config model.CircuitBreakerConfig) *CircuitBreaker {
 	return &CircuitBreaker{
-		config: config,
-		state:  StateClosed,
+		route:    route,
+		upstream: upstream,
+		config:   config,
+		state:    StateClosed,
 		metrics: Metrics{
 			WindowDuration: config.WindowDuration,
 			WindowStart:    time.Now(),
 		},
 		stopChan: make(chan State, 10),
+		done:     make(chan struct{}),
+	}
+}
+
+// State 获取熔断器当前状态
+func (c *CircuitBreaker) State() State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state
+}
+
+// Available 判断当前是否可以放行请求，与 allow 的判断一致但不占用半开状态的试探名额
+func (c *CircuitBreaker) Available() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	switch c.state {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		return c.metrics.Requests+c.halfOpenPending < c.halfOpenMax()
+	}
+	return true
+}
+
+// Snapshot 熔断器状态及统计窗口快照
+type Snapshot struct {
+	Route             string    `json:"route"`
+	Upstream          string    `json:"upstream"`
+	State             string    `json:"state"`
+	Requests          int64     `json:"requests"`
+	TotalSuccesses    int64     `json:"total_successes"`
+	TotalFailures     int64     `json:"total_failures"`
+	ConsecutiveErrors int64     `json:"consecutive_errors"`
+	WindowStart       time.Time `json:"window_start"`
+}
+
+func (c *CircuitBreaker) Snapshot() Snapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return Snapshot{
+		Route:             c.route,
+		Upstream:          c.upstream,
+		State:             c.state.String(),
+		Requests:          c.metrics.Requests,
+		TotalSuccesses:    c.metrics.TotalSuccesses,
+		TotalFailures:     c.metrics.TotalFailures,
+		ConsecutiveErrors: c.metrics.ConsecutiveErrors,
+		WindowStart:       c.metrics.WindowStart,
+	}
+}
+
+// IsFailureStatus 判断响应状态码是否计为失败
+func (c *CircuitBreaker) IsFailureStatus(code int) bool {
+	if len(c.config.FailureStatusCodes) == 0 {
+		return code >= 500
+	}
+	for _, s := range c.config.FailureStatusCodes {
+		if s == code {
+			return true
+		}
 	}
+	return false
 }
 
 // shouldTrip 判断是否需要熔断
 func (c *CircuitBreaker) shouldTrip() bool {
+	// 未配置任何阈值时不触发熔断
+	if c.config.ConsecutiveErrorTrigger == 0 && c.config.FailureThreshold == 0 {
+		return false
+	}
+
 	//	有两种情况需要熔断：
 	//	1. 连续错误次数超过阈值
 	//	2. 窗口统计错误率超过阈值
-	if c.metrics.ConsecutiveErrors > c.config.ConsecutiveErrorTrigger {
+	if c.config.ConsecutiveErrorTrigger > 0 && c.metrics.ConsecutiveErrors > c.config.ConsecutiveErrorTrigger {
 		return true
 	}
 
 	total := c.metrics.Requests
-	if total == 0 {
+	if total == 0 || c.config.FailureThreshold == 0 {
 		return false
 	}
 
@@ -104,6 +300,14 @@ func (c *CircuitBreaker) shouldTrip() bool {
 	return failure > c.config.FailureThreshold
 }
 
+// 半开状态允许的最大试探请求数（至少为1）
+func (c *CircuitBreaker) halfOpenMax() int64 {
+	if c.config.HalfOpenMaxRequests <= 0 {
+		return 1
+	}
+	return c.config.HalfOpenMaxRequests
+}
+
 // 重置熔断器统计窗口
 func (c *CircuitBreaker) resetMetrics() {
 	c.metrics.ConsecutiveErrors = 0
@@ -111,6 +315,17 @@ func (c *CircuitBreaker) resetMetrics() {
 	c.metrics.TotalSuccesses = 0
 	c.metrics.Requests = 0
 	c.metrics.WindowStart = time.Now()
+	c.halfOpenPending = 0
+}
+
+// 关闭状态下统计窗口到期后滚动窗口
+func (c *CircuitBreaker) rollWindow() {
+	if c.state != StateClosed || c.metrics.WindowDuration <= 0 {
+		return
+	}
+	if time.Since(c.metrics.WindowStart) > c.metrics.WindowDuration {
+		c.resetMetrics()
+	}
 }
 
 // recordSuccess 记录成功
@@ -120,7 +335,7 @@ func (c *CircuitBreaker) recordSuccess() {
 	c.metrics.ConsecutiveErrors = 0
 
 	// 请求成功后，如果当前状态是半开状态，判断是否需要切换到关闭状态
-	if c.state == StateHalfOpen && c.metrics.TotalSuccesses >= c.config.HalfOpenMaxRequests {
+	if c.state == StateHalfOpen && c.metrics.TotalSuccesses >= c.halfOpenMax() {
 		//	关闭熔断
 		c.setState(StateClosed)
 	}
@@ -138,11 +353,8 @@ func (c *CircuitBreaker) recordFailure() {
 	}
 }
 
-// setState 设置熔断器状态
+// setState 设置熔断器状态（调用方需持有锁）
 func (c *CircuitBreaker) setState(newState State) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	oldState := c.state
 	if newState == oldState {
 		return
@@ -152,7 +364,11 @@ func (c *CircuitBreaker) setState(newState State) {
 	case StateOpen:
 		// 开启熔断时启动超时计时器
 		time.AfterFunc(c.config.OpenStateTimeout, func() {
-			c.setState(StateHalfOpen)
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.state == StateOpen {
+				c.setState(StateHalfOpen)
+			}
 		})
 		c.resetMetrics()
 	case StateHalfOpen:
@@ -168,23 +384,48 @@ func (c *CircuitBreaker) setState(newState State) {
 	}
 }
 
-// Execute 执行逻辑
-func (c *CircuitBreaker) Execute(req func() error) error {
+// allow 判断当前是否放行请求
+func (c *CircuitBreaker) allow() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.rollWindow()
+
 	switch c.state {
 	case StateOpen:
 		return constants.ErrCircuitBreakerOpen
 	case StateHalfOpen:
-		if c.metrics.Requests > c.config.HalfOpenMaxRequests {
+		if c.metrics.Requests+c.halfOpenPending >= c.halfOpenMax() {
 			return constants.ErrCircuitBreakerOpen
 		}
+		c.halfOpenPending++
+	}
+	return nil
+}
+
+// Execute 执行逻辑（请求执行期间不持有锁）
+func (c *CircuitBreaker) Execute(req func() error) error {
+	if err := c.allow(); err != nil {
+		return err
+	}
+
+	err := req()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == StateHalfOpen && c.halfOpenPending > 0 {
+		c.halfOpenPending--
+	}
+
+	// 客户端取消的请求不计入统计
+	if errors.Is(err, context.Canceled) {
+		return err
 	}
 
-	if err := req(); err != nil {
+	if err != nil {
 		c.recordFailure()
-		if c.shouldTrip() {
+		if c.state == StateClosed && c.shouldTrip() {
 			c.setState(StateOpen)
 		}
 		return err
@@ -0,0 +1,111 @@
+package lb
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 一致性哈希负载均衡策略（ketama 哈希环）
+// 每个节点按权重在哈希环上放置多个虚拟节点，请求的 key 落在环上后顺时针选择第一个虚拟节点
+// 增减节点时只有相邻区间的 key 会重新映射；节点不可用时继续顺时针查找下一个可用节点
+
+type ConsistentHashLoadBalancer struct {
+	BaseLoadBalancer
+	key          model.HashKeyConfig
+	weight       map[string]int
+	virtualNodes int
+
+	ringMu sync.Mutex // 串行化节点变化和哈希环重建
+	ring   atomic.Pointer[hashRing]
+}
+
+type hashRing struct {
+	points    []ringPoint // 按 hash 升序
+	upstreams int         // 节点数
+}
+
+type ringPoint struct {
+	hash     uint64
+	upstream *url.URL
+}
+
+func NewConsistentHashLoadBalancer(upstreams []*url.URL, config model.LoadBalanceConfig) *ConsistentHashLoadBalancer {
+	b := &ConsistentHashLoadBalancer{
+		BaseLoadBalancer: BaseLoadBalancer{
+			upstreams: upstreams,
+			mu:        sync.RWMutex{},
+		},
+		key:          config.HashKey,
+		weight:       config.Weighted,
+		virtualNodes: config.VirtualNodes,
+	}
+	if b.virtualNodes <= 0 {
+		b.virtualNodes = constants.DefaultVirtualNodes
+	}
+	b.rebuild()
+	return b
+}
+
+func (b *ConsistentHashLoadBalancer) Next(r *http.Request) (*url.URL, error) {
+	available, err := b.availableUpstreams()
+	if err != nil {
+		return nil, err
+	}
+
+	ring := b.ring.Load()
+	points := ring.points
+	if len(points) == 0 {
+		return nil, constants.ErrNoUpstreams
+	}
+	h := hash64(hashKey(r, b.key))
+	start := sort.Search(len(points), func(i int) bool { return points[i].hash >= h })
+
+	set := availableSet(available, ring.upstreams)
+	for i := 0; i < len(points); i++ {
+		p := points[(start+i)%len(points)]
+		if set == nil || set[p.upstream.String()] {
+			return p.upstream, nil
+		}
+	}
+	// 可用节点不在哈希环上（节点变化与重建之间的短暂窗口）
+	return available[int(h%uint64(len(available)))], nil
+}
+
+// AddUpstream 添加上游节点并重建哈希环
+func (b *ConsistentHashLoadBalancer) AddUpstream(upstream *url.URL) {
+	b.ringMu.Lock()
+	defer b.ringMu.Unlock()
+	b.BaseLoadBalancer.AddUpstream(upstream)
+	b.rebuild()
+}
+
+// RemoveUpstream 移除上游节点并重建哈希环
+func (b *ConsistentHashLoadBalancer) RemoveUpstream(upstream *url.URL) {
+	b.ringMu.Lock()
+	defer b.ringMu.Unlock()
+	b.BaseLoadBalancer.RemoveUpstream(upstream)
+	b.rebuild()
+}
+
+func (b *ConsistentHashLoadBalancer) rebuild() {
+	upstreams := b.Upstreams()
+	ring := &hashRing{upstreams: len(upstreams)}
+	for _, u := range upstreams {
+		n := b.virtualNodes * upstreamWeight(b.weight, u)
+		for i := 0; i < n; i++ {
+			ring.points = append(ring.points, ringPoint{
+				hash:     hash64(fmt.Sprintf("%s#%d", u.String(), i)),
+				upstream: u,
+			})
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i].hash < ring.points[j].hash })
+	b.ring.Store(ring)
+}
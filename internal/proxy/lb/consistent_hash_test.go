@@ -0,0 +1,116 @@
+package lb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb/circuit_breaker"
+)
+
+const (
+	remapHosts = 10
+	remapKeys  = 10000
+)
+
+var hashKeyConfig = model.LoadBalanceConfig{
+	HashKey: model.HashKeyConfig{Source: constants.HashKeyHeader, Name: "X-Key"},
+}
+
+func testUpstreams(n int) []*url.URL {
+	upstreams := make([]*url.URL, 0, n)
+	for i := 0; i < n; i++ {
+		upstreams = append(upstreams, &url.URL{Scheme: "http", Host: fmt.Sprintf("10.0.0.%d:8080", i+1)})
+	}
+	return upstreams
+}
+
+// assign 固定 key 集合映射到的节点
+func assign(t *testing.T, b LoadBalancer) []string {
+	t.Helper()
+	result := make([]string, remapKeys)
+	for i := range result {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Key", fmt.Sprintf("key-%d", i))
+		u, err := b.Next(r)
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		result[i] = u.String()
+	}
+	return result
+}
+
+// newOpenBreakers 创建熔断器管理器，路由 orders 中指定节点的熔断器处于打开状态
+func newOpenBreakers(upstreams ...*url.URL) *circuit_breaker.BreakerManager {
+	m := circuit_breaker.NewBreakerManager()
+	config := model.CircuitBreakerConfig{ConsecutiveErrorTrigger: 1, OpenStateTimeout: time.Hour}
+	for _, u := range upstreams {
+		b := m.GetBreaker("orders", u.String(), config)
+		for i := 0; i < 2; i++ {
+			_ = b.Execute(func() error { return errors.New("upstream failure") })
+		}
+	}
+	return m
+}
+
+// remapStats 移除节点前后的映射变化：moved 为重新映射的 key 比例，stray 为原本不属于被移除节点却被重新映射的 key 数
+func remapStats(t *testing.T, b LoadBalancer, removed *url.URL) (moved float64, stray int) {
+	t.Helper()
+	before := assign(t, b)
+	b.RemoveUpstream(removed)
+	after := assign(t, b)
+
+	changed := 0
+	for i := range before {
+		if after[i] == removed.String() {
+			t.Fatalf("key-%d still mapped to removed upstream %s", i, removed)
+		}
+		if before[i] == after[i] {
+			continue
+		}
+		changed++
+		if before[i] != removed.String() {
+			stray++
+		}
+	}
+	return float64(changed) / remapKeys, stray
+}
+
+func TestConsistentHashRemoveUpstream(t *testing.T) {
+	upstreams := testUpstreams(remapHosts)
+	b := NewConsistentHashLoadBalancer(upstreams, hashKeyConfig)
+
+	moved, stray := remapStats(t, b, upstreams[3])
+	// 期望重新映射约 1/N 的 key
+	if expected := 1.0 / remapHosts; moved < expected/2 || moved > expected*2 {
+		t.Errorf("remapped %.2f%% of keys, want about %.2f%%", moved*100, expected*100)
+	}
+	if stray != 0 {
+		t.Errorf("%d keys not owned by the removed upstream were remapped", stray)
+	}
+}
+
+func TestConsistentHashUnavailableUpstream(t *testing.T) {
+	upstreams := testUpstreams(remapHosts)
+	b := NewConsistentHashLoadBalancer(upstreams, hashKeyConfig)
+	before := assign(t, b)
+
+	// 熔断的节点仍在哈希环上，其 key 顺时针落到下一个可用节点，其他 key 不受影响
+	b.SetBreakerManager("orders", newOpenBreakers(upstreams[3]))
+	after := assign(t, b)
+	for i := range before {
+		if before[i] != upstreams[3].String() && before[i] != after[i] {
+			t.Fatalf("key-%d moved from %s to %s", i, before[i], after[i])
+		}
+		if after[i] == upstreams[3].String() {
+			t.Fatalf("key-%d mapped to unavailable upstream", i)
+		}
+	}
+}
@@ -12,19 +12,128 @@ type ConnTracker interface {
 
 type ConnCounter struct {
 	counters map[string]*atomic.Int64
+	total    atomic.Int64 // 所有节点的连接数之和
 	mu       sync.RWMutex
 }
 
+func NewConnCounter() *ConnCounter {
+	return &ConnCounter{
+		counters: make(map[string]*atomic.Int64),
+	}
+}
+
 func (c *ConnCounter) Acquire(host string) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	c.counters[host].Add(1)
+	if counter, ok := c.counters[host]; ok {
+		counter.Add(1)
+		c.total.Add(1)
+	}
+}
+
+// TryAcquire 节点连接数小于 limit 且总连接数小于 totalLimit 时加1，返回是否成功，limit 为0表示不限制
+func (c *ConnCounter) TryAcquire(host string, limit, totalLimit int64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	counter, ok := c.counters[host]
+	if !ok {
+		return true
+	}
+	if !tryIncrement(&c.total, totalLimit) {
+		return false
+	}
+	if !tryIncrement(counter, limit) {
+		c.total.Add(-1)
+		return false
+	}
+	return true
 }
 
 func (c *ConnCounter) Release(host string) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	if v := c.counters[host].Load(); v > 0 {
-		c.counters[host].Add(-1)
+	if counter, ok := c.counters[host]; ok && counter.Load() > 0 {
+		counter.Add(-1)
+		c.total.Add(-1)
+	}
+}
+
+// Load 获取当前连接数
+func (c *ConnCounter) Load(host string) int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if counter, ok := c.counters[host]; ok {
+		return counter.Load()
+	}
+	return 0
+}
+
+// Total 获取所有节点的连接数之和
+func (c *ConnCounter) Total() int64 {
+	return c.total.Load()
+}
+
+// Snapshot 获取所有节点的连接数快照
+func (c *ConnCounter) Snapshot() map[string]int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snapshot := make(map[string]int64, len(c.counters))
+	for host, counter := range c.counters {
+		snapshot[host] = counter.Load()
+	}
+	return snapshot
+}
+
+// Register 初始化节点计数（已存在则保留原计数）
+func (c *ConnCounter) Register(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.counters[host]; !ok {
+		c.counters[host] = &atomic.Int64{}
+	}
+}
+
+// Unregister 删除节点计数
+func (c *ConnCounter) Unregister(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if counter, ok := c.counters[host]; ok {
+		// 节点删除后释放连接不会再减少计数
+		c.total.Add(-counter.Load())
+		delete(c.counters, host)
 	}
 }
+
+// tryIncrement 小于 limit 时加1，limit 为0表示不限制
+func tryIncrement(v *atomic.Int64, limit int64) bool {
+	for {
+		n := v.Load()
+		if limit > 0 && n >= limit {
+			return false
+		}
+		if v.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// ConnLimits 并发请求数上限，为0表示不限制
+type ConnLimits struct {
+	Default   int64            // 每个上游节点的上限
+	Upstreams map[string]int64 // 单独配置了上限的上游节点 key: upstream url
+	Total     int64            // 路由所有上游节点的总上限
+}
+
+// Upstream 获取上游节点的上限
+func (l *ConnLimits) Upstream(key string) int64 {
+	if limit, ok := l.Upstreams[key]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// Enabled 是否配置了上限
+func (l *ConnLimits) Enabled() bool {
+	return l != nil && (l.Default > 0 || l.Total > 0 || len(l.Upstreams) > 0)
+}
@@ -0,0 +1,151 @@
+package lb
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 基于延迟的负载均衡策略（Peak EWMA）
+// 节点的负载为 (正在处理的请求数 + 1) * 延迟的指数加权移动平均，选择负载最小的节点
+// 1. 延迟高于当前平均值时直接取新值（peak），节点变慢时立即减少分配；低于时按 decay 平滑下降
+// 2. 读取负载时按距离上次反馈的时间衰减，长时间没有请求的节点负载逐渐降低，之后会被重新试探
+// 3. p2c 随机选择两个可用节点比较，每次选择为 O(1)，适合节点较多的路由
+// 4. ewma 比较所有可用节点，每次选择为 O(n)（不持有负载均衡器的锁，每个节点只短暂持有统计锁），
+//    总是选择当前负载最小的节点，适合节点较少、需要尽快避开慢节点的路由
+// 请求数来自反向代理的 ConnCounter，延迟由反向代理在 modifyResponse、errHandler 中反馈
+
+// LatencyObserver 需要反向代理反馈转发延迟的负载均衡器
+type LatencyObserver interface {
+	ObserveLatency(upstream string, latency time.Duration)
+}
+
+type PeakEWMALoadBalancer struct {
+	BaseLoadBalancer
+	inflight *ConnCounter // 反向代理的请求计数 key: upstream url
+	decay    time.Duration
+	choices  int // 每次比较的节点数，0 表示所有节点
+
+	statsMu sync.Mutex
+	stats   map[string]*ewmaStat // upstream url -> 延迟统计
+}
+
+type ewmaStat struct {
+	latency float64 // 纳秒
+	updated time.Time
+}
+
+// NewP2CLoadBalancer 随机选择两个节点比较负载（power of two choices）
+func NewP2CLoadBalancer(upstreams []*url.URL, config model.LoadBalanceConfig, inflight *ConnCounter) *PeakEWMALoadBalancer {
+	return newPeakEWMALoadBalancer(upstreams, config, inflight, 2)
+}
+
+// NewEWMALoadBalancer 比较所有节点的负载
+func NewEWMALoadBalancer(upstreams []*url.URL, config model.LoadBalanceConfig, inflight *ConnCounter) *PeakEWMALoadBalancer {
+	return newPeakEWMALoadBalancer(upstreams, config, inflight, 0)
+}
+
+func newPeakEWMALoadBalancer(upstreams []*url.URL, config model.LoadBalanceConfig, inflight *ConnCounter, choices int) *PeakEWMALoadBalancer {
+	decay := config.EWMADecay
+	if decay <= 0 {
+		decay = constants.DefaultEWMADecay
+	}
+	return &PeakEWMALoadBalancer{
+		BaseLoadBalancer: BaseLoadBalancer{
+			upstreams: upstreams,
+			mu:        sync.RWMutex{},
+		},
+		inflight: inflight,
+		decay:    decay,
+		choices:  choices,
+		stats:    make(map[string]*ewmaStat),
+	}
+}
+
+func (b *PeakEWMALoadBalancer) Next(r *http.Request) (*url.URL, error) {
+	upstreams, err := b.availableUpstreams()
+	if err != nil {
+		return nil, err
+	}
+	n := len(upstreams)
+	if n == 1 {
+		return upstreams[0], nil
+	}
+
+	if b.choices == 2 {
+		i := rand.Intn(n)
+		j := rand.Intn(n - 1)
+		if j >= i {
+			j++
+		}
+		now := time.Now()
+		if b.costAt(upstreams[j], now) < b.costAt(upstreams[i], now) {
+			return upstreams[j], nil
+		}
+		return upstreams[i], nil
+	}
+
+	// 比较所有节点（见文件开头的说明），从随机位置开始，负载相同时（如刚启动）不会总是选择第一个节点
+	now := time.Now()
+	start := rand.Intn(n)
+	best, bestCost := upstreams[start], b.costAt(upstreams[start], now)
+	for i := 1; i < n; i++ {
+		u := upstreams[(start+i)%n]
+		if c := b.costAt(u, now); c < bestCost {
+			best, bestCost = u, c
+		}
+	}
+	return best, nil
+}
+
+// ObserveLatency 记录一次转发的延迟
+func (b *PeakEWMALoadBalancer) ObserveLatency(upstream string, latency time.Duration) {
+	now := time.Now()
+	rtt := float64(latency)
+
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	s, ok := b.stats[upstream]
+	if !ok {
+		b.stats[upstream] = &ewmaStat{latency: rtt, updated: now}
+		return
+	}
+	if rtt > s.latency {
+		s.latency = rtt
+	} else {
+		w := math.Exp(-float64(now.Sub(s.updated)) / float64(b.decay))
+		s.latency = s.latency*w + rtt*(1-w)
+	}
+	s.updated = now
+}
+
+// costAt 节点在 now 时的负载，没有延迟数据的节点使用默认延迟
+// 延迟按距离上次反馈的时间衰减（不修改保存的值），空闲节点不会一直保持很高的负载而不再被选择
+func (b *PeakEWMALoadBalancer) costAt(u *url.URL, now time.Time) float64 {
+	key := u.String()
+	latency := float64(constants.DefaultEWMALatency)
+	b.statsMu.Lock()
+	if s, ok := b.stats[key]; ok {
+		latency = s.latency
+		if elapsed := now.Sub(s.updated); elapsed > 0 {
+			latency *= math.Exp(-float64(elapsed) / float64(b.decay))
+		}
+	}
+	b.statsMu.Unlock()
+	return float64(b.inflight.Load(key)+1) * latency
+}
+
+// RemoveUpstream 移除上游节点 (并删除延迟统计)
+func (b *PeakEWMALoadBalancer) RemoveUpstream(upstream *url.URL) {
+	b.BaseLoadBalancer.RemoveUpstream(upstream)
+
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	delete(b.stats, upstream.String())
+}
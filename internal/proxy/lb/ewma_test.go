@@ -0,0 +1,142 @@
+package lb
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+func newTestEWMA(upstreams []*url.URL, decay time.Duration) (*PeakEWMALoadBalancer, *ConnCounter) {
+	inflight := NewConnCounter()
+	for _, u := range upstreams {
+		inflight.Register(u.String())
+	}
+	// RemoveUpstream 会修改传入的切片，使用副本
+	return NewEWMALoadBalancer(slices.Clone(upstreams), model.LoadBalanceConfig{EWMADecay: decay}, inflight), inflight
+}
+
+// expectPick 多次选择都返回 want（ewma 从随机位置开始比较，负载不同时结果应当确定）
+func expectPick(t *testing.T, b LoadBalancer, want *url.URL) {
+	t.Helper()
+	for i := 0; i < 50; i++ {
+		u, err := b.Next(httptest.NewRequest(http.MethodGet, "/", nil))
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if u.String() != want.String() {
+			t.Fatalf("picked %s, want %s", u, want)
+		}
+	}
+}
+
+func TestEWMAPicksLowestCost(t *testing.T) {
+	upstreams := testUpstreams(3)
+	b, inflight := newTestEWMA(upstreams, time.Minute)
+	b.ObserveLatency(upstreams[0].String(), 10*time.Millisecond)
+	b.ObserveLatency(upstreams[1].String(), 50*time.Millisecond)
+	b.ObserveLatency(upstreams[2].String(), 100*time.Millisecond)
+	expectPick(t, b, upstreams[0])
+
+	// 负载为 (请求数 + 1) * 延迟，请求堆积的快节点让给其他节点
+	for i := 0; i < 9; i++ {
+		inflight.Acquire(upstreams[0].String())
+	}
+	expectPick(t, b, upstreams[1])
+	for i := 0; i < 9; i++ {
+		inflight.Release(upstreams[0].String())
+	}
+	expectPick(t, b, upstreams[0])
+
+	// 延迟升高时立即取新值（peak），不等待平均值变化
+	b.ObserveLatency(upstreams[0].String(), 200*time.Millisecond)
+	expectPick(t, b, upstreams[1])
+}
+
+func TestEWMAUnobservedUpstream(t *testing.T) {
+	upstreams := testUpstreams(3)
+	b, _ := newTestEWMA(upstreams, time.Minute)
+	b.ObserveLatency(upstreams[0].String(), 2*constants.DefaultEWMALatency)
+	b.ObserveLatency(upstreams[1].String(), 3*constants.DefaultEWMALatency)
+
+	// 没有延迟数据的节点（如新加入的节点）使用默认延迟，会被优先试探
+	expectPick(t, b, upstreams[2])
+}
+
+func TestEWMASkipsUnavailable(t *testing.T) {
+	upstreams := testUpstreams(3)
+	b, _ := newTestEWMA(upstreams, time.Minute)
+	b.ObserveLatency(upstreams[0].String(), 10*time.Millisecond)
+	b.ObserveLatency(upstreams[1].String(), 50*time.Millisecond)
+	b.ObserveLatency(upstreams[2].String(), 100*time.Millisecond)
+
+	// 熔断的节点即使负载最小也不会被选择
+	b.SetBreakerManager("orders", newOpenBreakers(upstreams[0]))
+	expectPick(t, b, upstreams[1])
+
+	// 移除节点时删除延迟统计
+	b.RemoveUpstream(upstreams[1])
+	b.statsMu.Lock()
+	_, ok := b.stats[upstreams[1].String()]
+	b.statsMu.Unlock()
+	if ok {
+		t.Error("stats of the removed upstream kept")
+	}
+	expectPick(t, b, upstreams[2])
+}
+
+func TestEWMADecay(t *testing.T) {
+	upstreams := testUpstreams(1)
+	key := upstreams[0].String()
+	b, _ := newTestEWMA(upstreams, 100*time.Millisecond)
+	latency := func() float64 {
+		b.statsMu.Lock()
+		defer b.statsMu.Unlock()
+		return b.stats[key].latency
+	}
+
+	// 延迟下降时按 decay 平滑，间隔越短越接近原来的平均值
+	b.ObserveLatency(key, 100*time.Millisecond)
+	b.ObserveLatency(key, 0)
+	if got := latency(); got < float64(90*time.Millisecond) {
+		t.Errorf("latency right after a fast response = %v, want close to 100ms", time.Duration(got))
+	}
+	time.Sleep(300 * time.Millisecond)
+	b.ObserveLatency(key, 0)
+	if got := latency(); got > float64(10*time.Millisecond) {
+		t.Errorf("latency after 3 decay periods = %v, want close to 0", time.Duration(got))
+	}
+
+	// 读取负载时按空闲时间衰减，不修改保存的值
+	b.ObserveLatency(key, 100*time.Millisecond)
+	b.statsMu.Lock()
+	updated := b.stats[key].updated
+	b.statsMu.Unlock()
+	want := float64(100*time.Millisecond) * math.Exp(-1)
+	if got := b.costAt(upstreams[0], updated.Add(100*time.Millisecond)); math.Abs(got-want) > float64(time.Millisecond) {
+		t.Errorf("cost after one idle decay period = %v, want %v", time.Duration(got), time.Duration(want))
+	}
+	if got := latency(); got != float64(100*time.Millisecond) {
+		t.Errorf("stored latency changed to %v by costAt", time.Duration(got))
+	}
+}
+
+func TestP2CPicksLowerCost(t *testing.T) {
+	upstreams := testUpstreams(2)
+	inflight := NewConnCounter()
+	for _, u := range upstreams {
+		inflight.Register(u.String())
+	}
+	b := NewP2CLoadBalancer(upstreams, model.LoadBalanceConfig{}, inflight)
+	b.ObserveLatency(upstreams[0].String(), 100*time.Millisecond)
+	b.ObserveLatency(upstreams[1].String(), 10*time.Millisecond)
+
+	// 只有两个节点时每次都比较这两个节点
+	expectPick(t, b, upstreams[1])
+}
@@ -0,0 +1,60 @@
+package lb
+
+import (
+	"hash/fnv"
+	"net/http"
+	"net/url"
+
+	"github.com/lccxxo/bailuoli/internal/clientip"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 一致性哈希（consistent_hash、maglev）共用的哈希 key 和哈希函数
+// 哈希函数不依赖进程随机种子，多个网关实例对同一个 key 选择相同的节点
+
+// hashKey 根据配置获取请求的哈希 key，请求中没有对应的值时使用客户端 IP
+func hashKey(r *http.Request, config model.HashKeyConfig) string {
+	switch config.Source {
+	case constants.HashKeyHeader:
+		if v := r.Header.Get(config.Name); v != "" {
+			return v
+		}
+	case constants.HashKeyCookie:
+		if c, err := r.Cookie(config.Name); err == nil && c.Value != "" {
+			return c.Value
+		}
+	case constants.HashKeyQuery:
+		if v := r.URL.Query().Get(config.Name); v != "" {
+			return v
+		}
+	case constants.HashKeyPath:
+		return r.URL.Path
+	}
+	return clientip.FromRequest(r)
+}
+
+// hash64 FNV-1a 哈希，再经过 splitmix64 混淆，使相近的输入（如 host-1、host-2）分布均匀
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// availableSet 可用节点集合，所有节点都可用时返回 nil
+func availableSet(available []*url.URL, total int) map[string]bool {
+	if len(available) == total {
+		return nil
+	}
+	set := make(map[string]bool, len(available))
+	for _, u := range available {
+		set[u.String()] = true
+	}
+	return set
+}
@@ -2,6 +2,7 @@ package healthy
 
 import (
 	"context"
+	"github.com/lccxxo/bailuoli/internal/constants"
 	"github.com/lccxxo/bailuoli/internal/proxy/lb/circuit_breaker"
 	"net/http"
 	"net/url"
@@ -21,6 +22,7 @@ type Checker struct {
 	config     model.HealthyConfig
 	statusMap  sync.Map // key: upstream host, value: *Status
 	upstreams  []*url.URL
+	mu         sync.RWMutex
 	breakerMap map[string]*circuit_breaker.CircuitBreaker // 熔断配置 key: upstream host value: *CircuitBreaker
 	Cancel     context.CancelFunc
 }
@@ -43,13 +45,20 @@ func NewChecker(config model.HealthyConfig) *Checker {
 }
 
 func (c *Checker) Run(ctx context.Context) {
-	ticker := time.NewTicker(c.config.Interval)
+	interval := c.config.Interval
+	if interval <= 0 {
+		interval = constants.DefaultHealthCheck
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			c.checkAllUpstream(ctx, c.upstreams)
+			c.mu.RLock()
+			upstreams := c.upstreams
+			c.mu.RUnlock()
+			c.checkAllUpstream(ctx, upstreams)
 		case <-ctx.Done():
 			return
 		}
@@ -65,13 +74,18 @@ func (c *Checker) checkAllUpstream(ctx context.Context, upstream []*url.URL) {
 			c.checkSingleUpstream(ctx, u)
 		}(u)
 	}
+	wg.Wait()
 }
 
 func (c *Checker) checkSingleUpstream(ctx context.Context, upstream *url.URL) {
 	checkURL := upstream.String()
 
 	resp, err := c.client.Get(checkURL)
-	status, _ := c.statusMap.LoadOrStore(checkURL, &Status{})
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	// 首次检查前默认节点健康
+	status, _ := c.statusMap.LoadOrStore(checkURL, &Status{isHealthy: true})
 	s := status.(*Status)
 
 	s.mu.Lock()
@@ -101,16 +115,22 @@ func (c *Checker) checkSingleUpstream(ctx context.Context, upstream *url.URL) {
 	}
 }
 
+// IsHealthy 判断节点是否健康（尚未检查过的节点视为健康）
 func (c *Checker) IsHealthy(host string) bool {
 	status, ok := c.statusMap.Load(host)
 	if !ok {
-		return false
+		return true
 	}
-	return status.(*Status).isHealthy
+	s := status.(*Status)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isHealthy
 }
 
 func (c *Checker) UpdateUpstreams(upstreams []*url.URL) {
+	c.mu.Lock()
 	c.upstreams = upstreams
+	c.mu.Unlock()
 
 	c.statusMap.Range(func(key, value interface{}) bool {
 		if !containsURL(upstreams, key.(string)) {
@@ -128,3 +148,37 @@ func containsURL(list []*url.URL, target string) bool {
 	}
 	return false
 }
+
+// StatusSnapshot 节点健康状态快照
+type StatusSnapshot struct {
+	Healthy     bool      `json:"healthy"`
+	Failures    int       `json:"failures"`
+	Successes   int       `json:"successes"`
+	LastChecked time.Time `json:"last_checked"`
+}
+
+// Snapshot 获取所有节点的健康状态快照，尚未检查过的节点视为健康
+func (c *Checker) Snapshot() map[string]StatusSnapshot {
+	c.mu.RLock()
+	upstreams := c.upstreams
+	c.mu.RUnlock()
+
+	snapshot := make(map[string]StatusSnapshot, len(upstreams))
+	for _, u := range upstreams {
+		snapshot[u.String()] = StatusSnapshot{Healthy: true}
+	}
+
+	c.statusMap.Range(func(key, value interface{}) bool {
+		s := value.(*Status)
+		s.mu.Lock()
+		snapshot[key.(string)] = StatusSnapshot{
+			Healthy:     s.isHealthy,
+			Failures:    s.failures,
+			Successes:   s.successes,
+			LastChecked: s.lastChecked,
+		}
+		s.mu.Unlock()
+		return true
+	})
+	return snapshot
+}
@@ -1,3 +1,270 @@
 package healthy
 
+import (
+	"context"
+	"math"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"go.uber.org/zap"
+)
+
 // 被动健康检查
+// 根据真实转发请求的结果统计上游节点状态，参考 Envoy outlier detection：
+// 1. 连续错误（5xx 或连接错误）达到阈值时驱逐节点
+// 2. 周期性统计成功率，低于 均值-因子*标准差 的节点被驱逐
+// 驱逐时长随驱逐次数递增，且被驱逐节点数不超过 MaxEjectionPercent，整个节点池不会被全部驱逐
+
+type PassiveChecker struct {
+	config    model.OutlierDetectionConfig
+	mu        sync.Mutex
+	statusMap map[string]*OutlierStatus // key: upstream url, value: *OutlierStatus
+	Cancel    context.CancelFunc
+}
+
+type OutlierStatus struct {
+	consecutiveErrors int
+	successes         int64 // 当前统计间隔内成功数
+	total             int64 // 当前统计间隔内请求数
+	ejected           bool
+	ejectedAt         time.Time
+	ejectionCount     int // 驱逐倍数，用于计算递增的驱逐时长
+}
+
+func NewPassiveChecker(config model.OutlierDetectionConfig) *PassiveChecker {
+	if config.ConsecutiveErrors <= 0 {
+		config.ConsecutiveErrors = constants.DefaultOutlierConsecutiveErrors
+	}
+	if config.Interval <= 0 {
+		config.Interval = constants.DefaultOutlierInterval
+	}
+	if config.BaseEjectionTime <= 0 {
+		config.BaseEjectionTime = constants.DefaultOutlierBaseEjectionTime
+	}
+	if config.MaxEjectionTime <= 0 {
+		config.MaxEjectionTime = constants.DefaultOutlierMaxEjectionTime
+	}
+	if config.MaxEjectionPercent <= 0 {
+		config.MaxEjectionPercent = constants.DefaultOutlierMaxEjectionPercent
+	}
+	if config.SuccessRateMinimumHosts <= 0 {
+		config.SuccessRateMinimumHosts = constants.DefaultOutlierMinimumHosts
+	}
+	if config.SuccessRateRequestVolume <= 0 {
+		config.SuccessRateRequestVolume = constants.DefaultOutlierRequestVolume
+	}
+	if config.SuccessRateStdevFactor <= 0 {
+		config.SuccessRateStdevFactor = constants.DefaultOutlierStdevFactor
+	}
+
+	return &PassiveChecker{
+		config:    config,
+		statusMap: make(map[string]*OutlierStatus),
+	}
+}
+
+func (p *PassiveChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.evaluate()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RecordSuccess 记录一次成功的转发
+func (p *PassiveChecker) RecordSuccess(upstream string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.statusMap[upstream]
+	if !ok {
+		return
+	}
+	s.consecutiveErrors = 0
+	s.successes++
+	s.total++
+}
+
+// RecordFailure 记录一次失败的转发（5xx 或连接错误）
+func (p *PassiveChecker) RecordFailure(upstream string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.statusMap[upstream]
+	if !ok {
+		return
+	}
+	s.consecutiveErrors++
+	s.total++
+
+	if !s.ejected && s.consecutiveErrors >= p.config.ConsecutiveErrors {
+		p.eject(upstream, s, "consecutive_errors")
+	}
+}
+
+// IsEjected 判断上游节点是否被驱逐
+func (p *PassiveChecker) IsEjected(upstream string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.statusMap[upstream]
+	if !ok {
+		return false
+	}
+	return s.ejected
+}
+
+func (p *PassiveChecker) UpdateUpstreams(upstreams []*url.URL) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, u := range upstreams {
+		if _, ok := p.statusMap[u.String()]; !ok {
+			p.statusMap[u.String()] = &OutlierStatus{}
+		}
+	}
+
+	for key := range p.statusMap {
+		if !containsURL(upstreams, key) {
+			delete(p.statusMap, key)
+		}
+	}
+}
+
+// evaluate 周期性检查：恢复到期的节点，并进行成功率异常检测
+func (p *PassiveChecker) evaluate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for upstream, s := range p.statusMap {
+		if s.ejected {
+			if now.Sub(s.ejectedAt) >= p.ejectionTime(s) {
+				s.ejected = false
+				s.consecutiveErrors = 0
+				logger.Logger.Info("outlier upstream restored", zap.String("upstream", upstream))
+			}
+		} else if s.ejectionCount > 0 {
+			// 节点在一个统计间隔内保持正常，逐步降低驱逐倍数
+			s.ejectionCount--
+		}
+	}
+
+	p.detectSuccessRateOutliers()
+
+	for _, s := range p.statusMap {
+		s.successes = 0
+		s.total = 0
+	}
+}
+
+// detectSuccessRateOutliers 成功率异常检测（调用方需持有锁）
+func (p *PassiveChecker) detectSuccessRateOutliers() {
+	rates := make(map[string]float64)
+	for upstream, s := range p.statusMap {
+		if s.ejected || s.total < int64(p.config.SuccessRateRequestVolume) {
+			continue
+		}
+		rates[upstream] = float64(s.successes) / float64(s.total)
+	}
+	if len(rates) < p.config.SuccessRateMinimumHosts {
+		return
+	}
+
+	var sum float64
+	for _, rate := range rates {
+		sum += rate
+	}
+	mean := sum / float64(len(rates))
+
+	var variance float64
+	for _, rate := range rates {
+		variance += (rate - mean) * (rate - mean)
+	}
+	stdev := math.Sqrt(variance / float64(len(rates)))
+	threshold := mean - p.config.SuccessRateStdevFactor*stdev
+
+	for upstream, rate := range rates {
+		if rate < threshold {
+			p.eject(upstream, p.statusMap[upstream], "success_rate")
+		}
+	}
+}
+
+// eject 驱逐节点（调用方需持有锁），超过最大驱逐比例时放弃驱逐
+func (p *PassiveChecker) eject(upstream string, s *OutlierStatus, reason string) {
+	ejected := 0
+	for _, status := range p.statusMap {
+		if status.ejected {
+			ejected++
+		}
+	}
+
+	total := len(p.statusMap)
+	maxEjected := total * p.config.MaxEjectionPercent / 100
+	if maxEjected < 1 {
+		maxEjected = 1
+	}
+	// 至少保留一个节点，避免整个节点池被驱逐
+	if maxEjected > total-1 {
+		maxEjected = total - 1
+	}
+	if ejected >= maxEjected {
+		logger.Logger.Warn("outlier ejection skipped: max ejection percent reached",
+			zap.String("upstream", upstream), zap.String("reason", reason))
+		return
+	}
+
+	s.ejected = true
+	s.ejectedAt = time.Now()
+	s.ejectionCount++
+
+	logger.Logger.Warn("outlier upstream ejected",
+		zap.String("upstream", upstream),
+		zap.String("reason", reason),
+		zap.Duration("ejection_time", p.ejectionTime(s)))
+}
+
+// ejectionTime 驱逐时长 = 基础驱逐时长 * 驱逐次数，不超过最大驱逐时长
+func (p *PassiveChecker) ejectionTime(s *OutlierStatus) time.Duration {
+	d := p.config.BaseEjectionTime * time.Duration(s.ejectionCount)
+	if d > p.config.MaxEjectionTime {
+		d = p.config.MaxEjectionTime
+	}
+	return d
+}
+
+// OutlierSnapshot 被动健康检查状态快照
+type OutlierSnapshot struct {
+	Ejected           bool      `json:"ejected"`
+	EjectedAt         time.Time `json:"ejected_at"`
+	EjectionCount     int       `json:"ejection_count"`
+	ConsecutiveErrors int       `json:"consecutive_errors"`
+}
+
+// Snapshot 获取所有节点的被动健康检查状态快照
+func (p *PassiveChecker) Snapshot() map[string]OutlierSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snapshot := make(map[string]OutlierSnapshot, len(p.statusMap))
+	for upstream, s := range p.statusMap {
+		snapshot[upstream] = OutlierSnapshot{
+			Ejected:           s.ejected,
+			EjectedAt:         s.ejectedAt,
+			EjectionCount:     s.ejectionCount,
+			ConsecutiveErrors: s.consecutiveErrors,
+		}
+	}
+	return snapshot
+}
@@ -1,6 +1,8 @@
 package lb
 
 import (
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb/circuit_breaker"
 	"github.com/lccxxo/bailuoli/internal/proxy/lb/healthy"
 	"net/http"
 	"net/url"
@@ -16,13 +18,23 @@ type LoadBalancer interface {
 type BaseLB interface {
 	AddUpstream(upstream *url.URL)
 	RemoveUpstream(upstream *url.URL)
+	Upstreams() []*url.URL
+	Available(upstream *url.URL) bool
 	SetHealthChecker(checker *healthy.Checker)
+	SetPassiveChecker(checker *healthy.PassiveChecker)
+	SetBreakerManager(route string, manager *circuit_breaker.BreakerManager)
+	SetConnLimits(counter *ConnCounter, limits *ConnLimits)
 }
 
 type BaseLoadBalancer struct {
 	mu        sync.RWMutex
 	upstreams []*url.URL
 	checker   *healthy.Checker
+	passive   *healthy.PassiveChecker
+	breakers  *circuit_breaker.BreakerManager
+	route     string       // 所属路由，用于查找上游节点的熔断器
+	conns     *ConnCounter // 每个上游节点正在处理的请求数，用于判断是否达到并发上限
+	limits    *ConnLimits
 }
 
 func (b *BaseLoadBalancer) AddUpstream(upstream *url.URL) {
@@ -44,25 +56,148 @@ func (b *BaseLoadBalancer) RemoveUpstream(upstream *url.URL) {
 	for i, u := range b.upstreams {
 		if u.String() == upstream.String() {
 			b.upstreams = append(b.upstreams[:i], b.upstreams[i+1:]...)
+			return
 		}
 	}
 }
 
+// Upstreams 获取当前所有上游节点的副本
+func (b *BaseLoadBalancer) Upstreams() []*url.URL {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	upstreams := make([]*url.URL, len(b.upstreams))
+	copy(upstreams, b.upstreams)
+	return upstreams
+}
+
+// Available 上游节点是否存在且可用：主动健康检查通过、未被被动健康检查驱逐、熔断器未打开且未达到并发上限
+func (b *BaseLoadBalancer) Available(upstream *url.URL) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	key := upstream.String()
+	found := false
+	for _, u := range b.upstreams {
+		if u.String() == key {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+	if b.checker != nil && !b.checker.IsHealthy(key) {
+		return false
+	}
+	if b.passive != nil && b.passive.IsEjected(key) {
+		return false
+	}
+	if b.breakers != nil && !b.breakers.Allow(b.route, key) {
+		return false
+	}
+	return !b.connLimitReached(key)
+}
+
 func (b *BaseLoadBalancer) SetHealthChecker(checker *healthy.Checker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.checker = checker
-	return
+}
+
+func (b *BaseLoadBalancer) SetPassiveChecker(checker *healthy.PassiveChecker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.passive = checker
+}
+
+// SetBreakerManager 设置熔断器管理器，route 为所属路由（熔断器按路由和上游节点区分）
+func (b *BaseLoadBalancer) SetBreakerManager(route string, manager *circuit_breaker.BreakerManager) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.route = route
+	b.breakers = manager
+}
+
+// SetConnLimits 设置并发上限，达到上限的节点不会被选择
+func (b *BaseLoadBalancer) SetConnLimits(counter *ConnCounter, limits *ConnLimits) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !limits.Enabled() {
+		b.conns, b.limits = nil, nil
+		return
+	}
+	b.conns = counter
+	b.limits = limits
+}
+
+// connLimitReached 上游节点或路由是否达到并发上限
+func (b *BaseLoadBalancer) connLimitReached(key string) bool {
+	if b.conns == nil {
+		return false
+	}
+	if b.limits.Total > 0 && b.conns.Total() >= b.limits.Total {
+		return true
+	}
+	limit := b.limits.Upstream(key)
+	return limit > 0 && b.conns.Load(key) >= limit
 }
 
 // 只获取健康的上游节点
 func (b *BaseLoadBalancer) healthyUpstreams() []*url.URL {
+	urls, _ := b.availableUpstreams()
+	return urls
+}
+
+// 获取可用的上游节点：主动健康检查通过、未被被动健康检查驱逐、熔断器未打开且未达到并发上限
+// 没有可用节点时返回对应的原因，所有熔断器都打开时返回 ErrCircuitBreakerOpen，都达到并发上限时返回 ErrUpstreamsBusy
+func (b *BaseLoadBalancer) availableUpstreams() ([]*url.URL, error) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	var urls []*url.URL
+	if len(b.upstreams) == 0 {
+		return nil, constants.ErrNoUpstreams
+	}
+
+	var healthy []*url.URL
 	for _, u := range b.upstreams {
-		if b.checker == nil || b.checker.IsHealthy(u.String()) {
-			urls = append(urls, u)
+		if b.checker != nil && !b.checker.IsHealthy(u.String()) {
+			continue
+		}
+		if b.passive != nil && b.passive.IsEjected(u.String()) {
+			continue
 		}
+		healthy = append(healthy, u)
 	}
-	return urls
+	if len(healthy) == 0 {
+		return nil, constants.ErrNoHealthyUpstreams
+	}
+
+	urls := healthy
+	if b.breakers != nil {
+		// 熔断器的上游节点与 BreakerManager.SetBreaker 一致（Host+Path）
+		urls = nil
+		for _, u := range healthy {
+			if b.breakers.Allow(b.route, u.String()) {
+				urls = append(urls, u)
+			}
+		}
+		if len(urls) == 0 {
+			return nil, constants.ErrCircuitBreakerOpen
+		}
+	}
+
+	if b.conns == nil {
+		return urls, nil
+	}
+	var idle []*url.URL
+	for _, u := range urls {
+		if !b.connLimitReached(u.String()) {
+			idle = append(idle, u)
+		}
+	}
+	if len(idle) == 0 {
+		return nil, constants.ErrUpstreamsBusy
+	}
+	return idle, nil
 }
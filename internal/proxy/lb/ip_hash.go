@@ -1,9 +1,9 @@
 package lb
 
 import (
+	"github.com/lccxxo/bailuoli/internal/clientip"
 	"github.com/lccxxo/bailuoli/internal/constants"
 	"hash/fnv"
-	"net"
 	"net/http"
 	"net/url"
 	"sync"
@@ -23,10 +23,12 @@ func NewIPHashLoadBalancer(upstreams []*url.URL) *IPHashLoadBalancer {
 }
 
 func (b *IPHashLoadBalancer) Next(r *http.Request) (*url.URL, error) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+	upstreams, err := b.availableUpstreams()
+	if err != nil {
+		return nil, err
+	}
 
-	ip := getClientIP(r)
+	ip := clientip.FromRequest(r)
 	if ip == "" {
 		return nil, constants.ErrNoClientIP
 	}
@@ -34,21 +36,9 @@ func (b *IPHashLoadBalancer) Next(r *http.Request) (*url.URL, error) {
 	hasher := fnv.New32a()
 	hasher.Write([]byte(ip))
 	hash := int(hasher.Sum32())
-	index := hash % len(b.upstreams)
+	index := hash % len(upstreams)
 	if index < 0 {
 		index = -index
 	}
-	return b.upstreams[index], nil
-}
-
-// 获取客户端IP
-func getClientIP(r *http.Request) string {
-	if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-		return ip
-	}
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
-		return ip
-	}
-	host, _, _ := net.SplitHostPort(r.RemoteAddr)
-	return host
+	return upstreams[index], nil
 }
@@ -7,7 +7,6 @@ import (
 	"net/http"
 	"net/url"
 	"sync"
-	"sync/atomic"
 )
 
 // 最少连接负载均衡策略
@@ -18,12 +17,9 @@ type LeastConnectionLoadBalancer struct {
 }
 
 func NewLeastConnectionLoadBalancer(upstreams []*url.URL) *LeastConnectionLoadBalancer {
-	connCounts := ConnCounter{
-		counters: make(map[string]*atomic.Int64),
-	}
-
+	connCounts := NewConnCounter()
 	for _, u := range upstreams {
-		connCounts.counters[u.Host] = &atomic.Int64{}
+		connCounts.Register(u.Host)
 	}
 
 	return &LeastConnectionLoadBalancer{
@@ -31,24 +27,21 @@ func NewLeastConnectionLoadBalancer(upstreams []*url.URL) *LeastConnectionLoadBa
 			upstreams: upstreams,
 			mu:        sync.RWMutex{},
 		},
-		connCounts: &connCounts,
+		connCounts: connCounts,
 	}
 }
 
 func (b *LeastConnectionLoadBalancer) Next(r *http.Request) (*url.URL, error) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
-	healthy := b.healthyUpstreams()
-	if len(healthy) == 0 {
-		return nil, constants.ErrNoHealthyUpstreams
+	healthy, err := b.availableUpstreams()
+	if err != nil {
+		return nil, err
 	}
 
 	// 选择最少连接的上游节点
 	var minURL *url.URL
 	var minCount = int64(math.MaxInt64)
 	for _, upstream := range healthy {
-		count := b.connCounts.counters[upstream.Host].Load()
+		count := b.connCounts.Load(upstream.Host)
 
 		if count < minCount {
 			minCount = count
@@ -63,24 +56,31 @@ func (b *LeastConnectionLoadBalancer) Next(r *http.Request) (*url.URL, error) {
 	// 连接数加1
 	b.connCounts.Acquire(minURL.Host)
 
-	// 将连接数减少逻辑放到上下文
+	// 将连接数减少逻辑放到上下文（转发失败、重试等路径可能多次调用，只生效一次）
+	var once sync.Once
 	ctx := context.WithValue(r.Context(), "least_conn_counter", func() {
-		b.connCounts.Release(minURL.Host)
+		once.Do(func() {
+			b.connCounts.Release(minURL.Host)
+		})
 	})
 	*r = *r.WithContext(ctx)
 
 	return minURL, nil
 }
 
+// ConnCounts 获取连接计数器
+func (b *LeastConnectionLoadBalancer) ConnCounts() *ConnCounter {
+	return b.connCounts
+}
+
 // AddUpstream 重写添加方法（初始化连接计数）
 func (b *LeastConnectionLoadBalancer) AddUpstream(upstream *url.URL) {
 	b.BaseLoadBalancer.AddUpstream(upstream)
-	b.connCounts.counters[upstream.Host] = &atomic.Int64{}
-	b.connCounts.counters[upstream.Host].Store(0)
+	b.connCounts.Register(upstream.Host)
 }
 
 // RemoveUpstream 重写移除方法（清理连接计数）
 func (b *LeastConnectionLoadBalancer) RemoveUpstream(upstream *url.URL) {
 	b.BaseLoadBalancer.RemoveUpstream(upstream)
-	delete(b.connCounts.counters, upstream.Host)
+	b.connCounts.Unregister(upstream.Host)
 }
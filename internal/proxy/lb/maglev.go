@@ -0,0 +1,133 @@
+package lb
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// Maglev 一致性哈希负载均衡策略
+// 每个节点根据自身地址生成查找表的一个排列，按权重轮流填充查找表，请求的 key 取模后直接查表
+// 与哈希环相比查找为 O(1)、负载更均匀，增减节点时大部分 key 保持不变
+// 节点不可用时沿查找表向后查找下一个可用节点
+
+type MaglevLoadBalancer struct {
+	BaseLoadBalancer
+	key    model.HashKeyConfig
+	weight map[string]int
+
+	tableMu sync.Mutex // 串行化节点变化和查找表重建
+	table   atomic.Pointer[maglevTable]
+}
+
+type maglevTable struct {
+	upstreams []*url.URL
+	entries   []int32 // 查找表，值为 upstreams 的下标
+}
+
+func NewMaglevLoadBalancer(upstreams []*url.URL, config model.LoadBalanceConfig) *MaglevLoadBalancer {
+	b := &MaglevLoadBalancer{
+		BaseLoadBalancer: BaseLoadBalancer{
+			upstreams: upstreams,
+			mu:        sync.RWMutex{},
+		},
+		key:    config.HashKey,
+		weight: config.Weighted,
+	}
+	b.rebuild()
+	return b
+}
+
+func (b *MaglevLoadBalancer) Next(r *http.Request) (*url.URL, error) {
+	available, err := b.availableUpstreams()
+	if err != nil {
+		return nil, err
+	}
+
+	table := b.table.Load()
+	if len(table.upstreams) == 0 {
+		return nil, constants.ErrNoUpstreams
+	}
+	h := hash64(hashKey(r, b.key))
+	start := int(h % uint64(len(table.entries)))
+
+	set := availableSet(available, len(table.upstreams))
+	if set == nil {
+		return table.upstreams[table.entries[start]], nil
+	}
+	// 最多查找一轮，每个节点都会在查找表中出现
+	for i := 0; i < len(table.entries); i++ {
+		u := table.upstreams[table.entries[(start+i)%len(table.entries)]]
+		if set[u.String()] {
+			return u, nil
+		}
+	}
+	return available[int(h%uint64(len(available)))], nil
+}
+
+// AddUpstream 添加上游节点并重建查找表
+func (b *MaglevLoadBalancer) AddUpstream(upstream *url.URL) {
+	b.tableMu.Lock()
+	defer b.tableMu.Unlock()
+	b.BaseLoadBalancer.AddUpstream(upstream)
+	b.rebuild()
+}
+
+// RemoveUpstream 移除上游节点并重建查找表
+func (b *MaglevLoadBalancer) RemoveUpstream(upstream *url.URL) {
+	b.tableMu.Lock()
+	defer b.tableMu.Unlock()
+	b.BaseLoadBalancer.RemoveUpstream(upstream)
+	b.rebuild()
+}
+
+// rebuild 按 Maglev 论文的填充算法生成查找表，权重为 w 的节点每轮填充 w 个位置
+func (b *MaglevLoadBalancer) rebuild() {
+	upstreams := b.Upstreams()
+	table := &maglevTable{upstreams: upstreams}
+	if len(upstreams) == 0 {
+		b.table.Store(table)
+		return
+	}
+
+	const size = constants.MaglevTableSize
+	offsets := make([]uint64, len(upstreams))
+	skips := make([]uint64, len(upstreams))
+	weights := make([]int, len(upstreams))
+	next := make([]uint64, len(upstreams)) // 每个节点排列中下一个尝试的位置
+	for i, u := range upstreams {
+		offsets[i] = hash64("offset:"+u.String()) % size
+		skips[i] = hash64("skip:"+u.String())%(size-1) + 1
+		weights[i] = upstreamWeight(b.weight, u)
+	}
+
+	entries := make([]int32, size)
+	for i := range entries {
+		entries[i] = -1
+	}
+	filled := 0
+	for filled < size {
+		for i := range upstreams {
+			for w := 0; w < weights[i] && filled < size; w++ {
+				for {
+					pos := (offsets[i] + next[i]*skips[i]) % size
+					next[i]++
+					if entries[pos] < 0 {
+						entries[pos] = int32(i)
+						filled++
+						break
+					}
+				}
+			}
+			if filled == size {
+				break
+			}
+		}
+	}
+	table.entries = entries
+	b.table.Store(table)
+}
@@ -0,0 +1,35 @@
+package lb
+
+import "testing"
+
+func TestMaglevRemoveUpstream(t *testing.T) {
+	upstreams := testUpstreams(remapHosts)
+	b := NewMaglevLoadBalancer(upstreams, hashKeyConfig)
+
+	moved, stray := remapStats(t, b, upstreams[3])
+	if expected := 1.0 / remapHosts; moved < expected/2 || moved > expected*2 {
+		t.Errorf("remapped %.2f%% of keys, want about %.2f%%", moved*100, expected*100)
+	}
+	// 移除节点会重建查找表，Maglev 只保证接近最小的重新映射：其他节点的 key 极少数会移动
+	if limit := remapKeys / 100; stray > limit {
+		t.Errorf("%d keys not owned by the removed upstream were remapped, want at most %d", stray, limit)
+	}
+}
+
+func TestMaglevUnavailableUpstream(t *testing.T) {
+	upstreams := testUpstreams(remapHosts)
+	b := NewMaglevLoadBalancer(upstreams, hashKeyConfig)
+	before := assign(t, b)
+
+	// 熔断的节点仍在查找表中，只有它的 key 会移动到下一个可用位置
+	b.SetBreakerManager("orders", newOpenBreakers(upstreams[3]))
+	after := assign(t, b)
+	for i := range before {
+		if before[i] != upstreams[3].String() && before[i] != after[i] {
+			t.Fatalf("key-%d moved from %s to %s", i, before[i], after[i])
+		}
+		if after[i] == upstreams[3].String() {
+			t.Fatalf("key-%d mapped to unavailable upstream", i)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package lb
 
 import (
-	"github.com/lccxxo/bailuoli/internal/constants"
 	"math/rand"
 	"net/http"
 	"net/url"
@@ -22,14 +21,12 @@ func NewRandomLoadBalancer(upstreams []*url.URL) *RandomLoadBalancer {
 }
 
 func (b *RandomLoadBalancer) Next(r *http.Request) (*url.URL, error) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
-	//	判断是否有上游节点
-	if len(b.upstreams) == 0 {
-		return nil, constants.ErrNoUpstreams
+	//	获取可用的上游节点
+	upstreams, err := b.availableUpstreams()
+	if err != nil {
+		return nil, err
 	}
 
 	//	随机选择一个上游节点
-	return b.upstreams[rand.Intn(len(b.upstreams))], nil
+	return upstreams[rand.Intn(len(upstreams))], nil
 }
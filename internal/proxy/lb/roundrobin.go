@@ -1,7 +1,6 @@
 package lb
 
 import (
-	"github.com/lccxxo/bailuoli/internal/constants"
 	"net/http"
 	"net/url"
 	"sync"
@@ -25,14 +24,12 @@ func NewRoundRobinLoadBalancer(upstreams []*url.URL) *RoundRobinLoadBalancer {
 }
 
 func (b *RoundRobinLoadBalancer) Next(r *http.Request) (*url.URL, error) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
-	if len(b.upstreams) == 0 {
-		return nil, constants.ErrNoUpstreams
+	upstreams, err := b.availableUpstreams()
+	if err != nil {
+		return nil, err
 	}
 
-	idx := int64(atomic.AddUint64(&b.counter, 1) % uint64(len(b.upstreams)))
+	idx := int64(atomic.AddUint64(&b.counter, 1) % uint64(len(upstreams)))
 
-	return b.upstreams[idx], nil
+	return upstreams[idx], nil
 }
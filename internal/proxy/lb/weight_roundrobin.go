@@ -1,19 +1,22 @@
 package lb
 
 import (
-	"github.com/lccxxo/bailuoli/internal/constants"
 	"net/http"
 	"net/url"
 	"sync"
 )
 
-// 加权轮询负载均衡策略
+// 平滑加权轮询负载均衡策略（与 nginx 的 smooth weighted round-robin 一致）
+// 每次选择时所有可用节点的当前权重加上自身权重，选择当前权重最大的节点，再减去所有可用节点的权重之和
+// 权重为 5、1、1 的节点 a、b、c 的选择顺序为 a a b a c a a，高权重节点不会被连续集中选择
+// 不可用的节点不参与本轮计算，当前权重保持不变
 
 type WeightRoundRobinLoadBalancer struct {
 	BaseLoadBalancer
-	weight        map[string]int // 权重配置
-	currentIndex  int            // 当前索引
-	currentWeight int            // 当前权重
+	weight map[string]int // 权重配置，未配置的节点权重为1
+
+	wrrMu   sync.Mutex
+	current map[string]int // 节点 -> 当前权重
 }
 
 func NewWeightRoundRobinLoadBalancer(upstreams []*url.URL, weight map[string]int) *WeightRoundRobinLoadBalancer {
@@ -30,37 +33,69 @@ func NewWeightRoundRobinLoadBalancer(upstreams []*url.URL, weight map[string]int
 			upstreams: upstreams,
 			mu:        sync.RWMutex{},
 		},
-		weight:        safeWeight,
-		currentIndex:  -1,
-		currentWeight: 0,
+		weight:  safeWeight,
+		current: make(map[string]int),
 	}
 }
 
 func (b *WeightRoundRobinLoadBalancer) Next(r *http.Request) (*url.URL, error) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
-	if len(b.upstreams) == 0 {
-		return nil, constants.ErrNoUpstreams
+	upstreams, err := b.availableUpstreams()
+	if err != nil {
+		return nil, err
 	}
 
-	return b.upstreams[b.currentIndex], nil
+	b.wrrMu.Lock()
+	defer b.wrrMu.Unlock()
+
+	var best *url.URL
+	total, bestWeight := 0, 0
+	for _, u := range upstreams {
+		key := u.String()
+		w := upstreamWeight(b.weight, u)
+		b.current[key] += w
+		total += w
+		if best == nil || b.current[key] > bestWeight {
+			best, bestWeight = u, b.current[key]
+		}
+	}
+	b.current[best.String()] -= total
+	return best, nil
 }
 
-// AddUpstream 添加上游节点 (并设置权重)
-func (b *WeightRoundRobinLoadBalancer) AddUpstream(upstream *url.URL) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+// Inherit 继承热更新前的负载均衡器的当前权重，权重变化后分布平滑过渡而不是从头开始
+func (b *WeightRoundRobinLoadBalancer) Inherit(prev *WeightRoundRobinLoadBalancer) {
+	prev.wrrMu.Lock()
+	current := make(map[string]int, len(prev.current))
+	for k, v := range prev.current {
+		current[k] = v
+	}
+	prev.wrrMu.Unlock()
 
-	b.weight[upstream.String()] = 1
-	b.BaseLoadBalancer.AddUpstream(upstream)
+	b.wrrMu.Lock()
+	defer b.wrrMu.Unlock()
+	for _, u := range b.Upstreams() {
+		if v, ok := current[u.String()]; ok {
+			b.current[u.String()] = v
+		}
+	}
 }
 
-// RemoveUpstream 移除上游节点 (并删除权重)
+// RemoveUpstream 移除上游节点 (并删除当前权重)
 func (b *WeightRoundRobinLoadBalancer) RemoveUpstream(upstream *url.URL) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
-	delete(b.weight, upstream.String())
 	b.BaseLoadBalancer.RemoveUpstream(upstream)
+
+	b.wrrMu.Lock()
+	defer b.wrrMu.Unlock()
+	delete(b.current, upstream.String())
+}
+
+// upstreamWeight 上游节点的权重，未配置时为1
+// 权重的 key 可以是完整地址（包含路径）、与 upstreams.host 相同的 scheme://host 或 host
+func upstreamWeight(weight map[string]int, upstream *url.URL) int {
+	for _, key := range []string{upstream.String(), upstream.Scheme + "://" + upstream.Host, upstream.Host} {
+		if w, ok := weight[key]; ok && w > 0 {
+			return w
+		}
+	}
+	return 1
 }
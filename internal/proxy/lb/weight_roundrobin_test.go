@@ -0,0 +1,75 @@
+package lb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var wrrNames = map[string]string{
+	"http://a:80": "a",
+	"http://b:80": "b",
+	"http://c:80": "c",
+}
+
+func wrrUpstreams(n int) []*url.URL {
+	upstreams := make([]*url.URL, 0, n)
+	for _, host := range []string{"a:80", "b:80", "c:80"}[:n] {
+		upstreams = append(upstreams, &url.URL{Scheme: "http", Host: host})
+	}
+	return upstreams
+}
+
+// wrrSequence 连续选择 n 次，返回节点名称组成的序列
+func wrrSequence(t *testing.T, b *WeightRoundRobinLoadBalancer, n int) string {
+	t.Helper()
+	var seq strings.Builder
+	for i := 0; i < n; i++ {
+		u, err := b.Next(httptest.NewRequest(http.MethodGet, "/", nil))
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		seq.WriteString(wrrNames[u.String()])
+	}
+	return seq.String()
+}
+
+func TestWeightRoundRobinSequence(t *testing.T) {
+	tests := []struct {
+		name      string
+		upstreams int
+		weight    map[string]int
+		want      string
+	}{
+		{"5-1-1", 3, map[string]int{"http://a:80": 5, "http://b:80": 1, "http://c:80": 1}, "aabacaa"},
+		{"equal", 3, nil, "abc"},
+		{"2-1", 2, map[string]int{"a:80": 2}, "aba"},
+		{"4-2-1", 3, map[string]int{"http://a:80": 4, "http://b:80": 2, "http://c:80": 1}, "abacaba"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewWeightRoundRobinLoadBalancer(wrrUpstreams(tt.upstreams), tt.weight)
+			// 连续两个周期，每个周期的序列相同
+			if got := wrrSequence(t, b, 2*len(tt.want)); got != tt.want+tt.want {
+				t.Errorf("sequence = %q, want %q", got, tt.want+tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightRoundRobinInherit(t *testing.T) {
+	weight := map[string]int{"http://a:80": 5, "http://b:80": 1, "http://c:80": 1}
+	prev := NewWeightRoundRobinLoadBalancer(wrrUpstreams(3), weight)
+	if got := wrrSequence(t, prev, 3); got != "aab" {
+		t.Fatalf("sequence before reload = %q, want %q", got, "aab")
+	}
+
+	// 热更新后继续原来的序列，而不是从头开始
+	b := NewWeightRoundRobinLoadBalancer(wrrUpstreams(3), weight)
+	b.Inherit(prev)
+	if got := wrrSequence(t, b, 4); got != "acaa" {
+		t.Errorf("sequence after reload = %q, want %q", got, "acaa")
+	}
+}
@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 重试策略
+// 1. 连接失败时请求未发送到上游，任何方法都可以重试
+// 2. 连接重置、5xx 等情况只重试幂等请求（除非配置 retry_non_idempotent）
+// 3. 每次重试通过负载均衡重新选择节点，尽量避开已经尝试过的节点
+// 4. 重试间隔使用带随机抖动的指数退避，并受全局重试预算限制
+
+// modifyResponse 遇到需要重试的状态码时返回该错误，响应不会写入客户端
+var errRetryableStatus = errors.New("retryable upstream status")
+
+type retryPolicy struct {
+	attempts           int
+	retryOn            map[string]bool
+	statusCodes        map[int]bool
+	retryNonIdempotent bool
+	perTryTimeout      time.Duration
+	baseInterval       time.Duration
+	maxInterval        time.Duration
+	maxBodySize        int64
+}
+
+func newRetryPolicy(config *model.RetryConfig) *retryPolicy {
+	if config == nil || config.Attempts < 2 {
+		return nil
+	}
+
+	p := &retryPolicy{
+		attempts:           config.Attempts,
+		retryOn:            make(map[string]bool),
+		statusCodes:        make(map[int]bool),
+		retryNonIdempotent: config.RetryNonIdempotent,
+		perTryTimeout:      config.PerTryTimeout,
+		baseInterval:       config.BaseInterval,
+		maxInterval:        config.MaxInterval,
+		maxBodySize:        config.MaxBodySize,
+	}
+
+	retryOn := config.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = []string{constants.RetryOnConnectFailure, constants.RetryOnGatewayError}
+	}
+	for _, condition := range retryOn {
+		p.retryOn[condition] = true
+	}
+	for _, code := range config.RetriableStatusCodes {
+		p.statusCodes[code] = true
+	}
+
+	if p.baseInterval <= 0 {
+		p.baseInterval = constants.DefaultRetryBaseInterval
+	}
+	if p.maxInterval <= 0 {
+		p.maxInterval = 10 * p.baseInterval
+	}
+	if p.maxBodySize <= 0 {
+		p.maxBodySize = constants.DefaultRetryMaxBodySize
+	}
+	return p
+}
+
+// retryOnStatus 判断上游响应状态码是否需要重试
+func (p *retryPolicy) retryOnStatus(r *http.Request, code int) bool {
+	if !p.retryNonIdempotent && !isIdempotent(r) {
+		return false
+	}
+	switch {
+	case p.statusCodes[code]:
+		return true
+	case p.retryOn[constants.RetryOn5xx] && code >= http.StatusInternalServerError:
+		return true
+	case p.retryOn[constants.RetryOnGatewayError]:
+		return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+	}
+	return false
+}
+
+// retryOnError 判断转发错误是否需要重试，timedOut 表示单次尝试超时
+func (p *retryPolicy) retryOnError(r *http.Request, err error, timedOut bool) bool {
+	if p.retryOn[constants.RetryOnConnectFailure] && isConnectFailure(err) {
+		return true
+	}
+	if !p.retryNonIdempotent && !isIdempotent(r) {
+		return false
+	}
+	if timedOut {
+		return p.retryOn[constants.RetryOnGatewayError] || p.retryOn[constants.RetryOn5xx]
+	}
+	return p.retryOn[constants.RetryOnReset] && isReset(err)
+}
+
+// backoff 第 n 次重试前的等待时间，在 [0, min(base*2^(n-1), max)] 中随机选择
+func (p *retryPolicy) backoff(n int) time.Duration {
+	d := p.baseInterval << (n - 1)
+	if d <= 0 || d > p.maxInterval {
+		d = p.maxInterval
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// bufferBody 缓存请求体用于重放，超过大小限制时恢复原请求体并返回 false
+func (p *retryPolicy) bufferBody(r *http.Request) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	if r.ContentLength > p.maxBodySize {
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, p.maxBodySize+1))
+	if err != nil || int64(len(body)) > p.maxBodySize {
+		// 请求体过大或读取失败，拼接已读取的部分交给上游处理，不再重试
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil, false
+	}
+	r.Body.Close()
+	return body, true
+}
+
+func isIdempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.Header.Get("Idempotency-Key") != "" || r.Header.Get("X-Idempotency-Key") != ""
+}
+
+func isConnectFailure(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func isReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// sleepContext 等待指定时间，ctx 结束时返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// RetryBudget 全局重试预算
+// 同时进行的重试数不超过 max(活跃请求数 * BudgetPercent%, MinRetryConcurrency)
+type RetryBudget struct {
+	active  atomic.Int64
+	retries atomic.Int64
+	config  atomic.Pointer[model.RetryBudgetConfig]
+}
+
+func NewRetryBudget(config model.RetryBudgetConfig) *RetryBudget {
+	b := &RetryBudget{}
+	b.Update(config)
+	return b
+}
+
+// Update 更新预算配置
+func (b *RetryBudget) Update(config model.RetryBudgetConfig) {
+	if config.BudgetPercent <= 0 {
+		config.BudgetPercent = constants.DefaultRetryBudgetPercent
+	}
+	if config.MinRetryConcurrency <= 0 {
+		config.MinRetryConcurrency = constants.DefaultMinRetryConcurrency
+	}
+	b.config.Store(&config)
+}
+
+// requestStarted 记录一个活跃请求，返回结束时调用的函数
+func (b *RetryBudget) requestStarted() func() {
+	b.active.Add(1)
+	return func() {
+		b.active.Add(-1)
+	}
+}
+
+// acquire 申请一次重试，预算不足时返回 false，成功时需要调用 release
+func (b *RetryBudget) acquire() bool {
+	config := b.config.Load()
+	limit := int64(float64(b.active.Load()) * config.BudgetPercent / 100)
+	if limit < int64(config.MinRetryConcurrency) {
+		limit = int64(config.MinRetryConcurrency)
+	}
+
+	if b.retries.Add(1) > limit {
+		b.retries.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (b *RetryBudget) release() {
+	b.retries.Add(-1)
+}
+
+// 所有路由共享的重试预算
+var retryBudget = NewRetryBudget(model.RetryBudgetConfig{})
+
+// SetRetryBudget 更新全局重试预算配置
+func SetRetryBudget(config model.RetryBudgetConfig) {
+	retryBudget.Update(config)
+}
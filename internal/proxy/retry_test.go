@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb/circuit_breaker"
+	"go.uber.org/zap"
+)
+
+// failingUpstream 前 failures 次请求返回 status，之后返回 200，记录请求次数和收到的请求体
+type failingUpstream struct {
+	srv    *httptest.Server
+	hits   atomic.Int64
+	bodies chan string
+}
+
+func newFailingUpstream(t *testing.T, failures int64, status int) *failingUpstream {
+	t.Helper()
+	u := &failingUpstream{bodies: make(chan string, 16)}
+	u.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		u.bodies <- string(body)
+		if u.hits.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(u.srv.Close)
+	return u
+}
+
+// retryProxy 创建按轮询转发到 upstreams 的反向代理，退避间隔缩短为 1ms
+func retryProxy(config *model.RetryConfig, upstreams ...string) *LoadBalanceReverseProxy {
+	configs := make([]*model.UpstreamsConfig, 0, len(upstreams))
+	for _, u := range upstreams {
+		configs = append(configs, &model.UpstreamsConfig{Host: u})
+	}
+	p := NewLoadBalanceReverseProxy(
+		"orders",
+		model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin},
+		configs,
+		circuit_breaker.NewBreakerManager(),
+	)
+	if config != nil && config.BaseInterval == 0 {
+		config.BaseInterval = time.Millisecond
+	}
+	p.SetRetryPolicy(config)
+	return p
+}
+
+func TestRetryPolicyMatching(t *testing.T) {
+	logger.Logger = zap.NewNop()
+
+	tests := []struct {
+		name     string
+		config   *model.RetryConfig
+		method   string
+		header   string
+		status   int
+		failures int64
+		want     int
+		wantHits int64
+	}{
+		{name: "disabled", config: nil, method: http.MethodGet, status: http.StatusServiceUnavailable, failures: 1, want: http.StatusServiceUnavailable, wantHits: 1},
+		{name: "single attempt", config: &model.RetryConfig{Attempts: 1}, method: http.MethodGet, status: http.StatusServiceUnavailable, failures: 1, want: http.StatusServiceUnavailable, wantHits: 1},
+		{name: "gateway error recovered", config: &model.RetryConfig{Attempts: 3}, method: http.MethodGet, status: http.StatusServiceUnavailable, failures: 2, want: http.StatusOK, wantHits: 3},
+		{name: "attempts exhausted", config: &model.RetryConfig{Attempts: 3}, method: http.MethodGet, status: http.StatusBadGateway, failures: 5, want: http.StatusBadGateway, wantHits: 3},
+		{name: "500 not a gateway error", config: &model.RetryConfig{Attempts: 3}, method: http.MethodGet, status: http.StatusInternalServerError, failures: 1, want: http.StatusInternalServerError, wantHits: 1},
+		{name: "5xx", config: &model.RetryConfig{Attempts: 3, RetryOn: []string{constants.RetryOn5xx}}, method: http.MethodGet, status: http.StatusInternalServerError, failures: 1, want: http.StatusOK, wantHits: 2},
+		{name: "retriable status code", config: &model.RetryConfig{Attempts: 3, RetriableStatusCodes: []int{http.StatusTooManyRequests}}, method: http.MethodGet, status: http.StatusTooManyRequests, failures: 1, want: http.StatusOK, wantHits: 2},
+		{name: "status not configured", config: &model.RetryConfig{Attempts: 3, RetryOn: []string{constants.RetryOnConnectFailure}}, method: http.MethodGet, status: http.StatusServiceUnavailable, failures: 1, want: http.StatusServiceUnavailable, wantHits: 1},
+		{name: "put is idempotent", config: &model.RetryConfig{Attempts: 3}, method: http.MethodPut, status: http.StatusServiceUnavailable, failures: 1, want: http.StatusOK, wantHits: 2},
+		{name: "post not retried", config: &model.RetryConfig{Attempts: 3}, method: http.MethodPost, status: http.StatusServiceUnavailable, failures: 1, want: http.StatusServiceUnavailable, wantHits: 1},
+		{name: "post with idempotency key", config: &model.RetryConfig{Attempts: 3}, method: http.MethodPost, header: "Idempotency-Key", status: http.StatusServiceUnavailable, failures: 1, want: http.StatusOK, wantHits: 2},
+		{name: "retry non idempotent", config: &model.RetryConfig{Attempts: 3, RetryNonIdempotent: true}, method: http.MethodPatch, status: http.StatusServiceUnavailable, failures: 1, want: http.StatusOK, wantHits: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFailingUpstream(t, tt.failures, tt.status)
+			p := retryProxy(tt.config, upstream.srv.URL)
+
+			r := httptest.NewRequest(tt.method, "/orders", strings.NewReader("payload"))
+			if tt.header != "" {
+				r.Header.Set(tt.header, "order-1")
+			}
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if hits := upstream.hits.Load(); hits != tt.wantHits {
+				t.Errorf("upstream hits = %d, want %d", hits, tt.wantHits)
+			}
+			// 每次尝试都重放完整的请求体
+			for i := int64(0); i < upstream.hits.Load(); i++ {
+				if body := <-upstream.bodies; body != "payload" {
+					t.Errorf("attempt %d body = %q, want %q", i+1, body, "payload")
+				}
+			}
+		})
+	}
+}
+
+func TestRetryConnectFailure(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := "http://" + l.Addr().String()
+	l.Close()
+	upstream := newFailingUpstream(t, 0, http.StatusOK)
+
+	// 连接失败时请求未发送到上游，非幂等请求也可以换一个节点重试
+	p := retryProxy(&model.RetryConfig{Attempts: 2}, dead, upstream.srv.URL)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("payload")))
+		if w.Code != http.StatusOK {
+			t.Errorf("request %d status = %d, want %d", i, w.Code, http.StatusOK)
+		}
+	}
+	if hits := upstream.hits.Load(); hits != 2 {
+		t.Errorf("upstream hits = %d, want 2", hits)
+	}
+}
+
+func TestRetryBodyTooLarge(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	upstream := newFailingUpstream(t, 1, http.StatusServiceUnavailable)
+	p := retryProxy(&model.RetryConfig{Attempts: 3, MaxBodySize: 4}, upstream.srv.URL)
+
+	// 请求体超过缓存大小时已被部分读取，无法重放，不再重试但完整转发给上游
+	r := httptest.NewRequest(http.MethodPut, "/orders", strings.NewReader("0123456789"))
+	r.ContentLength = -1
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if hits := upstream.hits.Load(); hits != 1 {
+		t.Errorf("upstream hits = %d, want 1", hits)
+	}
+	if body := <-upstream.bodies; body != "0123456789" {
+		t.Errorf("upstream body = %q, want the full request body", body)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := newRetryPolicy(&model.RetryConfig{Attempts: 5, BaseInterval: 10 * time.Millisecond, MaxInterval: 40 * time.Millisecond})
+	for n, limit := range map[int]time.Duration{
+		1: 10 * time.Millisecond,
+		2: 20 * time.Millisecond,
+		3: 40 * time.Millisecond,
+		4: 40 * time.Millisecond,
+		// 移位溢出时使用最大间隔
+		70: 40 * time.Millisecond,
+	} {
+		for i := 0; i < 100; i++ {
+			if d := p.backoff(n); d <= 0 || d > limit {
+				t.Fatalf("backoff(%d) = %v, want (0, %v]", n, d, limit)
+			}
+		}
+	}
+
+	p = newRetryPolicy(&model.RetryConfig{Attempts: 2})
+	if p.baseInterval != constants.DefaultRetryBaseInterval || p.maxInterval != 10*constants.DefaultRetryBaseInterval {
+		t.Errorf("default intervals = %v/%v, want %v/%v", p.baseInterval, p.maxInterval,
+			constants.DefaultRetryBaseInterval, 10*constants.DefaultRetryBaseInterval)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := NewRetryBudget(model.RetryBudgetConfig{BudgetPercent: 50, MinRetryConcurrency: 1})
+	if !b.acquire() {
+		t.Fatal("first retry denied")
+	}
+	if b.acquire() {
+		t.Fatal("retry allowed beyond min_retry_concurrency without active requests")
+	}
+
+	// 活跃请求增加后按百分比放宽限制
+	done := make([]func(), 4)
+	for i := range done {
+		done[i] = b.requestStarted()
+	}
+	if !b.acquire() {
+		t.Fatal("retry denied within 50% of 4 active requests")
+	}
+	if b.acquire() {
+		t.Fatal("retry allowed beyond 50% of 4 active requests")
+	}
+	for _, f := range done {
+		f()
+	}
+	b.release()
+	b.release()
+	if n := b.retries.Load(); n != 0 {
+		t.Errorf("%d retries after release, want 0", n)
+	}
+}
+
+func TestRetryBudgetExhausted(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	SetRetryBudget(model.RetryBudgetConfig{BudgetPercent: 1, MinRetryConcurrency: 1})
+	t.Cleanup(func() { SetRetryBudget(model.RetryBudgetConfig{}) })
+
+	// 其他请求的重试占满全局预算时不再重试，返回上一次的失败响应
+	if !retryBudget.acquire() {
+		t.Fatal("acquire budget")
+	}
+	upstream := newFailingUpstream(t, 2, http.StatusServiceUnavailable)
+	p := retryProxy(&model.RetryConfig{Attempts: 3}, upstream.srv.URL)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	if w.Code != http.StatusServiceUnavailable || upstream.hits.Load() != 1 {
+		t.Errorf("budget exhausted: status = %d hits = %d, want %d 1", w.Code, upstream.hits.Load(), http.StatusServiceUnavailable)
+	}
+
+	// 预算释放后恢复重试
+	retryBudget.release()
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	if w.Code != http.StatusOK || upstream.hits.Load() != 3 {
+		t.Errorf("after release: status = %d hits = %d, want %d 3", w.Code, upstream.hits.Load(), http.StatusOK)
+	}
+}
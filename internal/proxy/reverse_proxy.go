@@ -1,82 +1,164 @@
 package proxy
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lccxxo/bailuoli/internal/constants"
 	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/metrics"
 	"github.com/lccxxo/bailuoli/internal/model"
 	"github.com/lccxxo/bailuoli/internal/proxy/lb"
 	"github.com/lccxxo/bailuoli/internal/proxy/lb/circuit_breaker"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb/healthy"
 	"go.uber.org/zap"
-	"net"
+	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // 用于转发请求
 
-// 全局连接池配置（复用TCP连接）
-var transport = &http.Transport{
-	Proxy: http.ProxyFromEnvironment,
-	DialContext: (&net.Dialer{
-		Timeout:   30 * time.Second, // 连接超时
-		KeepAlive: 60 * time.Second, // 保持连接时间
-	}).DialContext,
-	MaxIdleConns:          1000,             // 最大空闲连接数
-	MaxIdleConnsPerHost:   500,              // 每个主机最大空闲连接
-	IdleConnTimeout:       90 * time.Second, // 空闲连接超时
-	TLSHandshakeTimeout:   10 * time.Second, // TLS握手超时
-	ExpectContinueTimeout: 1 * time.Second,  // Expect头超时
-	ForceAttemptHTTP2:     true,             // 启用HTTP/2
+type LoadBalanceReverseProxy struct {
+	route          string                                // 路由名称
+	loadBalance    lb.LoadBalancer                       // 负载均衡器
+	proxy          *httputil.ReverseProxy                // 反向代理
+	reqPool        sync.Pool                             // 请求上下文池
+	breakerManager *circuit_breaker.BreakerManager       // 熔断器管理器
+	breakerConfigs map[string]model.CircuitBreakerConfig // 上游节点 -> 熔断器配置
+	defaultBreaker model.CircuitBreakerConfig            // 动态添加的上游节点使用的熔断器配置
+	tlsConfigs     map[string]*model.UpstreamTLSConfig   // 上游节点 -> TLS 配置
+	defaultTLS     *model.UpstreamTLSConfig              // 动态添加的上游节点使用的 TLS 配置
+	passive        *healthy.PassiveChecker               // 被动健康检查
+	inflight       *lb.ConnCounter                       // 每个上游节点正在处理的请求数 key: upstream url
+	limits         *lb.ConnLimits                        // 并发上限
+	queue          *connQueue                            // 并发等待队列，为空则达到上限时直接拒绝
+	retry          *retryPolicy                          // 重试策略，为空则不重试
+	timeout        model.TimeoutConfig                   // 路由超时配置
+	cors           *CORSPolicy                           // 跨域策略，为空则不处理
+	sticky         *stickySession                        // 会话保持，为空则不启用
 }
 
-type LoadBalanceReverseProxy struct {
-	loadBalance    lb.LoadBalancer                 // 负载均衡器
-	proxy          *httputil.ReverseProxy          // 反向代理
-	reqPool        sync.Pool                       // 请求上下文池
-	breakerManager *circuit_breaker.BreakerManager // 熔断器管理器
+// 单次转发的结果，由 errHandler / modifyResponse 填充，用于熔断器统计和重试判断
+type proxyResult struct {
+	upstream  string
+	breaker   *circuit_breaker.CircuitBreaker
+	tls       *model.UpstreamTLSConfig
+	err       error
+	policy    *retryPolicy
+	retryable bool        // 本次失败后是否还可以重试
+	retry     bool        // 本次转发失败且需要重试，响应未写入客户端
+	status    int         // 放弃重试时返回给客户端的状态码
+	message   string      // 返回给客户端的错误信息
+	start     time.Time   // 开始转发的时间，用于统计延迟
+	timer     *time.Timer // 单次尝试超时定时器，收到响应头后停止
+	timedOut  atomic.Bool
+	cancel    context.CancelFunc // 中断本次转发
+}
+
+// writeError 向客户端返回本次转发失败的状态码
+func (result *proxyResult) writeError(w http.ResponseWriter) {
+	status := result.status
+	if status == 0 {
+		status = http.StatusBadGateway
+	}
+	if result.message != "" {
+		http.Error(w, result.message, status)
+		return
+	}
+	switch status {
+	case http.StatusBadGateway:
+		http.Error(w, "Gateway error", status)
+	case http.StatusGatewayTimeout:
+		http.Error(w, "Gateway timeout", status)
+	default:
+		http.Error(w, http.StatusText(status), status)
+	}
 }
 
 func NewLoadBalanceReverseProxy(
+	route string,
 	loadBalanceConfig model.LoadBalanceConfig,
 	upstreams []*model.UpstreamsConfig,
 	breakerManager *circuit_breaker.BreakerManager,
 ) *LoadBalanceReverseProxy {
 	urls := make([]*url.URL, 0, len(upstreams))
+	breakerConfigs := make(map[string]model.CircuitBreakerConfig, len(upstreams))
+	tlsConfigs := make(map[string]*model.UpstreamTLSConfig)
+	limits := &lb.ConnLimits{
+		Default:   int64(loadBalanceConfig.MaxConn),
+		Upstreams: make(map[string]int64),
+		Total:     int64(loadBalanceConfig.MaxRequests),
+	}
 	for _, u := range upstreams {
 		parse, _ := url.Parse(u.Host + u.Path)
 		urls = append(urls, parse)
+		breakerConfigs[parse.String()] = u.CircuitBreakerConfig
+		if u.TLS != nil {
+			tlsConfigs[parse.String()] = u.TLS
+		}
+		if u.MaxConn > 0 {
+			limits.Upstreams[parse.String()] = int64(u.MaxConn)
+		}
+	}
+
+	inflight := lb.NewConnCounter()
+	for _, u := range urls {
+		inflight.Register(u.String())
 	}
 
 	var loadBalancer lb.LoadBalancer
 	switch loadBalanceConfig.Strategy {
-	case "round":
+	case constants.StrategyRandom, "round":
 		loadBalancer = lb.NewRandomLoadBalancer(urls)
-	case "round_robin":
+	case constants.StrategyRoundRobin, "round_robin":
 		loadBalancer = lb.NewRoundRobinLoadBalancer(urls)
-	case "ip_hash":
+	case constants.StrategyIPHash:
 		loadBalancer = lb.NewIPHashLoadBalancer(urls)
-	case "weighted":
+	case constants.StrategyWeighted:
 		loadBalancer = lb.NewWeightRoundRobinLoadBalancer(urls, loadBalanceConfig.Weighted)
-	case "least-connections":
+	case constants.StrategyLeastConnections:
 		loadBalancer = lb.NewLeastConnectionLoadBalancer(urls)
+	case constants.StrategyConsistentHash:
+		loadBalancer = lb.NewConsistentHashLoadBalancer(urls, loadBalanceConfig)
+	case constants.StrategyMaglev:
+		loadBalancer = lb.NewMaglevLoadBalancer(urls, loadBalanceConfig)
+	case constants.StrategyP2C:
+		loadBalancer = lb.NewP2CLoadBalancer(urls, loadBalanceConfig, inflight)
+	case constants.StrategyEWMA:
+		loadBalancer = lb.NewEWMALoadBalancer(urls, loadBalanceConfig, inflight)
 	default:
 		return nil
 	}
 
+	loadBalancer.SetBreakerManager(route, breakerManager)
+	loadBalancer.SetConnLimits(inflight, limits)
+
 	p := &LoadBalanceReverseProxy{
+		route:          route,
 		loadBalance:    loadBalancer,
 		breakerManager: breakerManager,
+		breakerConfigs: breakerConfigs,
+		tlsConfigs:     tlsConfigs,
+		inflight:       inflight,
+		limits:         limits,
+		queue:          newConnQueue(loadBalanceConfig.Queue),
 	}
 
+	p.sticky = newStickySession(loadBalanceConfig.Sticky)
+
 	p.reqPool.New = func() interface{} {
 		return &requestContext{proxy: p}
 	}
 
 	p.proxy = &httputil.ReverseProxy{
-		Transport:      transport,
+		Transport:      roundTripperFunc(p.roundTrip),
 		Director:       p.director,
 		ModifyResponse: p.modifyResponse,
 		ErrorHandler:   p.errHandler,
@@ -85,34 +167,108 @@ func NewLoadBalanceReverseProxy(
 	return p
 }
 
+// SetDefaultBreakerConfig 设置动态添加（如服务发现）的上游节点使用的熔断器配置
+func (p *LoadBalanceReverseProxy) SetDefaultBreakerConfig(config model.CircuitBreakerConfig) {
+	p.defaultBreaker = config
+}
+
+// SetDefaultTLSConfig 设置动态添加（如服务发现）的上游节点使用的 TLS 配置
+func (p *LoadBalanceReverseProxy) SetDefaultTLSConfig(config *model.UpstreamTLSConfig) {
+	p.defaultTLS = config
+}
+
+// SetRetryPolicy 设置重试策略，config 为空或 attempts 小于2时不重试
+func (p *LoadBalanceReverseProxy) SetRetryPolicy(config *model.RetryConfig) {
+	p.retry = newRetryPolicy(config)
+}
+
+// SetTimeoutConfig 设置路由超时配置
+func (p *LoadBalanceReverseProxy) SetTimeoutConfig(config model.TimeoutConfig) {
+	p.timeout = config
+}
+
+// SetCORSPolicy 设置跨域策略，实际请求的响应会添加跨域响应头
+func (p *LoadBalanceReverseProxy) SetCORSPolicy(policy *CORSPolicy) {
+	p.cors = policy
+}
+
+// LoadBalancer 获取负载均衡器
+func (p *LoadBalanceReverseProxy) LoadBalancer() lb.LoadBalancer {
+	return p.loadBalance
+}
+
+// AddUpstream 添加上游节点
+func (p *LoadBalanceReverseProxy) AddUpstream(upstream *url.URL) {
+	p.inflight.Register(upstream.String())
+	p.loadBalance.AddUpstream(upstream)
+}
+
+// RemoveUpstream 移除上游节点，正在处理的请求不受影响
+func (p *LoadBalanceReverseProxy) RemoveUpstream(upstream *url.URL) {
+	p.loadBalance.RemoveUpstream(upstream)
+	p.breakerManager.RemoveBreaker(p.route, upstream.String())
+}
+
+// Inflight 获取上游节点正在处理的请求数
+func (p *LoadBalanceReverseProxy) Inflight(upstream *url.URL) int64 {
+	return p.inflight.Load(upstream.String())
+}
+
+// InflightSnapshot 获取所有上游节点正在处理的请求数
+func (p *LoadBalanceReverseProxy) InflightSnapshot() map[string]int64 {
+	return p.inflight.Snapshot()
+}
+
+// SetHealthChecker 设置主动健康检查器
+func (p *LoadBalanceReverseProxy) SetHealthChecker(checker *healthy.Checker) {
+	p.loadBalance.SetHealthChecker(checker)
+}
+
+// SetPassiveChecker 设置被动健康检查器，转发结果会反馈给它
+func (p *LoadBalanceReverseProxy) SetPassiveChecker(checker *healthy.PassiveChecker) {
+	p.passive = checker
+	p.loadBalance.SetPassiveChecker(checker)
+}
+
 func (p *LoadBalanceReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := p.reqPool.Get().(*requestContext)
 	defer p.reqPool.Put(ctx)
+	defer retryBudget.requestStarted()()
 
 	done := make(chan struct{})
 
+	// 转发过程中的 panic（如 httputil.ReverseProxy 传输响应体失败时的 http.ErrAbortHandler）
+	// 需要在当前 goroutine 中重新抛出，交给 http.Server 处理，否则会导致进程退出
+	var panicked interface{}
 	go func() {
 		defer close(done)
+		defer func() {
+			panicked = recover()
+		}()
 		ctx.process(w, r)
 	}()
 
 	<-done
+	if panicked != nil {
+		panic(panicked)
+	}
 }
 
 /*
 	1. director：在每次请求被转发前调用Director函数，自动去除前缀
-	2. modifyResponse：如果是LeastConnectionLoadBalancer策略，更新连接计数
-	3. errHandler：处理转发时出现的错误
+	2. modifyResponse：如果是LeastConnectionLoadBalancer策略，更新连接计数；添加跨域响应头；反馈延迟；记录熔断器失败状态码；需要重试的状态码返回错误；写入会话保持 Cookie
+	3. errHandler：处理转发时出现的错误，记录熔断器失败、反馈延迟；需要重试时不写入响应
 */
 
 // 请求预处理
 func (p *LoadBalanceReverseProxy) director(r *http.Request) {
 	logger.Logger.Info("request", zap.String("url", r.URL.String()))
-	if route := r.Context().Value("route").(*model.Route); route != nil {
+	if route, ok := r.Context().Value("route").(*model.Route); ok && route != nil {
 		if route.StripPrefix {
 			r.URL.Path = strings.TrimPrefix(r.URL.Path, route.Path)
 		}
 	}
+	setDeadlineHeaders(r)
 }
 
 // 错误处理
@@ -121,8 +277,59 @@ func (p *LoadBalanceReverseProxy) errHandler(w http.ResponseWriter, r *http.Requ
 	if release, ok := r.Context().Value("least_conn_counter").(func()); ok {
 		release()
 	}
-	// todo 可以记录故障的上游节点
-	http.Error(w, "Gateway error", http.StatusBadGateway)
+
+	result, ok := r.Context().Value("proxy_result").(*proxyResult)
+	if !ok {
+		http.Error(w, "Gateway error", http.StatusBadGateway)
+		return
+	}
+
+	// 需要重试的状态码已在 modifyResponse 中统计
+	if errors.Is(err, errRetryableStatus) {
+		result.retry = true
+		return
+	}
+
+	// 记录故障交给熔断器和被动健康检查统计
+	timedOut := false
+	switch {
+	case result.timedOut.Load():
+		timedOut = true
+		err = fmt.Errorf("upstream %s per-try timeout: %w", result.upstream, err)
+		result.status = http.StatusGatewayTimeout
+		result.message = "upstream per-try timeout"
+	case errors.Is(r.Context().Err(), context.DeadlineExceeded):
+		// 整个请求超时，不再重试
+		result.status = http.StatusGatewayTimeout
+		result.message = "upstream request timeout"
+		result.retryable = false
+	case isConnectFailure(err) && isTimeout(err):
+		result.status = http.StatusGatewayTimeout
+		result.message = "upstream connect timeout"
+	case isTimeout(err):
+		timedOut = true
+		result.status = http.StatusGatewayTimeout
+		result.message = "upstream response header timeout"
+	default:
+		result.status = http.StatusBadGateway
+	}
+	// 客户端断开不是上游节点的故障，不计入熔断器、被动健康检查和节点延迟
+	if errors.Is(r.Context().Err(), context.Canceled) && !timedOut {
+		result.err = context.Canceled
+		result.retryable = false
+		return
+	}
+	result.err = err
+	if p.passive != nil {
+		p.passive.RecordFailure(result.upstream)
+	}
+	p.observeLatency(result, max(time.Since(result.start), constants.EWMAErrorPenalty))
+
+	if result.retryable && result.policy.retryOnError(r, err, timedOut) {
+		result.retry = true
+		return
+	}
+	result.writeError(w)
 }
 
 // 转发响应后的钩子函数
@@ -132,18 +339,142 @@ func (p *LoadBalanceReverseProxy) modifyResponse(resp *http.Response) error {
 			defer release()
 		}
 	}
+	if p.cors != nil {
+		p.cors.applyResponse(resp.Request, resp.Header)
+	}
+	// 配置的失败状态码计入熔断器
+	result, ok := resp.Request.Context().Value("proxy_result").(*proxyResult)
+	if !ok {
+		return nil
+	}
+	if result.timer != nil {
+		result.timer.Stop()
+	}
+	p.observeLatency(result, time.Since(result.start))
+	if idle := p.timeout.Idle; idle > 0 && result.cancel != nil {
+		// 响应体长时间没有数据时中断转发
+		upstream, cancel := result.upstream, result.cancel
+		resp.Body = newIdleTimeoutBody(resp.Body, idle, func() {
+			logger.Logger.Warn("upstream idle timeout", zap.String("upstream", upstream), zap.Duration("idle", idle))
+			cancel()
+		})
+	}
+	if result.breaker.IsFailureStatus(resp.StatusCode) {
+		result.err = fmt.Errorf("upstream %s responded with status %d", resp.Request.URL.Host, resp.StatusCode)
+	}
+	if p.passive != nil {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			p.passive.RecordFailure(result.upstream)
+		} else {
+			p.passive.RecordSuccess(result.upstream)
+		}
+	}
+	if result.retryable && result.policy.retryOnStatus(resp.Request, resp.StatusCode) {
+		result.status = resp.StatusCode
+		return errRetryableStatus
+	}
+	if p.sticky != nil {
+		p.sticky.setCookie(resp, result.upstream)
+	}
 	return nil
 }
 
+// observeLatency 向基于延迟的负载均衡器反馈本次转发的延迟
+func (p *LoadBalanceReverseProxy) observeLatency(result *proxyResult, latency time.Duration) {
+	if o, ok := p.loadBalance.(lb.LatencyObserver); ok && !result.start.IsZero() {
+		o.ObserveLatency(result.upstream, latency)
+	}
+}
+
 type requestContext struct {
 	proxy *LoadBalanceReverseProxy
 }
 
 func (p *requestContext) process(w http.ResponseWriter, r *http.Request) {
-	target, err := p.proxy.loadBalance.Next(r)
+	policy := p.proxy.retry
+
+	// 整个请求的超时时间（包含重试）
+	if timeout := requestTimeout(r, p.proxy.timeout.Request); timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	// 缓存请求体，重试时重放
+	attempts := 1
+	var body []byte
+	if policy != nil {
+		var ok bool
+		if body, ok = policy.bufferBody(r); ok {
+			attempts = policy.attempts
+		}
+	}
+
+	route := logger.GetRequestInfo(r.Context()).Route
+	tried := make(map[string]bool, attempts)
+	var last *proxyResult
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			if err := r.Context().Err(); err != nil {
+				writeContextError(w, err)
+				return
+			}
+			if !retryBudget.acquire() {
+				metrics.ObserveRetry(route, "budget_exhausted")
+				last.writeError(w)
+				return
+			}
+			metrics.ObserveRetry(route, "attempted")
+			if !sleepContext(r.Context(), policy.backoff(attempt-1)) {
+				retryBudget.release()
+				writeContextError(w, r.Context().Err())
+				return
+			}
+		}
+		if body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+		}
+
+		last = p.forward(w, r, policy, attempt < attempts, tried)
+		if attempt > 1 {
+			retryBudget.release()
+		}
+		if !last.retry {
+			return
+		}
+		logger.Logger.Warn("retrying upstream request",
+			zap.String("route", route),
+			zap.String("upstream", last.upstream),
+			zap.Int("attempt", attempt),
+			zap.Error(last.err))
+	}
+}
+
+// forward 选择上游节点并执行一次转发，retryable 表示失败后是否还可以重试
+func (p *requestContext) forward(w http.ResponseWriter, r *http.Request, policy *retryPolicy, retryable bool, tried map[string]bool) *proxyResult {
+	target, err := p.acquireUpstream(r, tried)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
-		return
+		result := &proxyResult{err: err, status: http.StatusBadGateway}
+		switch {
+		case errors.Is(err, constants.ErrCircuitBreakerOpen):
+			// 所有熔断器都打开时返回 503
+			result.status = http.StatusServiceUnavailable
+		case errors.Is(err, constants.ErrUpstreamsBusy), errors.Is(err, constants.ErrConnQueueFull), errors.Is(err, constants.ErrConnQueueTimeout):
+			metrics.ObserveConnQueueRejected(logger.GetRequestInfo(r.Context()).Route, busyReason(err))
+			result.status = http.StatusServiceUnavailable
+			writeBusy(w, err)
+			return result
+		case r.Context().Err() != nil:
+			// 排队期间请求超时或客户端断开
+			result.status = http.StatusGatewayTimeout
+			writeContextError(w, err)
+			return result
+		}
+		http.Error(w, err.Error(), result.status)
+		return result
 	}
 
 	r.URL.Host = target.Host
@@ -152,5 +483,93 @@ func (p *requestContext) process(w http.ResponseWriter, r *http.Request) {
 	r.Host = target.Host
 	r.URL.Path = target.Path
 
-	p.proxy.proxy.ServeHTTP(w, r)
+	// 通过上游节点对应的熔断器转发请求
+	key := target.String()
+	breakerConfig, ok := p.proxy.breakerConfigs[key]
+	if !ok {
+		breakerConfig = p.proxy.defaultBreaker
+	}
+	tlsConfig, ok := p.proxy.tlsConfigs[key]
+	if !ok {
+		tlsConfig = p.proxy.defaultTLS
+	}
+	result := &proxyResult{
+		upstream:  key,
+		breaker:   p.proxy.breakerManager.GetBreaker(p.proxy.route, key, breakerConfig),
+		tls:       tlsConfig,
+		policy:    policy,
+		retryable: retryable,
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(r.Context(), "proxy_result", result))
+	defer cancel()
+	result.cancel = cancel
+	if policy != nil && policy.perTryTimeout > 0 {
+		// 只限制等待响应头的时间，避免中断正在传输的响应体
+		result.timer = time.AfterFunc(policy.perTryTimeout, func() {
+			result.timedOut.Store(true)
+			cancel()
+		})
+		defer result.timer.Stop()
+	}
+	req := r.WithContext(ctx)
+
+	info := logger.GetRequestInfo(r.Context())
+	info.Upstream = key
+
+	// acquireUpstream 已占用并发名额
+	defer p.proxy.releaseConn(key)
+	defer metrics.UpstreamRequestStarted(info.Route, key)()
+
+	result.start = time.Now()
+	err = result.breaker.Execute(func() error {
+		p.proxy.proxy.ServeHTTP(w, req)
+		return result.err
+	})
+	if errors.Is(err, constants.ErrCircuitBreakerOpen) {
+		// 熔断器在选择节点后打开（或半开状态试探请求已满），请求未被转发
+		if release, ok := req.Context().Value("least_conn_counter").(func()); ok {
+			release()
+		}
+		result.err = err
+		result.status = http.StatusServiceUnavailable
+		if retryable {
+			result.retry = true
+			return result
+		}
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	}
+	return result
+}
+
+// writeContextError 重试等待期间请求结束：超时返回 504，客户端断开时不再写入响应
+func writeContextError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, "upstream request timeout", http.StatusGatewayTimeout)
+	}
+}
+
+// nextUpstream 通过负载均衡选择节点，重试时尽量选择未尝试过的节点
+func (p *requestContext) nextUpstream(r *http.Request, tried map[string]bool) (*url.URL, error) {
+	// 会话保持：Cookie 中的节点可用时直接使用，重试时按负载均衡策略重新选择
+	if sticky := p.proxy.sticky; sticky != nil {
+		if target := sticky.upstream(r, p.proxy.loadBalance); target != nil && !tried[target.String()] {
+			tried[target.String()] = true
+			return target, nil
+		}
+	}
+	for i := 0; ; i++ {
+		target, err := p.proxy.loadBalance.Next(r)
+		if err != nil {
+			return nil, err
+		}
+		if !tried[target.String()] || i >= len(tried) {
+			tried[target.String()] = true
+			return target, nil
+		}
+		// 放弃已尝试过的节点，释放最小连接策略的计数
+		if release, ok := r.Context().Value("least_conn_counter").(func()); ok {
+			release()
+		}
+	}
 }
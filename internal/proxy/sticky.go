@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb"
+)
+
+// 会话保持
+// Cookie 格式为 <节点ID>.<过期时间>.<签名>，节点ID 为上游地址的哈希，不暴露内部地址
+// 签名防止客户端伪造 Cookie 指定节点，过期时间在服务端校验，避免 Cookie 被长期重放
+
+// 未配置密钥时使用的进程级随机密钥，配置热更新后已签发的 Cookie 仍然有效
+var stickyProcessKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+type stickySession struct {
+	name     string
+	ttl      time.Duration
+	path     string
+	sameSite http.SameSite
+	secure   bool
+	key      []byte
+}
+
+func newStickySession(config *model.StickyConfig) *stickySession {
+	if config == nil {
+		return nil
+	}
+	s := &stickySession{
+		name:     config.CookieName,
+		ttl:      config.TTL,
+		path:     config.Path,
+		sameSite: http.SameSiteLaxMode,
+		secure:   config.Secure,
+		key:      []byte(config.Secret),
+	}
+	if s.name == "" {
+		s.name = constants.DefaultStickyCookieName
+	}
+	if s.path == "" {
+		s.path = constants.DefaultStickyPath
+	}
+	switch strings.ToLower(config.SameSite) {
+	case constants.StickySameSiteStrict:
+		s.sameSite = http.SameSiteStrictMode
+	case constants.StickySameSiteNone:
+		s.sameSite = http.SameSiteNoneMode
+		s.secure = true // 浏览器要求 SameSite=None 的 Cookie 必须设置 Secure
+	}
+	if len(s.key) == 0 {
+		s.key = stickyProcessKey
+	}
+	return s
+}
+
+// upstream 获取 Cookie 中的节点，Cookie 无效、节点不存在或不可用时返回 nil
+func (s *stickySession) upstream(r *http.Request, balancer lb.LoadBalancer) *url.URL {
+	id, ok := s.verify(r)
+	if !ok {
+		return nil
+	}
+	for _, u := range balancer.Upstreams() {
+		if upstreamID(u.String()) == id {
+			if balancer.Available(u) {
+				return u
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// setCookie 本次转发的节点与 Cookie 中的节点不同时写入新的 Cookie
+func (s *stickySession) setCookie(resp *http.Response, upstream string) {
+	id := upstreamID(upstream)
+	if current, ok := s.verify(resp.Request); ok && current == id {
+		return
+	}
+
+	var expires int64
+	cookie := &http.Cookie{
+		Name:     s.name,
+		Path:     s.path,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: s.sameSite,
+	}
+	if s.ttl > 0 {
+		expires = time.Now().Add(s.ttl).Unix()
+		cookie.MaxAge = int(s.ttl.Seconds())
+	}
+	payload := id + "." + strconv.FormatInt(expires, 10)
+	cookie.Value = payload + "." + s.sign(payload)
+	resp.Header.Add("Set-Cookie", cookie.String())
+}
+
+// verify 校验 Cookie 的签名和过期时间，返回节点ID
+func (s *stickySession) verify(r *http.Request) (string, bool) {
+	c, err := r.Cookie(s.name)
+	if err != nil {
+		return "", false
+	}
+	i := strings.LastIndexByte(c.Value, '.')
+	if i < 0 {
+		return "", false
+	}
+	payload, signature := c.Value[:i], c.Value[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return "", false
+	}
+
+	id, exp, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || expires > 0 && time.Now().Unix() > expires {
+		return "", false
+	}
+	return id, true
+}
+
+func (s *stickySession) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// upstreamID 节点ID
+func upstreamID(upstream string) string {
+	sum := sha256.Sum256([]byte(upstream))
+	return hex.EncodeToString(sum[:8])
+}
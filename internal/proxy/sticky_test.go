@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb/circuit_breaker"
+	"go.uber.org/zap"
+)
+
+// stickyProxy 轮询转发到两个上游节点的反向代理，上游响应自己的地址
+func stickyProxy(t *testing.T, config *model.StickyConfig) (*LoadBalanceReverseProxy, []string) {
+	t.Helper()
+	var hosts []string
+	var upstreams []*model.UpstreamsConfig
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("http://" + r.Host))
+		}))
+		t.Cleanup(srv.Close)
+		hosts = append(hosts, srv.URL)
+		upstreams = append(upstreams, &model.UpstreamsConfig{Host: srv.URL})
+	}
+	p := NewLoadBalanceReverseProxy(
+		"orders",
+		model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin, Sticky: config},
+		upstreams,
+		circuit_breaker.NewBreakerManager(),
+	)
+	return p, hosts
+}
+
+// stickyRequest 携带 Cookie 发送请求，返回响应的上游节点和新写入的 Cookie
+func stickyRequest(p *LoadBalanceReverseProxy, cookie string) (string, *http.Cookie) {
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: constants.DefaultStickyCookieName, Value: cookie})
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	var set *http.Cookie
+	if cookies := w.Result().Cookies(); len(cookies) > 0 {
+		set = cookies[0]
+	}
+	return w.Body.String(), set
+}
+
+// signedCookie 使用会话保持的密钥签发指定节点和过期时间的 Cookie
+func signedCookie(s *stickySession, upstream string, expires int64) string {
+	payload := upstreamID(upstream) + "." + strconv.FormatInt(expires, 10)
+	return payload + "." + s.sign(payload)
+}
+
+func TestStickySession(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	p, _ := stickyProxy(t, &model.StickyConfig{Secret: "sticky-secret", TTL: time.Hour})
+
+	first, cookie := stickyRequest(p, "")
+	if cookie == nil {
+		t.Fatal("no sticky cookie set")
+	}
+	if !cookie.HttpOnly || cookie.MaxAge != 3600 || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie attributes = %+v", cookie)
+	}
+	if strings.Contains(cookie.Value, "127.0.0.1") {
+		t.Errorf("cookie %q exposes the upstream address", cookie.Value)
+	}
+
+	// 携带有效 Cookie 的请求始终转发到同一个节点，且不重复写入 Cookie
+	for i := 0; i < 4; i++ {
+		got, set := stickyRequest(p, cookie.Value)
+		if got != first {
+			t.Fatalf("request %d routed to %s, want %s", i, got, first)
+		}
+		if set != nil {
+			t.Fatalf("request %d set cookie again", i)
+		}
+	}
+}
+
+func TestStickySessionRejectsTamperedCookie(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	p, hosts := stickyProxy(t, &model.StickyConfig{Secret: "sticky-secret"})
+	first, cookie := stickyRequest(p, "")
+	other := hosts[0]
+	if first == other {
+		other = hosts[1]
+	}
+	valid := cookie.Value
+	parts := strings.Split(valid, ".")
+	forger := newStickySession(&model.StickyConfig{Secret: "other-secret"})
+
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		// 替换节点ID，签名不匹配
+		{name: "swapped upstream id", cookie: upstreamID(other) + "." + parts[1] + "." + parts[2]},
+		// 修改过期时间试图延长有效期
+		{name: "extended expiry", cookie: parts[0] + "." + strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + "." + parts[2]},
+		{name: "signed with another key", cookie: signedCookie(forger, other, 0)},
+		{name: "truncated signature", cookie: valid[:len(valid)-2]},
+		{name: "missing signature", cookie: parts[0] + "." + parts[1]},
+		{name: "plain upstream address", cookie: other},
+		{name: "empty", cookie: "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 无效的 Cookie 被忽略，按负载均衡策略选择节点并写入新的 Cookie
+			seen := make(map[string]bool)
+			for i := 0; i < 4; i++ {
+				got, set := stickyRequest(p, tt.cookie)
+				seen[got] = true
+				if set == nil {
+					t.Fatal("tampered cookie not replaced")
+				}
+			}
+			if len(seen) != len(hosts) {
+				t.Errorf("tampered cookie pinned requests to %v", seen)
+			}
+		})
+	}
+}
+
+func TestStickySessionExpiry(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	p, hosts := stickyProxy(t, &model.StickyConfig{Secret: "sticky-secret", TTL: time.Hour})
+
+	// 签名正确但已过期的 Cookie 不再有效
+	expired := signedCookie(p.sticky, hosts[1], time.Now().Add(-time.Minute).Unix())
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		got, _ := stickyRequest(p, expired)
+		seen[got] = true
+	}
+	if len(seen) != len(hosts) {
+		t.Errorf("expired cookie pinned requests to %v", seen)
+	}
+
+	// 未过期的 Cookie 有效，过期时间为 0 表示会话 Cookie
+	for _, expires := range []int64{time.Now().Add(time.Minute).Unix(), 0} {
+		for i := 0; i < 4; i++ {
+			if got, _ := stickyRequest(p, signedCookie(p.sticky, hosts[1], expires)); got != hosts[1] {
+				t.Fatalf("cookie expiring at %d routed to %s, want %s", expires, got, hosts[1])
+			}
+		}
+	}
+}
+
+func TestStickySessionUnavailableUpstream(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	p, hosts := stickyProxy(t, &model.StickyConfig{Secret: "sticky-secret"})
+	cookie := signedCookie(p.sticky, hosts[1], 0)
+
+	// Cookie 中的节点熔断后改为其他节点，并写入新节点的 Cookie
+	breaker := p.breakerManager.GetBreaker("orders", hosts[1], model.CircuitBreakerConfig{ConsecutiveErrorTrigger: 1, OpenStateTimeout: time.Hour})
+	for i := 0; i < 2; i++ {
+		_ = breaker.Execute(func() error { return errors.New("upstream failure") })
+	}
+	got, set := stickyRequest(p, cookie)
+	if got != hosts[0] {
+		t.Fatalf("routed to %s, want %s", got, hosts[0])
+	}
+	if set == nil || set.Value != signedCookie(p.sticky, hosts[0], 0) {
+		t.Errorf("cookie = %v, want a cookie for %s", set, hosts[0])
+	}
+}
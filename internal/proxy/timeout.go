@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+)
+
+// 路由级别超时
+// 1. connect、response_header 通过 Transport 实现，见 transport.go
+// 2. request 限制整个请求（包含重试），并与客户端通过请求头传入的超时时间取较小值
+// 3. idle 限制响应体传输过程中无数据的时间，响应头已经发出，超时后只能中断连接
+
+// requestTimeout 计算请求的超时时间：路由配置与客户端请求头中较小的值，0 表示不限制
+func requestTimeout(r *http.Request, routeTimeout time.Duration) time.Duration {
+	timeout := routeTimeout
+	if d, ok := parseRequestTimeout(r); ok && (timeout <= 0 || d < timeout) {
+		timeout = d
+	}
+	return timeout
+}
+
+// parseRequestTimeout 解析客户端传入的超时时间，优先使用 X-Request-Timeout
+func parseRequestTimeout(r *http.Request) (time.Duration, bool) {
+	if v := r.Header.Get(constants.HeaderRequestTimeout); v != "" {
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond, true
+		}
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d, true
+		}
+	}
+	if v := r.Header.Get(constants.HeaderGRPCTimeout); v != "" {
+		return parseGRPCTimeout(v)
+	}
+	return 0, false
+}
+
+// parseGRPCTimeout 解析 gRPC 超时格式：最多8位数字 + 单位（H M S m u n）
+func parseGRPCTimeout(v string) (time.Duration, bool) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, false
+	}
+
+	var unit time.Duration
+	switch v[len(v)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// formatGRPCTimeout 格式化为 gRPC 超时格式，优先使用毫秒
+func formatGRPCTimeout(d time.Duration) string {
+	const maxValue = 99999999
+	if ms := d.Milliseconds(); ms <= maxValue {
+		if ms < 1 {
+			ms = 1
+		}
+		return strconv.FormatInt(ms, 10) + "m"
+	}
+	if s := int64(d / time.Second); s <= maxValue {
+		return strconv.FormatInt(s, 10) + "S"
+	}
+	return strconv.FormatInt(int64(d/time.Hour), 10) + "H"
+}
+
+// setDeadlineHeaders 将请求剩余的超时时间传递给上游
+func setDeadlineHeaders(r *http.Request) {
+	deadline, ok := r.Context().Deadline()
+	if !ok {
+		return
+	}
+
+	remaining := time.Until(deadline)
+	if remaining < time.Millisecond {
+		remaining = time.Millisecond
+	}
+	r.Header.Set(constants.HeaderRequestTimeout, strconv.FormatInt(remaining.Milliseconds(), 10))
+	if r.Header.Get(constants.HeaderGRPCTimeout) != "" || strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		r.Header.Set(constants.HeaderGRPCTimeout, formatGRPCTimeout(remaining))
+	}
+}
+
+// isTimeout 判断是否为连接或等待响应头超时
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// idleTimeoutBody 响应体在 timeout 时间内没有读取到数据时调用 onTimeout
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, onTimeout func()) *idleTimeoutBody {
+	return &idleTimeoutBody{
+		ReadCloser: body,
+		timeout:    timeout,
+		timer:      time.AfterFunc(timeout, onTimeout),
+	}
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
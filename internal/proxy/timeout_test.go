@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb/circuit_breaker"
+	"go.uber.org/zap"
+)
+
+func TestParseRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		grpc    string
+		want    time.Duration
+		wantSet bool
+	}{
+		{name: "none"},
+		{name: "milliseconds", header: "1500", want: 1500 * time.Millisecond, wantSet: true},
+		{name: "duration", header: "1.5s", want: 1500 * time.Millisecond, wantSet: true},
+		{name: "zero", header: "0"},
+		{name: "negative duration", header: "-1s"},
+		{name: "invalid", header: "soon"},
+		{name: "header preferred", header: "200", grpc: "5S", want: 200 * time.Millisecond, wantSet: true},
+		{name: "invalid header falls back to grpc", header: "soon", grpc: "5S", want: 5 * time.Second, wantSet: true},
+		{name: "grpc hours", grpc: "1H", want: time.Hour, wantSet: true},
+		{name: "grpc minutes", grpc: "2M", want: 2 * time.Minute, wantSet: true},
+		{name: "grpc milliseconds", grpc: "100m", want: 100 * time.Millisecond, wantSet: true},
+		{name: "grpc microseconds", grpc: "250u", want: 250 * time.Microsecond, wantSet: true},
+		{name: "grpc nanoseconds", grpc: "99999999n", want: 99999999 * time.Nanosecond, wantSet: true},
+		{name: "grpc too many digits", grpc: "123456789m"},
+		{name: "grpc missing value", grpc: "m"},
+		{name: "grpc unknown unit", grpc: "10x"},
+		{name: "grpc zero", grpc: "0S"},
+		{name: "grpc signed", grpc: "-5S"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set(constants.HeaderRequestTimeout, tt.header)
+			}
+			if tt.grpc != "" {
+				r.Header.Set(constants.HeaderGRPCTimeout, tt.grpc)
+			}
+			got, ok := parseRequestTimeout(r)
+			if got != tt.want || ok != tt.wantSet {
+				t.Errorf("parseRequestTimeout = %v, %v, want %v, %v", got, ok, tt.want, tt.wantSet)
+			}
+		})
+	}
+}
+
+func TestRequestTimeoutClamp(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		route  time.Duration
+		want   time.Duration
+	}{
+		{name: "no limit"},
+		{name: "route only", route: time.Second, want: time.Second},
+		{name: "client only", header: "300", want: 300 * time.Millisecond},
+		{name: "client shorter", header: "300", route: time.Second, want: 300 * time.Millisecond},
+		// 客户端不能放宽路由配置的超时时间
+		{name: "client longer", header: "5s", route: time.Second, want: time.Second},
+		{name: "invalid client", header: "soon", route: time.Second, want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set(constants.HeaderRequestTimeout, tt.header)
+			}
+			if got := requestTimeout(r, tt.route); got != tt.want {
+				t.Errorf("requestTimeout = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 0, want: "1m"},
+		{d: 1500 * time.Millisecond, want: "1500m"},
+		{d: 99999999 * time.Millisecond, want: "99999999m"},
+		{d: 100000000 * time.Millisecond, want: "100000S"},
+		{d: 100000000 * time.Second, want: "27777H"},
+	}
+	for _, tt := range tests {
+		if got := formatGRPCTimeout(tt.d); got != tt.want {
+			t.Errorf("formatGRPCTimeout(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+// timeoutProxy 创建转发到 upstream 的反向代理并设置超时配置
+func timeoutProxy(upstream string, timeout model.TimeoutConfig, retry *model.RetryConfig) *LoadBalanceReverseProxy {
+	p := NewLoadBalanceReverseProxy(
+		"orders",
+		model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin},
+		[]*model.UpstreamsConfig{{Host: upstream}},
+		circuit_breaker.NewBreakerManager(),
+	)
+	p.SetTimeoutConfig(timeout)
+	p.SetRetryPolicy(retry)
+	return p
+}
+
+func TestTimeoutStatusMapping(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	release := make(chan struct{})
+	defer close(release)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	reset := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer reset.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + l.Addr().String()
+	l.Close()
+
+	// 超时返回 504，其他转发错误返回 502
+	tests := []struct {
+		name     string
+		upstream string
+		timeout  model.TimeoutConfig
+		retry    *model.RetryConfig
+		header   string
+		want     int
+	}{
+		{name: "request timeout", upstream: slow.URL, timeout: model.TimeoutConfig{Request: 50 * time.Millisecond}, want: http.StatusGatewayTimeout},
+		{name: "client timeout", upstream: slow.URL, header: "50", want: http.StatusGatewayTimeout},
+		{name: "response header timeout", upstream: slow.URL, timeout: model.TimeoutConfig{ResponseHeader: 50 * time.Millisecond}, want: http.StatusGatewayTimeout},
+		{name: "per-try timeout", upstream: slow.URL, retry: &model.RetryConfig{Attempts: 2, PerTryTimeout: 50 * time.Millisecond, BaseInterval: time.Millisecond}, want: http.StatusGatewayTimeout},
+		{name: "connection refused", upstream: refused, want: http.StatusBadGateway},
+		{name: "connection reset", upstream: reset.URL, want: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := timeoutProxy(tt.upstream, tt.timeout, tt.retry)
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			if tt.header != "" {
+				r.Header.Set(constants.HeaderRequestTimeout, tt.header)
+			}
+			w := httptest.NewRecorder()
+			start := time.Now()
+			p.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("request took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestRequestDeadlinePropagation(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	headers := make(chan http.Header, 2)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		if r.Header.Get("X-Slow") != "" {
+			<-r.Context().Done()
+		}
+	}))
+	defer upstream.Close()
+	p := timeoutProxy(upstream.URL, model.TimeoutConfig{Request: 200 * time.Millisecond}, nil)
+
+	// 上游收到剩余的超时时间，gRPC 请求同时设置 grpc-timeout
+	r := httptest.NewRequest(http.MethodPost, "/orders", nil)
+	r.Header.Set("Content-Type", "application/grpc")
+	r.Header.Set(constants.HeaderRequestTimeout, "5s")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	h := <-headers
+	ms, err := strconv.ParseInt(h.Get(constants.HeaderRequestTimeout), 10, 64)
+	if err != nil || ms <= 0 || ms > 200 {
+		t.Errorf("%s = %q, want remaining milliseconds within the route timeout", constants.HeaderRequestTimeout, h.Get(constants.HeaderRequestTimeout))
+	}
+	if grpc := h.Get(constants.HeaderGRPCTimeout); !strings.HasSuffix(grpc, "m") {
+		t.Errorf("%s = %q, want milliseconds", constants.HeaderGRPCTimeout, grpc)
+	}
+
+	// 上游未在截止时间前响应时中断转发并返回 504
+	r = httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.Header.Set("X-Slow", "1")
+	w = httptest.NewRecorder()
+	start := time.Now()
+	p.ServeHTTP(w, r)
+	elapsed := time.Since(start)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+	if elapsed < 200*time.Millisecond || elapsed > time.Second {
+		t.Errorf("request finished after %v, want about 200ms", elapsed)
+	}
+	if h := <-headers; h.Get(constants.HeaderGRPCTimeout) != "" {
+		t.Errorf("%s set on a non-grpc request", constants.HeaderGRPCTimeout)
+	}
+}
@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/certs"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 上游连接的 Transport 管理
+// 超时配置和 TLS 配置相同的上游节点共享同一个 Transport（连接池），
+// Transport 全局缓存，配置热更新后未变化的配置继续复用原有连接，不再使用的配置关闭空闲连接并移出缓存
+// 注意：缓存以文件路径为准，证书文件内容变化需要修改路径或重启后生效
+
+// 全局连接池配置（复用TCP连接）
+var transport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second, // 连接超时
+		KeepAlive: 60 * time.Second, // 保持连接时间
+	}).DialContext,
+	MaxIdleConns:          1000,             // 最大空闲连接数
+	MaxIdleConnsPerHost:   500,              // 每个主机最大空闲连接
+	IdleConnTimeout:       90 * time.Second, // 空闲连接超时
+	TLSHandshakeTimeout:   10 * time.Second, // TLS握手超时
+	ExpectContinueTimeout: 1 * time.Second,  // Expect头超时
+	ForceAttemptHTTP2:     true,             // 启用HTTP/2
+}
+
+// transportKey 决定 Transport 行为的配置
+type transportKey struct {
+	connect        time.Duration
+	responseHeader time.Duration
+	tls            model.UpstreamTLSConfig
+	hasTLS         bool
+}
+
+var (
+	transportsMu sync.RWMutex
+	transports   = make(map[transportKey]*http.Transport)
+)
+
+func newTransportKey(timeout model.TimeoutConfig, tlsConfig *model.UpstreamTLSConfig) transportKey {
+	key := transportKey{connect: timeout.Connect, responseHeader: timeout.ResponseHeader}
+	if tlsConfig != nil {
+		key.tls = *tlsConfig
+		key.hasTLS = true
+	}
+	return key
+}
+
+// getTransport 获取超时配置和 TLS 配置对应的 Transport，没有特殊配置时使用全局 Transport
+func getTransport(timeout model.TimeoutConfig, tlsConfig *model.UpstreamTLSConfig) (*http.Transport, error) {
+	key := newTransportKey(timeout, tlsConfig)
+	if key == (transportKey{}) {
+		return transport, nil
+	}
+
+	transportsMu.RLock()
+	t, ok := transports[key]
+	transportsMu.RUnlock()
+	if ok {
+		return t, nil
+	}
+
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if t, ok := transports[key]; ok {
+		return t, nil
+	}
+
+	t = transport.Clone()
+	if key.connect > 0 {
+		t.DialContext = (&net.Dialer{
+			Timeout:   key.connect,
+			KeepAlive: 60 * time.Second,
+		}).DialContext
+	}
+	t.ResponseHeaderTimeout = key.responseHeader
+	if key.hasTLS {
+		clientConfig, err := certs.ClientTLSConfig(tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig = clientConfig
+	}
+
+	transports[key] = t
+	return t, nil
+}
+
+// CloseUnusedTransports 关闭并移除 proxies 都不再使用的 Transport（路由热更新后调用）
+// 只关闭空闲连接，正在处理的请求不受影响
+func CloseUnusedTransports(proxies []*LoadBalanceReverseProxy) {
+	used := make(map[transportKey]bool)
+	for _, p := range proxies {
+		used[newTransportKey(p.timeout, nil)] = true
+		used[newTransportKey(p.timeout, p.defaultTLS)] = true
+		for _, tlsConfig := range p.tlsConfigs {
+			used[newTransportKey(p.timeout, tlsConfig)] = true
+		}
+	}
+
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	for key, t := range transports {
+		if !used[key] {
+			t.CloseIdleConnections()
+			delete(transports, key)
+		}
+	}
+}
+
+// roundTripperFunc 将函数适配为 http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// roundTrip 根据路由超时配置和本次转发的上游节点 TLS 配置选择 Transport
+func (p *LoadBalanceReverseProxy) roundTrip(r *http.Request) (*http.Response, error) {
+	var tlsConfig *model.UpstreamTLSConfig
+	if result, ok := r.Context().Value("proxy_result").(*proxyResult); ok {
+		tlsConfig = result.tls
+	}
+	t, err := getTransport(p.timeout, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("upstream tls config: %w", err)
+	}
+	return t.RoundTrip(r)
+}
@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/logger"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"github.com/lccxxo/bailuoli/internal/proxy/lb/circuit_breaker"
+	"go.uber.org/zap"
+)
+
+// tlsUpstream httptest 的 HTTPS 上游，响应客户端证书数量
+// 证书为自签名证书，包含 example.com 和 127.0.0.1，直接作为 CA 使用
+type tlsUpstream struct {
+	srv      *httptest.Server
+	caFile   string
+	certFile string // 客户端证书，复用 httptest 的证书
+	keyFile  string
+}
+
+func newTLSUpstream(t *testing.T, clientAuth tls.ClientAuthType) *tlsUpstream {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strconv.Itoa(len(r.TLS.PeerCertificates))))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: clientAuth}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // 握手失败是预期的
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	cert := srv.TLS.Certificates[0]
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tlsUpstream{
+		srv:      srv,
+		caFile:   writePEM(t, dir, "ca.pem", "CERTIFICATE", srv.Certificate().Raw),
+		certFile: writePEM(t, dir, "cert.pem", "CERTIFICATE", cert.Certificate[0]),
+		keyFile:  writePEM(t, dir, "key.pem", "PRIVATE KEY", keyDER),
+	}
+}
+
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// proxyTo 通过反向代理请求上游，返回状态码和响应内容
+func proxyTo(t *testing.T, upstream string, tlsConfig *model.UpstreamTLSConfig) (int, string) {
+	t.Helper()
+	p := NewLoadBalanceReverseProxy(
+		"orders",
+		model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin},
+		[]*model.UpstreamsConfig{{Host: upstream, TLS: tlsConfig}},
+		circuit_breaker.NewBreakerManager(),
+	)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w.Code, w.Body.String()
+}
+
+func TestUpstreamTLS(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	upstream := newTLSUpstream(t, tls.NoClientCert)
+
+	tests := []struct {
+		name   string
+		config *model.UpstreamTLSConfig
+		want   int
+	}{
+		{name: "system ca", config: nil, want: http.StatusBadGateway},
+		{name: "custom ca", config: &model.UpstreamTLSConfig{CAFile: upstream.caFile}, want: http.StatusOK},
+		{name: "server name", config: &model.UpstreamTLSConfig{CAFile: upstream.caFile, ServerName: "example.com"}, want: http.StatusOK},
+		{name: "wrong server name", config: &model.UpstreamTLSConfig{CAFile: upstream.caFile, ServerName: "other.example"}, want: http.StatusBadGateway},
+		{name: "insecure skip verify", config: &model.UpstreamTLSConfig{InsecureSkipVerify: true}, want: http.StatusOK},
+		{name: "invalid ca file", config: &model.UpstreamTLSConfig{CAFile: upstream.certFile + ".missing"}, want: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := proxyTo(t, upstream.srv.URL, tt.config); code != tt.want {
+				t.Errorf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamTLSClientCert(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	upstream := newTLSUpstream(t, tls.RequireAnyClientCert)
+
+	config := &model.UpstreamTLSConfig{CAFile: upstream.caFile, ServerName: "example.com"}
+	if code, _ := proxyTo(t, upstream.srv.URL, config); code != http.StatusBadGateway {
+		t.Errorf("without client certificate status = %d, want %d", code, http.StatusBadGateway)
+	}
+
+	config = &model.UpstreamTLSConfig{
+		CAFile:     upstream.caFile,
+		CertFile:   upstream.certFile,
+		KeyFile:    upstream.keyFile,
+		ServerName: "example.com",
+	}
+	code, body := proxyTo(t, upstream.srv.URL, config)
+	if code != http.StatusOK || body != "1" {
+		t.Errorf("with client certificate status = %d, peer certificates = %q, want 200 and 1", code, body)
+	}
+}
+
+func TestGetTransportCache(t *testing.T) {
+	if got, _ := getTransport(model.TimeoutConfig{}, nil); got != transport {
+		t.Error("no timeout or tls config should use the global transport")
+	}
+
+	config := model.UpstreamTLSConfig{InsecureSkipVerify: true, ServerName: "cache.example"}
+	a, err := getTransport(model.TimeoutConfig{}, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 配置相同（不要求同一个指针）的上游节点共享连接池
+	copied := config
+	if b, _ := getTransport(model.TimeoutConfig{}, &copied); b != a {
+		t.Error("same tls config should share the transport")
+	}
+	if a.TLSClientConfig.ServerName != "cache.example" || !a.TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("tls client config not applied: %+v", a.TLSClientConfig)
+	}
+
+	copied.ServerName = "other.example"
+	if c, _ := getTransport(model.TimeoutConfig{}, &copied); c == a {
+		t.Error("different tls config should use another transport")
+	}
+}
+
+func TestCloseUnusedTransports(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	closed := make(chan struct{}, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	used := &model.UpstreamTLSConfig{InsecureSkipVerify: true, ServerName: "used.example"}
+	p := NewLoadBalanceReverseProxy(
+		"orders",
+		model.LoadBalanceConfig{Strategy: constants.StrategyRoundRobin},
+		[]*model.UpstreamsConfig{{Host: srv.URL, TLS: used}},
+		circuit_breaker.NewBreakerManager(),
+	)
+	kept, err := getTransport(model.TimeoutConfig{}, used)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 热更新后不再使用的 Transport 保留着空闲连接
+	unused, err := getTransport(model.TimeoutConfig{}, &model.UpstreamTLSConfig{InsecureSkipVerify: true, ServerName: "unused.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: unused}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	CloseUnusedTransports([]*LoadBalanceReverseProxy{p})
+
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Error("idle connection of the unused transport not closed")
+	}
+	transportsMu.RLock()
+	_, ok := transports[newTransportKey(model.TimeoutConfig{}, used)]
+	n := len(transports)
+	transportsMu.RUnlock()
+	if !ok || n != 1 {
+		t.Errorf("%d cached transports (used cached = %v), want only the used one", n, ok)
+	}
+	if got, _ := getTransport(model.TimeoutConfig{}, used); got != kept {
+		t.Error("transport still in use recreated")
+	}
+}
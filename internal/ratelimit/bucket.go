@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// 进程内令牌桶限流
+// 每个 key 一个令牌桶，使用 LRU 淘汰长时间未访问的 key，保证内存占用有上限
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucket 带 LRU 淘汰的令牌桶
+type TokenBucket struct {
+	rate    float64 // 每秒生成的令牌数
+	burst   float64
+	maxKeys int
+
+	mu    sync.Mutex
+	lru   *list.List               // 最近访问的 key 在前
+	items map[string]*list.Element // key -> *bucket
+}
+
+// NewTokenBucket 创建令牌桶，rate 为每秒生成的令牌数，burst 为桶容量
+func NewTokenBucket(rate float64, burst, maxKeys int) *TokenBucket {
+	return &TokenBucket{
+		rate:    rate,
+		burst:   float64(burst),
+		maxKeys: maxKeys,
+		lru:     list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+func (t *TokenBucket) Allow(_ context.Context, key string) (Result, error) {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.get(key, now)
+
+	// 按时间补充令牌
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(t.burst, b.tokens+elapsed*t.rate)
+		b.last = now
+	}
+
+	result := Result{Limit: int(t.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = t.duration(1 - b.tokens)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = t.duration(t.burst - b.tokens)
+	return result, nil
+}
+
+// Len 当前保存的 key 数量
+func (t *TokenBucket) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lru.Len()
+}
+
+// get 获取 key 对应的令牌桶，不存在时创建一个满的令牌桶（调用方需持有锁）
+func (t *TokenBucket) get(key string, now time.Time) *bucket {
+	if elem, ok := t.items[key]; ok {
+		t.lru.MoveToFront(elem)
+		return elem.Value.(*bucket)
+	}
+
+	b := &bucket{key: key, tokens: t.burst, last: now}
+	t.items[key] = t.lru.PushFront(b)
+
+	// 超出容量时淘汰最久未访问的 key
+	for t.maxKeys > 0 && t.lru.Len() > t.maxKeys {
+		oldest := t.lru.Back()
+		t.lru.Remove(oldest)
+		delete(t.items, oldest.Value.(*bucket).key)
+	}
+	return b
+}
+
+// duration 生成指定数量令牌需要的时间
+func (t *TokenBucket) duration(tokens float64) time.Duration {
+	if tokens <= 0 || t.rate <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / t.rate * float64(time.Second))
+}
@@ -0,0 +1,24 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// 限流存储接口
+// local：进程内令牌桶，每个网关实例独立计数
+// redis：基于 GCRA 算法，多个网关实例共享计数
+
+// Result 一次限流判断的结果
+type Result struct {
+	Allowed    bool
+	Limit      int           // 桶容量
+	Remaining  int           // 剩余令牌数
+	Reset      time.Duration // 令牌桶恢复满的时间
+	RetryAfter time.Duration // 被限流时，距离下一个令牌生成的时间
+}
+
+// Limiter 限流器，存储不可用时返回 error，由调用方根据 failure_mode 决定放行或拒绝
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
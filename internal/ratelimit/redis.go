@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 基于 Redis 的分布式限流，使用 GCRA（Generic Cell Rate Algorithm）
+// 每个 key 只保存一个理论到达时间（TAT），在 Lua 脚本中原子地完成判断和更新，
+// 效果与令牌桶一致：每 1/rate 秒生成一个令牌，最多积累 burst 个令牌
+
+// KEYS[1]: key
+// ARGV[1]: burst
+// ARGV[2]: 生成一个令牌的间隔（微秒）
+// 返回 {是否允许, 剩余令牌数, 重试等待时间（微秒）, 恢复满的时间（微秒）}
+const gcraScript = `
+redis.replicate_commands()
+local burst = tonumber(ARGV[1])
+local emission = tonumber(ARGV[2])
+local now = redis.call("TIME")
+now = tonumber(now[1]) * 1000000 + tonumber(now[2])
+
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if tat == nil or tat < now then
+  tat = now
+end
+
+local new_tat = tat + emission
+local diff = now - (new_tat - emission * burst)
+if diff < 0 then
+  return {0, 0, math.ceil(-diff), math.ceil(tat - now)}
+end
+
+local ttl = math.ceil((new_tat - now) / 1000)
+redis.call("SET", KEYS[1], string.format("%.0f", new_tat), "PX", ttl)
+return {1, math.floor(diff / emission), 0, math.ceil(new_tat - now)}
+`
+
+var gcraScriptSHA = func() string {
+	sum := sha1.Sum([]byte(gcraScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+var ErrRedisNotConfigured = errors.New("redis is not configured")
+
+// RedisLimiter 多实例共享的限流器
+type RedisLimiter struct {
+	name     string  // 规则标识，作为 key 的一部分
+	burst    int     // 桶容量
+	emission float64 // 生成一个令牌的间隔（微秒）
+}
+
+// NewRedisLimiter 创建分布式限流器，rate 为每秒生成的令牌数，burst 为桶容量
+func NewRedisLimiter(name string, rate float64, burst int) *RedisLimiter {
+	return &RedisLimiter{
+		name:     name,
+		burst:    burst,
+		emission: float64(time.Second/time.Microsecond) / rate,
+	}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	client := currentRedis()
+	if client == nil {
+		return Result{}, ErrRedisNotConfigured
+	}
+
+	args := []string{
+		"1", client.config.KeyPrefix + l.name + ":" + key,
+		strconv.Itoa(l.burst),
+		strconv.FormatFloat(l.emission, 'f', 3, 64),
+	}
+	reply, err := client.Do(ctx, append([]string{"EVALSHA", gcraScriptSHA}, args...)...)
+	var replyErr redisError
+	if errors.As(err, &replyErr) && strings.HasPrefix(string(replyErr), "NOSCRIPT") {
+		// 脚本未缓存（首次执行或 Redis 重启），使用 EVAL 执行并缓存
+		reply, err = client.Do(ctx, append([]string{"EVAL", gcraScript}, args...)...)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 4 {
+		return Result{}, fmt.Errorf("redis: unexpected gcra reply %v", reply)
+	}
+	ints := make([]int64, len(values))
+	for i, v := range values {
+		if ints[i], ok = v.(int64); !ok {
+			return Result{}, fmt.Errorf("redis: unexpected gcra reply %v", reply)
+		}
+	}
+
+	return Result{
+		Allowed:    ints[0] == 1,
+		Limit:      l.burst,
+		Remaining:  int(ints[1]),
+		RetryAfter: time.Duration(ints[2]) * time.Microsecond,
+		Reset:      time.Duration(ints[3]) * time.Microsecond,
+	}, nil
+}
+
+// 所有 redis 限流规则共享的客户端，配置热更新时替换
+var (
+	redisMu     sync.RWMutex
+	redisClient *RedisClient
+)
+
+// SetRedis 更新 Redis 配置，配置未变化时保留原有连接，addr 为空时关闭客户端
+func SetRedis(config model.RedisConfig) {
+	redisMu.Lock()
+	old := redisClient
+	if old != nil && old.origin == config {
+		redisMu.Unlock()
+		return
+	}
+
+	redisClient = nil
+	if config.Addr != "" {
+		redisClient = NewRedisClient(config)
+	}
+	redisMu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+}
+
+func currentRedis() *RedisClient {
+	redisMu.RLock()
+	defer redisMu.RUnlock()
+	return redisClient
+}
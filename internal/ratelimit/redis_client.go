@@ -0,0 +1,236 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 精简的 Redis 客户端，只实现限流需要的 RESP 协议命令
+
+var errRedisNil = errors.New("redis: nil reply")
+
+// redisError Redis 返回的错误回复，如 NOSCRIPT
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type RedisClient struct {
+	origin model.RedisConfig // 未填充默认值的配置，用于判断配置是否变化
+	config model.RedisConfig
+	idle   chan *redisConn // 空闲连接池
+	closed atomic.Bool
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewRedisClient(config model.RedisConfig) *RedisClient {
+	origin := config
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = constants.DefaultRedisDialTimeout
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = constants.DefaultRedisTimeout
+	}
+	if config.PoolSize <= 0 {
+		config.PoolSize = constants.DefaultRedisPoolSize
+	}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = constants.DefaultRedisKeyPrefix
+	}
+
+	return &RedisClient{
+		origin: origin,
+		config: config,
+		idle:   make(chan *redisConn, config.PoolSize),
+	}
+}
+
+// Do 执行一条命令，超时时间取 ctx 与配置中较早的一个
+// 空闲连接可能已被服务端关闭（重启、空闲超时），使用空闲连接出现网络错误时使用新连接重试一次
+func (c *RedisClient) Do(ctx context.Context, args ...string) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	conn, pooled, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.exec(ctx, conn, args...)
+	if pooled && isStaleConn(err) && ctx.Err() == nil {
+		if conn, err = c.dial(ctx); err != nil {
+			return nil, err
+		}
+		reply, err = c.exec(ctx, conn, args...)
+	}
+	return reply, err
+}
+
+// exec 在连接上执行命令，成功或收到错误回复时归还连接，网络错误时连接状态未知，直接关闭
+func (c *RedisClient) exec(ctx context.Context, conn *redisConn, args ...string) (interface{}, error) {
+	deadline, _ := ctx.Deadline()
+	_ = conn.conn.SetDeadline(deadline)
+
+	reply, err := conn.do(args...)
+	var replyErr redisError
+	if err != nil && !errors.Is(err, errRedisNil) && !errors.As(err, &replyErr) {
+		conn.conn.Close()
+		return nil, err
+	}
+	c.put(conn)
+	return reply, err
+}
+
+// isStaleConn 是否为连接已失效导致的错误（超时说明服务端响应慢，重试没有意义）
+func isStaleConn(err error) bool {
+	if err == nil || errors.Is(err, errRedisNil) {
+		return false
+	}
+	var replyErr redisError
+	if errors.As(err, &replyErr) {
+		return false
+	}
+	var netErr net.Error
+	return !errors.As(err, &netErr) || !netErr.Timeout()
+}
+
+// Close 关闭所有空闲连接，正在使用的连接归还时关闭
+func (c *RedisClient) Close() {
+	c.closed.Store(true)
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// get 获取连接，优先使用空闲连接，pooled 表示是否为空闲连接
+func (c *RedisClient) get(ctx context.Context) (conn *redisConn, pooled bool, err error) {
+	select {
+	case conn := <-c.idle:
+		return conn, true, nil
+	default:
+	}
+	conn, err = c.dial(ctx)
+	return conn, false, err
+}
+
+// dial 建立新连接并完成认证和选择数据库
+func (c *RedisClient) dial(ctx context.Context) (*redisConn, error) {
+	dialer := net.Dialer{Timeout: c.config.DialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", c.config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: nc, reader: bufio.NewReader(nc)}
+
+	deadline, _ := ctx.Deadline()
+	_ = nc.SetDeadline(deadline)
+	if c.config.Password != "" {
+		if _, err := conn.do("AUTH", c.config.Password); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	if c.config.DB != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(c.config.DB)); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *RedisClient) put(conn *redisConn) {
+	if c.closed.Load() {
+		conn.conn.Close()
+		return
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read 读取一个 RESP 回复
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: invalid reply %q", line)
+	}
+	payload := line[1 : len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := c.read()
+			if err != nil && !errors.Is(err, errRedisNil) {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", line[0])
+	}
+}
@@ -0,0 +1,191 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+// 使用 miniredis（内置 Lua 解释器）执行真实的 gcraScript
+
+// testRedis 启动 miniredis 并配置为全局 Redis，时钟固定，通过 advance 推进
+type testRedis struct {
+	*miniredis.Miniredis
+	now time.Time
+}
+
+func newTestRedis(t *testing.T) *testRedis {
+	t.Helper()
+	m := miniredis.RunT(t)
+	r := &testRedis{Miniredis: m, now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m.SetTime(r.now)
+	useRedis(t, m.Addr())
+	return r
+}
+
+// advance 推进脚本中 TIME 返回的时间和 key 的过期时间
+func (r *testRedis) advance(d time.Duration) {
+	r.now = r.now.Add(d)
+	r.SetTime(r.now)
+	r.FastForward(d)
+}
+
+func useRedis(t *testing.T, addr string) {
+	t.Helper()
+	SetRedis(model.RedisConfig{Addr: addr, KeyPrefix: "test:"})
+	t.Cleanup(func() { SetRedis(model.RedisConfig{}) })
+}
+
+func allow(t *testing.T, l *RedisLimiter, key string) Result {
+	t.Helper()
+	result, err := l.Allow(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	return result
+}
+
+func TestRedisLimiterSharedBudget(t *testing.T) {
+	redis := newTestRedis(t)
+
+	// 两个网关实例上的同一条规则共享令牌
+	a := NewRedisLimiter("orders/default", 1, 5)
+	b := NewRedisLimiter("orders/default", 1, 5)
+	for i := 0; i < 5; i++ {
+		l := a
+		if i%2 == 1 {
+			l = b
+		}
+		result := allow(t, l, "client-1")
+		if !result.Allowed {
+			t.Fatalf("request %d denied", i)
+		}
+		if want := 4 - i; result.Remaining != want {
+			t.Errorf("request %d remaining = %d, want %d", i, result.Remaining, want)
+		}
+	}
+	for _, l := range []*RedisLimiter{a, b} {
+		result := allow(t, l, "client-1")
+		if result.Allowed {
+			t.Fatal("request allowed after the shared budget is exhausted")
+		}
+		if result.RetryAfter != time.Second {
+			t.Errorf("retry after = %v, want 1s", result.RetryAfter)
+		}
+		if result.Reset != 5*time.Second {
+			t.Errorf("reset = %v, want 5s", result.Reset)
+		}
+	}
+
+	// 其他 key 使用独立的令牌桶
+	if !allow(t, a, "client-2").Allowed {
+		t.Error("request with another key denied")
+	}
+
+	// 按速率恢复令牌
+	redis.advance(time.Second)
+	if result := allow(t, b, "client-1"); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("after 1s allowed = %v remaining = %d, want true 0", result.Allowed, result.Remaining)
+	}
+	if allow(t, a, "client-1").Allowed {
+		t.Error("second request allowed with only one token generated")
+	}
+}
+
+func TestRedisLimiterKeyExpiry(t *testing.T) {
+	redis := newTestRedis(t)
+
+	l := NewRedisLimiter("orders/default", 2, 4)
+	for i := 0; i < 4; i++ {
+		allow(t, l, "client-1")
+	}
+	key := "test:orders/default:client-1"
+	if !redis.Exists(key) {
+		t.Fatalf("key %s not stored", key)
+	}
+	// 过期时间为令牌桶恢复满的时间
+	if ttl := redis.TTL(key); ttl != 2*time.Second {
+		t.Errorf("ttl = %v, want 2s", ttl)
+	}
+
+	// 令牌桶恢复满后 key 过期，不会一直占用内存
+	redis.advance(2 * time.Second)
+	if redis.Exists(key) {
+		t.Fatalf("key %s not expired after the bucket is full", key)
+	}
+	if result := allow(t, l, "client-1"); !result.Allowed || result.Remaining != 3 {
+		t.Errorf("after expiry allowed = %v remaining = %d, want true 3", result.Allowed, result.Remaining)
+	}
+}
+
+func TestRedisLimiterLoadsScript(t *testing.T) {
+	newTestRedis(t)
+	l := NewRedisLimiter("orders/default", 1, 2)
+	scriptCached := func() bool {
+		reply, err := currentRedis().Do(context.Background(), "SCRIPT", "EXISTS", gcraScriptSHA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reply.([]interface{})[0] == int64(1)
+	}
+
+	// 首次 EVALSHA 返回 NOSCRIPT 后使用 EVAL 执行，EVAL 同时缓存脚本
+	if scriptCached() {
+		t.Fatal("script cached before first use")
+	}
+	allow(t, l, "client-1")
+	if !scriptCached() {
+		t.Fatal("script not cached after EVAL")
+	}
+
+	// Redis 重启或执行 SCRIPT FLUSH 后脚本缓存丢失，重新加载
+	if _, err := currentRedis().Do(context.Background(), "SCRIPT", "FLUSH"); err != nil {
+		t.Fatal(err)
+	}
+	if result := allow(t, l, "client-1"); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("after script flush allowed = %v remaining = %d, want true 0", result.Allowed, result.Remaining)
+	}
+}
+
+func TestRedisLimiterStaleConnection(t *testing.T) {
+	newTestRedis(t)
+	l := NewRedisLimiter("orders/default", 1, 10)
+	allow(t, l, "client-1")
+
+	// 连接池中的连接已失效（如 Redis 重启、空闲超时被服务端关闭），使用新连接重试，不会返回错误
+	client := currentRedis()
+	stale := <-client.idle
+	stale.conn.Close()
+	client.idle <- stale
+
+	if result := allow(t, l, "client-1"); !result.Allowed || result.Remaining != 8 {
+		t.Errorf("allowed = %v remaining = %d, want true 8", result.Allowed, result.Remaining)
+	}
+	if n := len(client.idle); n != 1 {
+		t.Errorf("%d idle connections, want 1", n)
+	}
+}
+
+func TestRedisLimiterUnavailable(t *testing.T) {
+	l := NewRedisLimiter("orders/default", 1, 1)
+	if _, err := l.Allow(context.Background(), "client-1"); !errors.Is(err, ErrRedisNotConfigured) {
+		t.Errorf("err = %v, want ErrRedisNotConfigured", err)
+	}
+
+	// 连接被拒绝时返回错误，由调用方按 failure_mode 处理
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	useRedis(t, addr)
+	if _, err := l.Allow(context.Background(), "client-1"); err == nil {
+		t.Error("Allow succeeded with redis down")
+	}
+}
@@ -0,0 +1,179 @@
+package validator
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/lccxxo/bailuoli/internal/auth"
+	"github.com/lccxxo/bailuoli/internal/clientip"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+type AuthValidator struct {
+	BaseValidator
+}
+
+func (v *AuthValidator) Validate(route *model.Route) error {
+	var errs ValidationErrors
+	if route.IPRestriction != nil {
+		errs.Append(validateIPRestriction(route.IPRestriction).WithPrefix("ip_restriction"))
+	}
+	if route.ClientCert != nil {
+		errs.Append(validateClientCert(route.ClientCert).WithPrefix("client_cert"))
+	}
+	if route.Auth != nil {
+		errs.Append(validateAuth(route.Auth).WithPrefix("auth"))
+	}
+	if route.ExtAuthz != nil {
+		errs.Append(validateExtAuthz(route.ExtAuthz).WithPrefix("ext_authz"))
+	}
+	if len(route.MatchClaims) > 0 && (route.Auth == nil || route.Auth.Type != constants.AuthTypeJWT) {
+		errs.Add("match_claims", "auth.type must be %q when match_claims is configured", constants.AuthTypeJWT)
+	}
+	return v.validateNext(route, errs)
+}
+
+func validateIPRestriction(cfg *model.IPRestrictionConfig) ValidationErrors {
+	var errs ValidationErrors
+	if len(cfg.Allow) == 0 && len(cfg.Deny) == 0 {
+		errs.Add("", "allow or deny is required")
+	}
+	errs.Append(validatePrefixes("allow", cfg.Allow))
+	errs.Append(validatePrefixes("deny", cfg.Deny))
+	return errs
+}
+
+// validatePrefixes 校验 IP 或 CIDR 列表
+func validatePrefixes(field string, cidrs []string) ValidationErrors {
+	var errs ValidationErrors
+	for i, cidr := range cidrs {
+		if _, err := clientip.ParsePrefix(cidr); err != nil {
+			errs.Add(fmt.Sprintf("%s[%d]", field, i), "%v", err)
+		}
+	}
+	return errs
+}
+
+func validateClientCert(cfg *model.ClientCertConfig) ValidationErrors {
+	var errs ValidationErrors
+	for i, id := range cfg.AllowedSPIFFEIDs {
+		u, err := url.Parse(strings.TrimSuffix(id, "/*"))
+		if err != nil || u.Scheme != "spiffe" || u.Host == "" {
+			errs.Add(fmt.Sprintf("allowed_spiffe_ids[%d]", i), "invalid spiffe id %q, must be like spiffe://trust-domain/path", id)
+		}
+	}
+	return errs
+}
+
+func validateAuth(cfg *model.AuthConfig) ValidationErrors {
+	var errs ValidationErrors
+	switch cfg.Type {
+	case constants.AuthTypeJWT:
+		if cfg.JWT == nil {
+			errs.Add("jwt", "is required when type is %q", cfg.Type)
+			break
+		}
+		errs.Append(validateJWT(cfg.JWT).WithPrefix("jwt"))
+	case constants.AuthTypeAPIKey:
+		if cfg.APIKey == nil {
+			errs.Add("api_key", "is required when type is %q", cfg.Type)
+			break
+		}
+		errs.Append(validateCredentialsFile(cfg.APIKey.CredentialsFile).WithPrefix("api_key"))
+	case constants.AuthTypeBasic:
+		if cfg.Basic == nil {
+			errs.Add("basic", "is required when type is %q", cfg.Type)
+			break
+		}
+		errs.Append(validateCredentialsFile(cfg.Basic.CredentialsFile).WithPrefix("basic"))
+	default:
+		errs.Add("type", "unknown auth type %q, must be one of %s", cfg.Type, strings.Join(constants.AuthTypes, ", "))
+	}
+	return errs
+}
+
+func validateJWT(cfg *model.JWTConfig) ValidationErrors {
+	var errs ValidationErrors
+	for i, alg := range cfg.Algorithms {
+		if !slices.Contains(constants.JWTAlgorithms, alg) {
+			errs.Add(fmt.Sprintf("algorithms[%d]", i), "unsupported algorithm %q, must be one of %s",
+				alg, strings.Join(constants.JWTAlgorithms, ", "))
+		}
+	}
+	if cfg.JWKSURL != "" {
+		if u, err := url.Parse(cfg.JWKSURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.Add("jwks_url", "invalid url %q", cfg.JWKSURL)
+		}
+	}
+	if cfg.JWKSRefreshInterval < 0 {
+		errs.Add("jwks_refresh_interval", "cannot be negative")
+	}
+	if cfg.ClockSkew < 0 {
+		errs.Add("clock_skew", "cannot be negative")
+	}
+	if cfg.JWKSURL == "" && len(cfg.Keys) == 0 {
+		errs.Add("keys", "keys or jwks_url is required")
+	}
+	for i, k := range cfg.Keys {
+		path := fmt.Sprintf("keys[%d]", i)
+		if (k.Secret == "") == (k.PublicKeyFile == "") {
+			errs.Add(path, "exactly one of secret and public_key_file is required")
+		}
+	}
+	for claim, header := range cfg.ForwardClaims {
+		if header == "" {
+			errs.Add("forward_claims."+claim, "header cannot be empty")
+		}
+	}
+
+	// 加载密钥文件
+	if len(errs) == 0 {
+		if a, err := auth.NewJWTAuthenticator(*cfg); err != nil {
+			errs.Add("", "%v", err)
+		} else {
+			a.Close()
+		}
+	}
+	return errs
+}
+
+func validateCredentialsFile(file string) ValidationErrors {
+	var errs ValidationErrors
+	if file == "" {
+		errs.Add("credentials_file", "credentials_file cannot be empty")
+	} else if _, err := auth.LoadCredentials(file); err != nil {
+		errs.Add("credentials_file", "%v", err)
+	}
+	return errs
+}
+
+func validateExtAuthz(cfg *model.ExtAuthzConfig) ValidationErrors {
+	var errs ValidationErrors
+	if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.Add("url", "invalid url %q", cfg.URL)
+	}
+	if cfg.Timeout < 0 {
+		errs.Add("timeout", "cannot be negative")
+	}
+	if cfg.CacheTTL < 0 {
+		errs.Add("cache_ttl", "cannot be negative")
+	}
+	for i, name := range cfg.UpstreamHeaders {
+		if auth.IsProtectedUpstreamHeader(name) {
+			errs.Add(fmt.Sprintf("upstream_headers[%d]", i), "header %q cannot be set by the authorization service", name)
+		}
+	}
+	switch cfg.FailureMode {
+	case "", constants.ExtAuthzFailOpen, constants.ExtAuthzFailClosed:
+	default:
+		errs.Add("failure_mode", "unknown failure mode %q, must be one of %s, %s",
+			cfg.FailureMode, constants.ExtAuthzFailOpen, constants.ExtAuthzFailClosed)
+	}
+	if cfg.StatusOnError != 0 && (cfg.StatusOnError < 400 || cfg.StatusOnError > 599) {
+		errs.Add("status_on_error", "must be a 4xx or 5xx status code")
+	}
+	return errs
+}
@@ -3,6 +3,7 @@ package validator
 import "github.com/lccxxo/bailuoli/internal/model"
 
 // 使用责任链模式实现路由验证
+// 每个验证器收集自身的所有错误后继续调用下一个验证器，最终聚合返回 ValidationErrors
 
 type Validator interface {
 	Validate(*model.Route) error
@@ -17,12 +18,32 @@ func (v *BaseValidator) SetNext(next Validator) {
 	v.next = next
 }
 
+// validateNext 调用下一个验证器并合并错误
+func (v *BaseValidator) validateNext(route *model.Route, errs ValidationErrors) error {
+	if v.next != nil {
+		errs.Append(v.next.Validate(route))
+	}
+	return errs.ErrOrNil()
+}
+
 func NewValidationChain() Validator {
 	pathValidator := &PathValidator{}
 	matchTypeValidator := &MatchTypeValidator{}
+	upstreamValidator := &UpstreamValidator{}
 	lbValidator := &LoadBalanceValidator{}
+	retryValidator := &RetryValidator{}
+	timeoutValidator := &TimeoutValidator{}
+	rateLimitValidator := &RateLimitValidator{}
+	authValidator := &AuthValidator{}
+	corsValidator := &CORSValidator{}
 
 	pathValidator.SetNext(matchTypeValidator)
-	matchTypeValidator.SetNext(lbValidator)
+	matchTypeValidator.SetNext(upstreamValidator)
+	upstreamValidator.SetNext(lbValidator)
+	lbValidator.SetNext(retryValidator)
+	retryValidator.SetNext(timeoutValidator)
+	timeoutValidator.SetNext(rateLimitValidator)
+	rateLimitValidator.SetNext(authValidator)
+	authValidator.SetNext(corsValidator)
 	return pathValidator
 }
@@ -0,0 +1,55 @@
+package validator
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+type CORSValidator struct {
+	BaseValidator
+}
+
+func (v *CORSValidator) Validate(route *model.Route) error {
+	var errs ValidationErrors
+	if route.CORS != nil {
+		errs.Append(validateCORS(route.CORS).WithPrefix("cors"))
+	}
+	return v.validateNext(route, errs)
+}
+
+func validateCORS(cfg *model.CORSConfig) ValidationErrors {
+	var errs ValidationErrors
+	if len(cfg.AllowOrigins) == 0 && len(cfg.AllowOriginRegexes) == 0 {
+		errs.Add("", "allow_origins or allow_origin_regexes is required")
+	}
+	for i, origin := range cfg.AllowOrigins {
+		if origin != "*" && !strings.Contains(origin, "://") {
+			errs.Add(fmt.Sprintf("allow_origins[%d]", i), "invalid origin %q, must be like https://example.com", origin)
+		}
+	}
+	if cfg.AllowCredentials && slices.Contains(cfg.AllowOrigins, "*") {
+		errs.Add("allow_credentials", "cannot be used with allow_origins \"*\"")
+	}
+	for i, expr := range cfg.AllowOriginRegexes {
+		if _, err := regexp.Compile(expr); err != nil {
+			errs.Add(fmt.Sprintf("allow_origin_regexes[%d]", i), "invalid regex %q: %v", expr, err)
+		}
+	}
+	for i, method := range cfg.AllowMethods {
+		switch strings.ToUpper(method) {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+			http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		default:
+			errs.Add(fmt.Sprintf("allow_methods[%d]", i), "unknown method %q", method)
+		}
+	}
+	if cfg.MaxAge < 0 {
+		errs.Add("max_age", "cannot be negative")
+	}
+	return errs
+}
@@ -0,0 +1,93 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ValidationError 单条校验错误，Path 为字段在 YAML 中的路径，例如 routes[2].upstreams[0].host
+type ValidationError struct {
+	Path    string
+	Line    int // YAML 行号，0 表示未知
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	switch {
+	case e.Path == "":
+		return e.Message
+	case e.Line > 0:
+		return fmt.Sprintf("%s (line %d): %s", e.Path, e.Line, e.Message)
+	default:
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+}
+
+// ValidationErrors 聚合的校验错误，一次性报告所有问题
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d validation errors:", len(errs))
+	for _, e := range errs {
+		b.WriteString("\n  - ")
+		b.WriteString(e.Error())
+	}
+	return b.String()
+}
+
+// Add 添加一条错误
+func (errs *ValidationErrors) Add(path string, format string, args ...interface{}) {
+	*errs = append(*errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Append 合并错误，非 ValidationErrors 类型的错误作为无路径的错误追加
+func (errs *ValidationErrors) Append(err error) {
+	if err == nil {
+		return
+	}
+
+	var verrs ValidationErrors
+	if errors.As(err, &verrs) {
+		*errs = append(*errs, verrs...)
+		return
+	}
+	*errs = append(*errs, &ValidationError{Message: err.Error()})
+}
+
+// WithPrefix 为所有错误路径添加前缀
+func (errs ValidationErrors) WithPrefix(prefix string) ValidationErrors {
+	prefixed := make(ValidationErrors, 0, len(errs))
+	for _, e := range errs {
+		path := prefix
+		if e.Path != "" {
+			path = JoinPath(prefix, e.Path)
+		}
+		prefixed = append(prefixed, &ValidationError{Path: path, Line: e.Line, Message: e.Message})
+	}
+	return prefixed
+}
+
+// ErrOrNil 没有错误时返回 nil，避免返回非空接口
+func (errs ValidationErrors) ErrOrNil() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// JoinPath 拼接字段路径
+func JoinPath(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	if strings.HasPrefix(child, "[") {
+		return parent + child
+	}
+	return parent + "." + child
+}
@@ -1,8 +1,10 @@
 package validator
 
 import (
+	"fmt"
 	"github.com/lccxxo/bailuoli/internal/constants"
 	"github.com/lccxxo/bailuoli/internal/model"
+	"strings"
 )
 
 type LoadBalanceValidator struct {
@@ -10,13 +12,183 @@ type LoadBalanceValidator struct {
 }
 
 func (l *LoadBalanceValidator) Validate(route *model.Route) error {
-	if route.LoadBalance.Strategy == "weighted" && len(route.LoadBalance.Weighted) == 0 {
-		return constants.ErrNoWeightedConfig
+	var errs ValidationErrors
+	lb := route.LoadBalance
+
+	if !isKnownStrategy(lb.Strategy) {
+		errs.Add("load_balance.strategy", "unknown load balance strategy %q, must be one of %s",
+			lb.Strategy, strings.Join(constants.LoadBalanceStrategies, ", "))
+	}
+
+	if lb.Strategy == constants.StrategyWeighted && len(lb.Weighted) == 0 {
+		errs.Add("load_balance.weight", "%v", constants.ErrNoWeightedConfig)
+	}
+	for host, weight := range lb.Weighted {
+		if weight < 0 {
+			errs.Add("load_balance.weight", "weight of %s cannot be negative", host)
+		}
+	}
+
+	if lb.Strategy == constants.StrategyConsistentHash || lb.Strategy == constants.StrategyMaglev {
+		errs.Append(validateHashKey(lb.HashKey).WithPrefix("load_balance.hash_key"))
+	}
+	if lb.VirtualNodes < 0 {
+		errs.Add("load_balance.virtual_nodes", "cannot be negative")
+	}
+	if lb.EWMADecay < 0 {
+		errs.Add("load_balance.ewma_decay", "cannot be negative")
+	}
+	if lb.Sticky != nil {
+		errs.Append(validateSticky(lb.Sticky).WithPrefix("load_balance.sticky"))
+	}
+
+	if lb.MaxConn < 0 {
+		errs.Add("load_balance.max_conn", "%v", constants.ErrCountIllegal)
+	}
+	if lb.MaxRequests < 0 {
+		errs.Add("load_balance.max_requests", "%v", constants.ErrCountIllegal)
+	}
+	errs.Append(validateConnQueue(route, lb).WithPrefix("load_balance.queue"))
+
+	errs.Append(validateHealthyCheck(lb.HealthyCheck).WithPrefix("load_balance.healthy_check"))
+	errs.Append(validateOutlierDetection(lb.OutlierDetection).WithPrefix("load_balance.outlier_detection"))
+
+	return l.validateNext(route, errs)
+}
+
+func isKnownStrategy(strategy string) bool {
+	for _, s := range constants.LoadBalanceStrategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+func validateHashKey(cfg model.HashKeyConfig) ValidationErrors {
+	var errs ValidationErrors
+	switch cfg.Source {
+	case "", constants.HashKeyIP, constants.HashKeyPath:
+	case constants.HashKeyHeader, constants.HashKeyCookie, constants.HashKeyQuery:
+		if cfg.Name == "" {
+			errs.Add("name", "required when source is %q", cfg.Source)
+		}
+	default:
+		errs.Add("source", "unknown hash key source %q, must be one of %s",
+			cfg.Source, strings.Join(constants.HashKeySources, ", "))
+	}
+	return errs
+}
+
+func validateConnQueue(route *model.Route, lb model.LoadBalanceConfig) ValidationErrors {
+	var errs ValidationErrors
+	if lb.Queue.Size < 0 {
+		errs.Add("size", "%v", constants.ErrCountIllegal)
+	}
+	if lb.Queue.Timeout < 0 {
+		errs.Add("timeout", "cannot be negative")
+	}
+	if lb.Queue.Size > 0 && lb.MaxConn == 0 && lb.MaxRequests == 0 && !hasUpstreamMaxConn(route) {
+		errs.Add("size", "requires max_conn, max_requests or upstreams[].max_conn")
+	}
+	return errs
+}
+
+func hasUpstreamMaxConn(route *model.Route) bool {
+	for _, u := range route.Upstreams {
+		if u != nil && u.MaxConn > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func validateSticky(cfg *model.StickyConfig) ValidationErrors {
+	var errs ValidationErrors
+	if cfg.CookieName != "" && !isCookieName(cfg.CookieName) {
+		errs.Add("cookie_name", "invalid cookie name %q", cfg.CookieName)
+	}
+	if cfg.TTL < 0 {
+		errs.Add("ttl", "cannot be negative")
+	}
+	if cfg.Path != "" && !strings.HasPrefix(cfg.Path, "/") {
+		errs.Add("path", "must start with /")
+	}
+	switch strings.ToLower(cfg.SameSite) {
+	case "", constants.StickySameSiteLax, constants.StickySameSiteStrict, constants.StickySameSiteNone:
+	default:
+		errs.Add("same_site", "unknown same_site %q, must be one of %s, %s, %s", cfg.SameSite,
+			constants.StickySameSiteLax, constants.StickySameSiteStrict, constants.StickySameSiteNone)
 	}
+	return errs
+}
 
-	if route.LoadBalance.MaxConn < 0 {
-		return constants.ErrCountIllegal
+// isCookieName Cookie 名称只能包含 RFC 6265 token 字符
+func isCookieName(name string) bool {
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`()<>@,;:\"/[]?={}`, c) {
+			return false
+		}
 	}
+	return true
+}
 
-	return nil
+// validateHealthyCheck 主动健康检查对所有路由启用，零值使用默认值，这里只校验显式配置的非法值
+func validateHealthyCheck(cfg model.HealthyConfig) ValidationErrors {
+	var errs ValidationErrors
+	if cfg.Interval < 0 {
+		errs.Add("interval", "cannot be negative")
+	}
+	if cfg.Timeout < 0 {
+		errs.Add("timeout", "cannot be negative")
+	}
+	if cfg.HealthyThreshold < 0 {
+		errs.Add("healthy_threshold", "cannot be negative")
+	}
+	if cfg.UnhealthyThreshold < 0 {
+		errs.Add("unhealthy_threshold", "cannot be negative")
+	}
+	for i, code := range cfg.SuccessCode {
+		if !isStatusCode(code) {
+			errs.Add(fmt.Sprintf("success_code[%d]", i), "invalid http status code %d", code)
+		}
+	}
+	return errs
+}
+
+func validateOutlierDetection(cfg model.OutlierDetectionConfig) ValidationErrors {
+	var errs ValidationErrors
+	if !cfg.Enable {
+		return errs
+	}
+
+	// 零值使用默认值，这里只校验显式配置的非法值
+	if cfg.ConsecutiveErrors < 0 {
+		errs.Add("consecutive_errors", "cannot be negative")
+	}
+	if cfg.Interval < 0 {
+		errs.Add("interval", "cannot be negative")
+	}
+	if cfg.BaseEjectionTime < 0 {
+		errs.Add("base_ejection_time", "cannot be negative")
+	}
+	if cfg.MaxEjectionTime < 0 {
+		errs.Add("max_ejection_time", "cannot be negative")
+	}
+	if cfg.MaxEjectionTime > 0 && cfg.BaseEjectionTime > cfg.MaxEjectionTime {
+		errs.Add("base_ejection_time", "cannot be greater than max_ejection_time")
+	}
+	if cfg.MaxEjectionPercent < 0 || cfg.MaxEjectionPercent > 100 {
+		errs.Add("max_ejection_percent", "must be between 0 and 100, got %d", cfg.MaxEjectionPercent)
+	}
+	if cfg.SuccessRateMinimumHosts < 0 {
+		errs.Add("success_rate_minimum_hosts", "cannot be negative")
+	}
+	if cfg.SuccessRateRequestVolume < 0 {
+		errs.Add("success_rate_request_volume", "cannot be negative")
+	}
+	if cfg.SuccessRateStdevFactor < 0 {
+		errs.Add("success_rate_stdev_factor", "cannot be negative")
+	}
+	return errs
 }
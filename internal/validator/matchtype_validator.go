@@ -1,8 +1,8 @@
 package validator
 
 import (
-	"fmt"
 	"github.com/lccxxo/bailuoli/internal/model"
+	"regexp"
 )
 
 type MatchTypeValidator struct {
@@ -10,13 +10,15 @@ type MatchTypeValidator struct {
 }
 
 func (v *MatchTypeValidator) Validate(route *model.Route) error {
+	var errs ValidationErrors
 	switch route.MatchType {
-	case "exact", "prefix", "regex":
-		if v.next != nil {
-			return v.next.Validate(route)
+	case "exact", "prefix":
+	case "regex":
+		if _, err := regexp.Compile(route.Path); err != nil {
+			errs.Add("path", "invalid regex pattern: %v", err)
 		}
-		return nil
 	default:
-		return fmt.Errorf("invalid match type: %s", route.MatchType)
+		errs.Add("match_type", "invalid match type %q, must be one of exact, prefix, regex", route.MatchType)
 	}
+	return v.validateNext(route, errs)
 }
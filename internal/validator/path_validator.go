@@ -1,7 +1,6 @@
 package validator
 
 import (
-	"fmt"
 	"github.com/lccxxo/bailuoli/internal/model"
 )
 
@@ -10,11 +9,12 @@ type PathValidator struct {
 }
 
 func (v *PathValidator) Validate(route *model.Route) error {
-	if route.Path == "" {
-		return fmt.Errorf("route %s: path cannot be empty", route.Name)
+	var errs ValidationErrors
+	if route.Name == "" {
+		errs.Add("name", "route name cannot be empty")
 	}
-	if v.next != nil {
-		return v.next.Validate(route)
+	if route.Path == "" {
+		errs.Add("path", "path cannot be empty")
 	}
-	return nil
+	return v.validateNext(route, errs)
 }
@@ -0,0 +1,84 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+type RateLimitValidator struct {
+	BaseValidator
+}
+
+func (v *RateLimitValidator) Validate(route *model.Route) error {
+	var errs ValidationErrors
+	names := make(map[string]bool)
+	for i, rule := range route.RateLimits {
+		path := fmt.Sprintf("rate_limits[%d]", i)
+		if rule == nil {
+			errs.Add(path, "rate limit rule cannot be empty")
+			continue
+		}
+		if rule.Name != "" {
+			if names[rule.Name] {
+				errs.Add(path+".name", "duplicate rate limit name %q", rule.Name)
+			}
+			names[rule.Name] = true
+		}
+		errs.Append(validateRateLimit(rule, route.Auth).WithPrefix(path))
+	}
+	return v.validateNext(route, errs)
+}
+
+// validateRateLimit 校验限流规则，key 为 jwt_claim 时路由必须配置 jwt 认证，只使用校验过签名的 claim
+func validateRateLimit(cfg *model.RateLimitConfig, authConfig *model.AuthConfig) ValidationErrors {
+	var errs ValidationErrors
+	switch cfg.Key {
+	case "", constants.RateLimitKeyRoute, constants.RateLimitKeyIP:
+	case constants.RateLimitKeyHeader:
+		if cfg.Header == "" {
+			errs.Add("header", "is required when key is %q", cfg.Key)
+		}
+	case constants.RateLimitKeyJWTClaim:
+		if cfg.Claim == "" {
+			errs.Add("claim", "is required when key is %q", cfg.Key)
+		}
+		if authConfig == nil || authConfig.Type != constants.AuthTypeJWT {
+			errs.Add("key", "%q requires auth.type %q on the route", cfg.Key, constants.AuthTypeJWT)
+		}
+	default:
+		errs.Add("key", "unknown rate limit key %q, must be one of %s",
+			cfg.Key, strings.Join(constants.RateLimitKeys, ", "))
+	}
+
+	if cfg.Rate <= 0 {
+		errs.Add("rate", "must be greater than zero")
+	}
+	if cfg.Period < 0 {
+		errs.Add("period", "cannot be negative")
+	}
+	if cfg.Burst < 0 {
+		errs.Add("burst", "cannot be negative")
+	}
+	if cfg.StatusCode != 0 && (cfg.StatusCode < 400 || cfg.StatusCode > 599) {
+		errs.Add("status_code", "must be a 4xx or 5xx status code")
+	}
+	if cfg.MaxKeys < 0 {
+		errs.Add("max_keys", "cannot be negative")
+	}
+	switch cfg.Backend {
+	case "", constants.RateLimitBackendLocal, constants.RateLimitBackendRedis:
+	default:
+		errs.Add("backend", "unknown rate limit backend %q, must be one of %s, %s",
+			cfg.Backend, constants.RateLimitBackendLocal, constants.RateLimitBackendRedis)
+	}
+	switch cfg.FailureMode {
+	case "", constants.RateLimitFailOpen, constants.RateLimitFailClosed:
+	default:
+		errs.Add("failure_mode", "unknown failure mode %q, must be one of %s, %s",
+			cfg.FailureMode, constants.RateLimitFailOpen, constants.RateLimitFailClosed)
+	}
+	return errs
+}
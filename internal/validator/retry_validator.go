@@ -0,0 +1,63 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+type RetryValidator struct {
+	BaseValidator
+}
+
+func (v *RetryValidator) Validate(route *model.Route) error {
+	var errs ValidationErrors
+	if route.Retry != nil {
+		errs.Append(validateRetry(route.Retry).WithPrefix("retry"))
+	}
+	return v.validateNext(route, errs)
+}
+
+func validateRetry(cfg *model.RetryConfig) ValidationErrors {
+	var errs ValidationErrors
+	if cfg.Attempts < 0 {
+		errs.Add("attempts", "%v", constants.ErrCountIllegal)
+	}
+	for i, condition := range cfg.RetryOn {
+		if !isRetryCondition(condition) {
+			errs.Add(fmt.Sprintf("retry_on[%d]", i), "unknown retry condition %q, must be one of %s",
+				condition, strings.Join(constants.RetryConditions, ", "))
+		}
+	}
+	for i, code := range cfg.RetriableStatusCodes {
+		if !isStatusCode(code) {
+			errs.Add(fmt.Sprintf("retriable_status_codes[%d]", i), "invalid http status code %d", code)
+		}
+	}
+	if cfg.PerTryTimeout < 0 {
+		errs.Add("per_try_timeout", "cannot be negative")
+	}
+	if cfg.BaseInterval < 0 {
+		errs.Add("base_interval", "cannot be negative")
+	}
+	if cfg.MaxInterval < 0 {
+		errs.Add("max_interval", "cannot be negative")
+	} else if cfg.MaxInterval > 0 && cfg.MaxInterval < cfg.BaseInterval {
+		errs.Add("max_interval", "cannot be less than base_interval")
+	}
+	if cfg.MaxBodySize < 0 {
+		errs.Add("max_body_size", "cannot be negative")
+	}
+	return errs
+}
+
+func isRetryCondition(condition string) bool {
+	for _, c := range constants.RetryConditions {
+		if c == condition {
+			return true
+		}
+	}
+	return false
+}
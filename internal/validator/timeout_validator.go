@@ -0,0 +1,33 @@
+package validator
+
+import (
+	"github.com/lccxxo/bailuoli/internal/model"
+)
+
+type TimeoutValidator struct {
+	BaseValidator
+}
+
+func (v *TimeoutValidator) Validate(route *model.Route) error {
+	var errs ValidationErrors
+	timeout := route.Timeout
+
+	if timeout.Connect < 0 {
+		errs.Add("timeout.connect", "cannot be negative")
+	}
+	if timeout.ResponseHeader < 0 {
+		errs.Add("timeout.response_header", "cannot be negative")
+	}
+	if timeout.Request < 0 {
+		errs.Add("timeout.request", "cannot be negative")
+	}
+	if timeout.Idle < 0 {
+		errs.Add("timeout.idle", "cannot be negative")
+	}
+
+	// 单次尝试超时大于整个请求超时时不会生效
+	if route.Retry != nil && timeout.Request > 0 && route.Retry.PerTryTimeout > timeout.Request {
+		errs.Add("retry.per_try_timeout", "cannot be greater than timeout.request")
+	}
+	return v.validateNext(route, errs)
+}
@@ -0,0 +1,159 @@
+package validator
+
+import (
+	"fmt"
+	"github.com/lccxxo/bailuoli/internal/certs"
+	"github.com/lccxxo/bailuoli/internal/constants"
+	"github.com/lccxxo/bailuoli/internal/model"
+	"net/url"
+	"strings"
+)
+
+type UpstreamValidator struct {
+	BaseValidator
+}
+
+func (v *UpstreamValidator) Validate(route *model.Route) error {
+	var errs ValidationErrors
+	if route.Discovery != nil {
+		if len(route.Upstreams) > 0 {
+			errs.Add("discovery", "upstreams and discovery cannot be used together")
+		}
+		errs.Append(validateDiscovery(route.Discovery).WithPrefix("discovery"))
+	} else if len(route.Upstreams) == 0 {
+		errs.Add("upstreams", "at least one upstream or discovery is required")
+	}
+
+	for i, upstream := range route.Upstreams {
+		path := fmt.Sprintf("upstreams[%d]", i)
+		if upstream == nil {
+			errs.Add(path, "upstream cannot be empty")
+			continue
+		}
+		errs.Append(validateUpstreamURL(upstream).WithPrefix(path))
+		errs.Append(validateCircuitBreaker(upstream.CircuitBreakerConfig).WithPrefix(JoinPath(path, "circuit_breaker")))
+		errs.Append(validateUpstreamTLS(upstream.TLS).WithPrefix(JoinPath(path, "tls")))
+		if upstream.MaxConn < 0 {
+			errs.Add(JoinPath(path, "max_conn"), "%v", constants.ErrCountIllegal)
+		}
+	}
+	return v.validateNext(route, errs)
+}
+
+func validateDiscovery(cfg *model.DiscoveryConfig) ValidationErrors {
+	var errs ValidationErrors
+	switch cfg.Type {
+	case constants.DiscoveryConsul:
+		if cfg.Service == "" {
+			errs.Add("service", "service cannot be empty")
+		}
+		if cfg.Address != "" {
+			if u, err := url.Parse(cfg.Address); err != nil || u.Host == "" {
+				errs.Add("address", "invalid consul address %q", cfg.Address)
+			}
+		}
+		if cfg.WaitTime < 0 {
+			errs.Add("wait_time", "cannot be negative")
+		}
+	case constants.DiscoveryFile:
+		if cfg.File == "" {
+			errs.Add("file", "file cannot be empty")
+		}
+	case constants.DiscoveryDNS:
+		if cfg.Name == "" {
+			errs.Add("name", "name cannot be empty")
+		}
+		switch strings.ToUpper(cfg.RecordType) {
+		case "", "A", "AAAA":
+			if cfg.Port <= 0 || cfg.Port > 65535 {
+				errs.Add("port", "must be between 1 and 65535 for A/AAAA records")
+			}
+		case "SRV":
+		default:
+			errs.Add("record_type", "unknown record type %q, must be one of A, AAAA, SRV", cfg.RecordType)
+		}
+		if cfg.RefreshInterval < 0 {
+			errs.Add("refresh_interval", "cannot be negative")
+		}
+	default:
+		errs.Add("type", "unknown discovery type %q", cfg.Type)
+	}
+
+	if cfg.Scheme != "" && cfg.Scheme != "http" && cfg.Scheme != "https" {
+		errs.Add("scheme", "must be http or https")
+	}
+	errs.Append(validateCircuitBreaker(cfg.CircuitBreakerConfig).WithPrefix("circuit_breaker"))
+	errs.Append(validateUpstreamTLS(cfg.TLS).WithPrefix("tls"))
+	return errs
+}
+
+// validateUpstreamTLS 校验上游 TLS 配置，CA 和客户端证书必须可以加载
+func validateUpstreamTLS(cfg *model.UpstreamTLSConfig) ValidationErrors {
+	var errs ValidationErrors
+	if cfg == nil {
+		return errs
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		errs.Add("cert_file", "cert_file and key_file must be configured together")
+		return errs
+	}
+	if _, err := certs.ClientTLSConfig(cfg); err != nil {
+		errs.Add("", "%v", err)
+	}
+	return errs
+}
+
+func validateUpstreamURL(upstream *model.UpstreamsConfig) ValidationErrors {
+	var errs ValidationErrors
+	if upstream.Host == "" {
+		errs.Add("host", "host cannot be empty")
+		return errs
+	}
+
+	u, err := url.Parse(upstream.Host + upstream.Path)
+	if err != nil {
+		errs.Add("host", "invalid upstream url %q: %v", upstream.Host+upstream.Path, err)
+		return errs
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		errs.Add("host", "upstream url %q must use http or https scheme", upstream.Host)
+	} else if u.Host == "" {
+		errs.Add("host", "upstream url %q has no host", upstream.Host)
+	}
+	return errs
+}
+
+func validateCircuitBreaker(cfg model.CircuitBreakerConfig) ValidationErrors {
+	var errs ValidationErrors
+	if cfg.FailureThreshold < 0 || cfg.FailureThreshold > 1 {
+		errs.Add("failure_threshold", "must be between 0 and 1, got %v", cfg.FailureThreshold)
+	}
+	if cfg.ConsecutiveErrorTrigger < 0 {
+		errs.Add("consecutive_error_trigger", "cannot be negative")
+	}
+	if cfg.HalfOpenMaxRequests < 0 {
+		errs.Add("half_open_max_requests", "cannot be negative")
+	}
+	if cfg.WindowDuration < 0 {
+		errs.Add("window_duration", "cannot be negative")
+	}
+
+	// 配置了熔断阈值时必须设置熔断等待时间
+	enabled := cfg.FailureThreshold > 0 || cfg.ConsecutiveErrorTrigger > 0
+	if enabled && cfg.OpenStateTimeout <= 0 {
+		errs.Add("open_state_timeout", "must be greater than zero when circuit breaker is enabled")
+	} else if cfg.OpenStateTimeout < 0 {
+		errs.Add("open_state_timeout", "cannot be negative")
+	}
+
+	for i, code := range cfg.FailureStatusCodes {
+		if !isStatusCode(code) {
+			errs.Add(fmt.Sprintf("failure_status_codes[%d]", i), "invalid http status code %d", code)
+		}
+	}
+	return errs
+}
+
+func isStatusCode(code int) bool {
+	return code >= 100 && code <= 599
+}